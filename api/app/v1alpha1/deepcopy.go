@@ -1,51 +1,121 @@
-package v1alpha1
-
-import "k8s.io/apimachinery/pkg/runtime"
-
-// DeepCopyInto copies all properties of this object into another object of the
-// same type that is provided as a pointer.
-func (in *App) DeepCopyInto(out *App) {
-	out.TypeMeta = in.TypeMeta
-	out.ObjectMeta = in.ObjectMeta
-	out.Spec = AppSpec{
-		Environment:         in.Spec.Environment,
-		PreviewEnvironment:   in.Spec.PreviewEnvironment,
-		Source:            in.Spec.Source,
-		ContainerRegistry: in.Spec.ContainerRegistry,
-		Dependencies:      in.Spec.Dependencies,
-	}
-	out.Status = AppStatus{
-		State:             in.Status.State,
-		Message:           in.Status.Message,
-		HealthStatus:      in.Status.HealthStatus,
-		PreviewURLs:       in.Status.PreviewURLs,   
-		ObservedGeneration: in.Status.ObservedGeneration,
-		
-	}
-	
-}
-
-
-// DeepCopyObject returns a generically typed copy of an object
-func (in *App) DeepCopyObject() runtime.Object {
-	out := App{}
-	in.DeepCopyInto(&out)
-
-	return &out
-}
-
-// DeepCopyObject returns a generically typed copy of an object
-func (in *AppList) DeepCopyObject() runtime.Object {
-	out := AppList{}
-	out.TypeMeta = in.TypeMeta
-	out.ListMeta = in.ListMeta
-
-	if in.Items != nil {
-		out.Items = make([]App, len(in.Items)) 
-		for i := range in.Items {
-			in.Items[i].DeepCopyInto(&out.Items[i])
-		}
-	}
-
-	return &out
-}
+package v1alpha1
+
+import "k8s.io/apimachinery/pkg/runtime"
+
+// DeepCopyInto copies all properties of this object into another object of the
+// same type that is provided as a pointer.
+func (in *App) DeepCopyInto(out *App) {
+	out.TypeMeta = in.TypeMeta
+	out.ObjectMeta = in.ObjectMeta
+	out.Spec = AppSpec{
+		Environment:         in.Spec.Environment,
+		PreviewEnvironment:   in.Spec.PreviewEnvironment,
+		Source:            in.Spec.Source,
+		ContainerRegistry: in.Spec.ContainerRegistry,
+		Dependencies:      in.Spec.Dependencies,
+		Promotion:         in.Spec.Promotion,
+	}
+	out.Spec.Source.ValueFiles = append([]string(nil), in.Spec.Source.ValueFiles...)
+	if in.Spec.Source.ValuesRef != nil {
+		valuesRef := *in.Spec.Source.ValuesRef
+		out.Spec.Source.ValuesRef = &valuesRef
+	}
+	out.Spec.Source.ValuesFrom = append([]ValuesFromSource(nil), in.Spec.Source.ValuesFrom...)
+	if in.Spec.Promotion != nil {
+		promotion := *in.Spec.Promotion
+		promotion.Checks = append([]PromotionCheck(nil), in.Spec.Promotion.Checks...)
+		out.Spec.Promotion = &promotion
+	}
+	if in.Spec.Strategy != nil {
+		strategy := *in.Spec.Strategy
+		if in.Spec.Strategy.Canary != nil {
+			canary := *in.Spec.Strategy.Canary
+			canary.Steps = append([]CanaryStep(nil), in.Spec.Strategy.Canary.Steps...)
+			strategy.Canary = &canary
+		}
+		if in.Spec.Strategy.BlueGreen != nil {
+			blueGreen := *in.Spec.Strategy.BlueGreen
+			strategy.BlueGreen = &blueGreen
+		}
+		out.Spec.Strategy = &strategy
+	}
+	if in.Spec.Source.Kustomize != nil {
+		kustomize := *in.Spec.Source.Kustomize
+		kustomize.Images = append([]string(nil), in.Spec.Source.Kustomize.Images...)
+		if in.Spec.Source.Kustomize.Patches != nil {
+			kustomize.Patches = make([]KustomizePatch, len(in.Spec.Source.Kustomize.Patches))
+			for i, patch := range in.Spec.Source.Kustomize.Patches {
+				if patch.Target != nil {
+					target := *patch.Target
+					patch.Target = &target
+				}
+				kustomize.Patches[i] = patch
+			}
+		}
+		out.Spec.Source.Kustomize = &kustomize
+	}
+	if in.Spec.Source.Directory != nil {
+		directory := *in.Spec.Source.Directory
+		out.Spec.Source.Directory = &directory
+	}
+	out.Status = AppStatus{
+		State:             in.Status.State,
+		Message:           in.Status.Message,
+		HealthStatus:      in.Status.HealthStatus,
+		PreviewURLs:       in.Status.PreviewURLs,   
+		ObservedGeneration: in.Status.ObservedGeneration,
+		
+	}
+	if in.Status.ApplicationSet != nil {
+		appSet := *in.Status.ApplicationSet
+		appSet.Diff = append([]string(nil), in.Status.ApplicationSet.Diff...)
+		out.Status.ApplicationSet = &appSet
+	}
+	if in.Status.Deployment != nil {
+		deployment := *in.Status.Deployment
+		if in.Status.Deployment.HealthySince != nil {
+			healthySince := *in.Status.Deployment.HealthySince
+			deployment.HealthySince = &healthySince
+		}
+		out.Status.Deployment = &deployment
+	}
+	if in.Status.Promotion != nil {
+		promotion := *in.Status.Promotion
+		if in.Status.Promotion.LastPromoted != nil {
+			lastPromoted := *in.Status.Promotion.LastPromoted
+			promotion.LastPromoted = &lastPromoted
+		}
+		promotion.Pipeline = append([]PromotionStage(nil), in.Status.Promotion.Pipeline...)
+		out.Status.Promotion = &promotion
+	}
+	if in.Status.Rollout != nil {
+		rollout := *in.Status.Rollout
+		out.Status.Rollout = &rollout
+	}
+	
+}
+
+
+// DeepCopyObject returns a generically typed copy of an object
+func (in *App) DeepCopyObject() runtime.Object {
+	out := App{}
+	in.DeepCopyInto(&out)
+
+	return &out
+}
+
+// DeepCopyObject returns a generically typed copy of an object
+func (in *AppList) DeepCopyObject() runtime.Object {
+	out := AppList{}
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+
+	if in.Items != nil {
+		out.Items = make([]App, len(in.Items)) 
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+
+	return &out
+}
@@ -1,85 +1,236 @@
-package v1alpha1
-
-import (
-    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-    "k8s.io/apimachinery/pkg/runtime"
-    appv1alpha1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
-    
-
-)
-
-// +groupName=alustan.io
-
-// AppSpec defines the desired state of App
-type AppSpec struct {
-    Environment          string             `json:"environment"`
-    PreviewEnvironment   PreviewEnvironment    `json:"previewEnvironment"` 
-    Source           SourceSpec         `json:"source"`
-    ContainerRegistry ContainerRegistry `json:"containerRegistry"`
-    Dependencies     Dependencies       `json:"dependencies"`
-}
-
-type PreviewEnvironment struct {
-	Enabled  bool   `json:"enabled"`
-	GitOwner string `json:"gitOwner"`
-	GitRepo  string `json:"gitRepo"`
-    IntervalSeconds int `json:"intervalSeconds"`
-}
-
-// SourceSpec defines the source repository and deployment values
-type SourceSpec struct {
-    RepoURL        string                 `json:"repoURL"`
-    Path           string                 `json:"path"`
-    ReleaseName    string                 `json:"releaseName"`
-    TargetRevision string                 `json:"targetRevision"`
-    Values         map[string]runtime.RawExtension `json:"values,omitempty"`
-}
-
-// ContainerRegistry defines the container registry information
-type ContainerRegistry struct {
-    Provider        string `json:"provider"`
-    ImageName       string `json:"imageName"`
-    SemanticVersion string `json:"semanticVersion"`
-}
-
-// Dependencies defines the App dependencies
-type Dependencies struct {
-    Service []map[string]string `json:"service"`
-}
-
-
-// AppStatus defines the observed state of App
-type AppStatus struct {
-    State    string    `json:"state"`
-	Message   string    `json:"message,omitempty"`
-    HealthStatus   []appv1alpha1.ApplicationCondition    `json:"healthStatus,omitempty"`
-    PreviewURLs    map[string]runtime.RawExtension     `json:"previewURLs,omitempty"`
-	ObservedGeneration int                         `json:"observedGeneration,omitempty"`
-}
-
-
-
-// +kubebuilder:object:root=true
-// +kubebuilder:subresource:status
-// +kubebuilder:resource:path=apps,scope=Namespaced
-
-// App is the Schema for the apps API
-type App struct {
-    metav1.TypeMeta   `json:",inline"`
-    metav1.ObjectMeta `json:"metadata,omitempty"`
-
-    Spec   AppSpec   `json:"spec,omitempty"`
-    Status AppStatus `json:"status,omitempty"`
-}
-
-
-// +kubebuilder:object:root=true
-
-// AppList contains a list of App
-type AppList struct {
-    metav1.TypeMeta `json:",inline"`
-    metav1.ListMeta `json:"metadata,omitempty"`
-    Items           []App `json:"items"`
-}
-
-
+package v1alpha1
+
+import (
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    appv1alpha1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+    
+
+)
+
+// +groupName=alustan.io
+
+// AppSpec defines the desired state of App
+type AppSpec struct {
+    Environment          string             `json:"environment"`
+    PreviewEnvironment   PreviewEnvironment    `json:"previewEnvironment"` 
+    Source           SourceSpec         `json:"source"`
+    ContainerRegistry ContainerRegistry `json:"containerRegistry"`
+    Dependencies     Dependencies       `json:"dependencies"`
+    Promotion        *Promotion         `json:"promotion,omitempty"`
+    Strategy         *Strategy          `json:"strategy,omitempty"`
+}
+
+// Strategy rolls a new image tag out next to the running one, shifting the traffic of the Ingress to it gradually
+type Strategy struct {
+    Canary           *CanaryStrategy    `json:"canary,omitempty"`
+    BlueGreen        *BlueGreenStrategy `json:"blueGreen,omitempty"`
+    ProgressDeadline metav1.Duration    `json:"progressDeadline,omitempty"`
+}
+
+// CanaryStrategy shifts the traffic to the new tag in steps
+type CanaryStrategy struct {
+    Steps []CanaryStep `json:"steps"`
+}
+
+// CanaryStep sends a share of the traffic to the new tag, then waits before the next step
+type CanaryStep struct {
+    SetWeight int             `json:"setWeight"`
+    Pause     metav1.Duration `json:"pause,omitempty"`
+}
+
+// BlueGreenStrategy runs the new tag without traffic, then switches all the traffic to it at once
+type BlueGreenStrategy struct {
+    PreviewDuration metav1.Duration `json:"previewDuration,omitempty"`
+    ScaleDownDelay  metav1.Duration `json:"scaleDownDelay,omitempty"`
+}
+
+// Promotion promotes the image tag running healthy in the environment of another App
+type Promotion struct {
+    From         string           `json:"from"`
+    SoakDuration metav1.Duration  `json:"soakDuration,omitempty"`
+    Checks       []PromotionCheck `json:"checks,omitempty"`
+}
+
+// PromotionCheck is an HTTP endpoint that must answer with the expected status before a tag is promoted
+type PromotionCheck struct {
+    Name           string `json:"name"`
+    URL            string `json:"url"`
+    ExpectedStatus int    `json:"expectedStatus,omitempty"`
+}
+
+type PreviewEnvironment struct {
+	Enabled  bool   `json:"enabled"`
+	GitOwner string `json:"gitOwner"`
+	GitRepo  string `json:"gitRepo"`
+    IntervalSeconds int `json:"intervalSeconds"`
+}
+
+// SourceSpec defines the source repository and deployment values
+type SourceSpec struct {
+    Type           string                 `json:"type,omitempty"`
+    RepoURL        string                 `json:"repoURL"`
+    Path           string                 `json:"path,omitempty"`
+    ReleaseName    string                 `json:"releaseName,omitempty"`
+    TargetRevision string                 `json:"targetRevision,omitempty"`
+    Chart          string                 `json:"chart,omitempty"`
+    Version        string                 `json:"version,omitempty"`
+    Values         map[string]runtime.RawExtension `json:"values,omitempty"`
+    ValueFiles     []string               `json:"valueFiles,omitempty"`
+    ValuesRef      *ValuesRef             `json:"valuesRef,omitempty"`
+    ValuesFrom     []ValuesFromSource     `json:"valuesFrom,omitempty"`
+    // AllowSensitiveOutputs lets placeholders resolve sensitive Terraform outputs, which are then written
+    // in plain text into the ApplicationSet and its Applications
+    AllowSensitiveOutputs bool            `json:"allowSensitiveOutputs,omitempty"`
+    Kustomize      *KustomizeSource       `json:"kustomize,omitempty"`
+    Directory      *DirectorySource       `json:"directory,omitempty"`
+}
+
+// ValuesRef defines the repository value files prefixed with $values are read from
+type ValuesRef struct {
+    RepoURL        string `json:"repoURL"`
+    TargetRevision string `json:"targetRevision,omitempty"`
+}
+
+// ValuesFromSource defines a ConfigMap or Secret key holding Helm values.
+// Argo CD can not reference a Secret, its values are written in plain text into the ApplicationSet.
+type ValuesFromSource struct {
+    Kind     string `json:"kind"`
+    Name     string `json:"name"`
+    Key      string `json:"key,omitempty"`
+    Optional bool   `json:"optional,omitempty"`
+}
+
+// KustomizeSource defines the overrides applied to a Kustomize directory
+type KustomizeSource struct {
+    Images     []string         `json:"images,omitempty"`
+    NamePrefix string           `json:"namePrefix,omitempty"`
+    NameSuffix string           `json:"nameSuffix,omitempty"`
+    Patches    []KustomizePatch `json:"patches,omitempty"`
+}
+
+// KustomizePatch defines an inline patch and the resources it targets
+type KustomizePatch struct {
+    Patch  string                `json:"patch"`
+    Target *KustomizePatchTarget `json:"target,omitempty"`
+}
+
+// KustomizePatchTarget selects the resources a patch applies to
+type KustomizePatchTarget struct {
+    Group              string `json:"group,omitempty"`
+    Version            string `json:"version,omitempty"`
+    Kind               string `json:"kind,omitempty"`
+    Name               string `json:"name,omitempty"`
+    Namespace          string `json:"namespace,omitempty"`
+    LabelSelector      string `json:"labelSelector,omitempty"`
+    AnnotationSelector string `json:"annotationSelector,omitempty"`
+}
+
+// DirectorySource defines which plain manifests of a directory are applied
+type DirectorySource struct {
+    Recurse bool   `json:"recurse,omitempty"`
+    Include string `json:"include,omitempty"`
+    Exclude string `json:"exclude,omitempty"`
+}
+
+// ContainerRegistry defines the container registry information
+type ContainerRegistry struct {
+    Provider        string `json:"provider"`
+    ImageName       string `json:"imageName"`
+    SemanticVersion string `json:"semanticVersion"`
+}
+
+// Dependencies defines the App dependencies
+type Dependencies struct {
+    Service []map[string]string `json:"service"`
+}
+
+
+// AppStatus defines the observed state of App
+type AppStatus struct {
+    State    string    `json:"state"`
+	Message   string    `json:"message,omitempty"`
+    HealthStatus   []appv1alpha1.ApplicationCondition    `json:"healthStatus,omitempty"`
+    PreviewURLs    map[string]runtime.RawExtension     `json:"previewURLs,omitempty"`
+	ObservedGeneration int                         `json:"observedGeneration,omitempty"`
+    ApplicationSet *ApplicationSetStatus               `json:"applicationSet,omitempty"`
+    Deployment     *DeploymentStatus                   `json:"deployment,omitempty"`
+    Promotion      *PromotionStatus                    `json:"promotion,omitempty"`
+    Rollout        *RolloutStatus                      `json:"rollout,omitempty"`
+}
+
+// RolloutStatus reports the progress of the rollout of a new image tag
+type RolloutStatus struct {
+    Strategy          string      `json:"strategy"`
+    Phase             string      `json:"phase"`
+    StableTag         string      `json:"stableTag"`
+    CanaryTag         string      `json:"canaryTag"`
+    Step              int         `json:"step"`
+    Weight            int         `json:"weight"`
+    StepStarted       metav1.Time `json:"stepStarted"`
+    Message           string      `json:"message,omitempty"`
+    AbortedGeneration int64       `json:"abortedGeneration,omitempty"`
+}
+
+// DeploymentStatus reports the image tag applied to the environment and whether its Application is healthy and synced
+type DeploymentStatus struct {
+    Tag          string       `json:"tag"`
+    Healthy      bool         `json:"healthy"`
+    HealthySince *metav1.Time `json:"healthySince,omitempty"`
+    LastChecked  metav1.Time  `json:"lastChecked"`
+}
+
+// PromotionStatus reports the tag offered by the upstream App and where each tag of the pipeline runs
+type PromotionStatus struct {
+    From         string           `json:"from"`
+    CandidateTag string           `json:"candidateTag,omitempty"`
+    State        string           `json:"state"`
+    Message      string           `json:"message,omitempty"`
+    LastPromoted *metav1.Time     `json:"lastPromoted,omitempty"`
+    Pipeline     []PromotionStage `json:"pipeline,omitempty"`
+}
+
+// PromotionStage reports the tag running in one environment of the pipeline
+type PromotionStage struct {
+    App         string `json:"app"`
+    Environment string `json:"environment"`
+    Tag         string `json:"tag,omitempty"`
+    Healthy     bool   `json:"healthy"`
+}
+
+// ApplicationSetStatus reports whether the live ApplicationSet matches the one rendered from the App
+type ApplicationSetStatus struct {
+    Name         string      `json:"name"`
+    SpecHash     string      `json:"specHash"`
+    LiveSpecHash string      `json:"liveSpecHash,omitempty"`
+    InSync       bool        `json:"inSync"`
+    Diff         []string    `json:"diff,omitempty"`
+    LastChecked  metav1.Time `json:"lastChecked"`
+}
+
+
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=apps,scope=Namespaced
+
+// App is the Schema for the apps API
+type App struct {
+    metav1.TypeMeta   `json:",inline"`
+    metav1.ObjectMeta `json:"metadata,omitempty"`
+
+    Spec   AppSpec   `json:"spec,omitempty"`
+    Status AppStatus `json:"status,omitempty"`
+}
+
+
+// +kubebuilder:object:root=true
+
+// AppList contains a list of App
+type AppList struct {
+    metav1.TypeMeta `json:",inline"`
+    metav1.ListMeta `json:"metadata,omitempty"`
+    Items           []App `json:"items"`
+}
+
+
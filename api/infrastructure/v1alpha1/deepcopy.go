@@ -1,50 +1,172 @@
-package v1alpha1
-
-import "k8s.io/apimachinery/pkg/runtime"
-
-// DeepCopyInto copies all properties of this object into another object of the
-// same type that is provided as a pointer.
-func (in *Terraform) DeepCopyInto(out *Terraform) {
-	out.TypeMeta = in.TypeMeta
-	out.ObjectMeta = in.ObjectMeta
-	out.Spec = TerraformSpec{
-		Environment:       in.Spec.Environment,
-		Variables:         in.Spec.Variables,
-		Scripts:           in.Spec.Scripts,
-		PostDeploy:        in.Spec.PostDeploy,
-		ContainerRegistry: in.Spec.ContainerRegistry,
-	}
-	out.Status = TerraformStatus{
-		State:             in.Status.State,
-		Message:           in.Status.Message,
-	    PostDeployOutput:   in.Status.PostDeployOutput,
-		ObservedGeneration: in.Status.ObservedGeneration,
-		
-	}
-	
-}
-
-
-// DeepCopyObject returns a generically typed copy of an object
-func (in *Terraform) DeepCopyObject() runtime.Object {
-	out := Terraform{}
-	in.DeepCopyInto(&out)
-
-	return &out
-}
-
-// DeepCopyObject returns a generically typed copy of an object
-func (in *TerraformList) DeepCopyObject() runtime.Object {
-	out := TerraformList{}
-	out.TypeMeta = in.TypeMeta
-	out.ListMeta = in.ListMeta
-
-	if in.Items != nil {
-		out.Items = make([]Terraform, len(in.Items)) 
-		for i := range in.Items {
-			in.Items[i].DeepCopyInto(&out.Items[i])
-		}
-	}
-
-	return &out
-}
+package v1alpha1
+
+import (
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto copies all properties of this object into another object of the
+// same type that is provided as a pointer.
+func (in *Terraform) DeepCopyInto(out *Terraform) {
+	out.TypeMeta = in.TypeMeta
+	out.ObjectMeta = in.ObjectMeta
+	out.Spec = TerraformSpec{
+		Environment:       in.Spec.Environment,
+		Variables:         in.Spec.Variables,
+		Scripts:           in.Spec.Scripts,
+		PostDeploy:        in.Spec.PostDeploy,
+		ContainerRegistry: in.Spec.ContainerRegistry,
+		Approval:          in.Spec.Approval,
+		DriftDetection:    in.Spec.DriftDetection,
+		RunHistoryLimit:   in.Spec.RunHistoryLimit,
+		Runner:            in.Spec.Runner,
+		Cache:             in.Spec.Cache,
+		ServiceAccountName: in.Spec.ServiceAccountName,
+		RBAC:              in.Spec.RBAC,
+		Engine:            in.Spec.Engine,
+		ClusterSecret:     in.Spec.ClusterSecret,
+		OutputsSecretName: in.Spec.OutputsSecretName,
+		DeletionPolicy:    in.Spec.DeletionPolicy,
+		Schedule:          in.Spec.Schedule,
+	}
+	out.Spec.Runner.PodTemplate = in.Spec.Runner.PodTemplate.DeepCopy()
+	if in.Spec.Module != nil {
+		module := *in.Spec.Module
+		out.Spec.Module = &module
+	}
+	if in.Spec.RBAC.Rules != nil {
+		out.Spec.RBAC.Rules = make([]rbacv1.PolicyRule, len(in.Spec.RBAC.Rules))
+		for i := range in.Spec.RBAC.Rules {
+			in.Spec.RBAC.Rules[i].DeepCopyInto(&out.Spec.RBAC.Rules[i])
+		}
+	}
+	if in.Spec.RBAC.ClusterRules != nil {
+		out.Spec.RBAC.ClusterRules = make([]rbacv1.PolicyRule, len(in.Spec.RBAC.ClusterRules))
+		for i := range in.Spec.RBAC.ClusterRules {
+			in.Spec.RBAC.ClusterRules[i].DeepCopyInto(&out.Spec.RBAC.ClusterRules[i])
+		}
+	}
+	if in.Spec.VariablesFrom != nil {
+		out.Spec.VariablesFrom = make([]VariableFrom, len(in.Spec.VariablesFrom))
+		copy(out.Spec.VariablesFrom, in.Spec.VariablesFrom)
+	}
+	if in.Spec.Timeout != nil {
+		timeout := *in.Spec.Timeout
+		out.Spec.Timeout = &timeout
+	}
+	if in.Spec.DependsOn != nil {
+		out.Spec.DependsOn = make([]string, len(in.Spec.DependsOn))
+		copy(out.Spec.DependsOn, in.Spec.DependsOn)
+	}
+	if in.Spec.MaintenanceWindows != nil {
+		out.Spec.MaintenanceWindows = make([]TimeWindow, len(in.Spec.MaintenanceWindows))
+		copy(out.Spec.MaintenanceWindows, in.Spec.MaintenanceWindows)
+	}
+	if in.Spec.FreezeWindows != nil {
+		out.Spec.FreezeWindows = make([]TimeWindow, len(in.Spec.FreezeWindows))
+		copy(out.Spec.FreezeWindows, in.Spec.FreezeWindows)
+	}
+	if in.Spec.ArgoCluster != nil {
+		argoCluster := *in.Spec.ArgoCluster
+		if in.Spec.ArgoCluster.AWSAuth != nil {
+			awsAuth := *in.Spec.ArgoCluster.AWSAuth
+			argoCluster.AWSAuth = &awsAuth
+		}
+		if in.Spec.ArgoCluster.ExecProvider != nil {
+			exec := *in.Spec.ArgoCluster.ExecProvider
+			exec.Args = append([]string(nil), in.Spec.ArgoCluster.ExecProvider.Args...)
+			if in.Spec.ArgoCluster.ExecProvider.Env != nil {
+				exec.Env = make(map[string]string, len(in.Spec.ArgoCluster.ExecProvider.Env))
+				for key, value := range in.Spec.ArgoCluster.ExecProvider.Env {
+					exec.Env[key] = value
+				}
+			}
+			argoCluster.ExecProvider = &exec
+		}
+		out.Spec.ArgoCluster = &argoCluster
+	}
+	if in.Spec.SensitiveOutputs != nil {
+		out.Spec.SensitiveOutputs = make([]string, len(in.Spec.SensitiveOutputs))
+		copy(out.Spec.SensitiveOutputs, in.Spec.SensitiveOutputs)
+	}
+	out.Status = TerraformStatus{
+		State:             in.Status.State,
+		Message:           in.Status.Message,
+	    PostDeployOutput:   in.Status.PostDeployOutput,
+		ObservedGeneration: in.Status.ObservedGeneration,
+		DependencyHash:     in.Status.DependencyHash,
+		LogTail:            in.Status.LogTail,
+		QueuePosition:      in.Status.QueuePosition,
+		
+	}
+	out.Status.Plan = in.Status.Plan.DeepCopy()
+	if in.Status.Drift != nil {
+		drift := *in.Status.Drift
+		out.Status.Drift = &drift
+	}
+	if in.Status.Conditions != nil {
+		out.Status.Conditions = make([]metav1.Condition, len(in.Status.Conditions))
+		copy(out.Status.Conditions, in.Status.Conditions)
+	}
+	if in.Status.Runs != nil {
+		out.Status.Runs = make([]TerraformRun, len(in.Status.Runs))
+		copy(out.Status.Runs, in.Status.Runs)
+	}
+	if in.Status.OutputsSecretRef != nil {
+		ref := *in.Status.OutputsSecretRef
+		ref.Keys = append([]string(nil), in.Status.OutputsSecretRef.Keys...)
+		out.Status.OutputsSecretRef = &ref
+	}
+	if in.Status.PendingChange != nil {
+		pending := *in.Status.PendingChange
+		out.Status.PendingChange = &pending
+	}
+	if in.Status.ArgoCluster != nil {
+		argoCluster := *in.Status.ArgoCluster
+		out.Status.ArgoCluster = &argoCluster
+	}
+	if in.Status.NextScheduledRun != nil {
+		next := *in.Status.NextScheduledRun
+		out.Status.NextScheduledRun = &next
+	}
+	
+}
+
+
+// DeepCopy returns a copy of the plan that shares nothing with it
+func (in *PlanStatus) DeepCopy() *PlanStatus {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	if in.Resources != nil {
+		out.Resources = make([]string, len(in.Resources))
+		copy(out.Resources, in.Resources)
+	}
+	return &out
+}
+
+// DeepCopyObject returns a generically typed copy of an object
+func (in *Terraform) DeepCopyObject() runtime.Object {
+	out := Terraform{}
+	in.DeepCopyInto(&out)
+
+	return &out
+}
+
+// DeepCopyObject returns a generically typed copy of an object
+func (in *TerraformList) DeepCopyObject() runtime.Object {
+	out := TerraformList{}
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+
+	if in.Items != nil {
+		out.Items = make([]Terraform, len(in.Items)) 
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+
+	return &out
+}
@@ -1,78 +1,261 @@
-package v1alpha1
-
-import (
-    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-    "k8s.io/apimachinery/pkg/runtime"
-    
-
-)
-
-// +groupName=alustan.io
-
-// TerraformSpec defines the desired state of Terraform
-type TerraformSpec struct {
-    Environment      string            `json:"environment"`
-    Variables         map[string]string `json:"variables"`
-    Scripts           Scripts           `json:"scripts"`
-    PostDeploy        PostDeploy        `json:"postDeploy"`
-    ContainerRegistry ContainerRegistry `json:"containerRegistry"`
-}
-
-// Scripts defines the deployment and destruction scripts
-type Scripts struct {
-    Deploy  string `json:"deploy"`
-    Destroy string `json:"destroy"`
-}
-
-// PostDeploy defines the post-deployment actions
-type PostDeploy struct {
-    Script string            `json:"script"`
-    Args   map[string]string `json:"args"`
-}
-
-// ContainerRegistry defines the container registry settings
-type ContainerRegistry struct {
-    Provider        string `json:"provider"`
-    ImageName       string `json:"imageName"`
-    SemanticVersion string `json:"semanticVersion"`
-}
-
-// TerraformStatus defines the observed state of Terraform
-type TerraformStatus struct {
-	State            string                           `json:"state"`
-	Message          string                           `json:"message"`
-	PostDeployOutput map[string]runtime.RawExtension  `json:"postDeployOutput,omitempty"`
-	ObservedGeneration int                         `json:"observedGeneration,omitempty"`
-}
-
-
-// +kubebuilder:object:root=true
-// +kubebuilder:subresource:status
-// +kubebuilder:resource:path=terraforms,scope=Namespaced
-
-// Terraform is the Schema for the terraforms API
-type Terraform struct {
-    metav1.TypeMeta   `json:",inline"`
-    metav1.ObjectMeta `json:"metadata,omitempty"`
-
-    Spec   TerraformSpec  `json:"spec,omitempty"`
-    Status TerraformStatus `json:"status,omitempty"`
-}
-
-// +kubebuilder:object:root=true
-
-// TerraformList contains a list of Terraform
-type TerraformList struct {
-    metav1.TypeMeta `json:",inline"`
-    metav1.ListMeta `json:"metadata,omitempty"`
-    Items           []Terraform `json:"items"`
-}
-
-
-
-
-
-
-
-
-
+package v1alpha1
+
+import (
+    corev1 "k8s.io/api/core/v1"
+    rbacv1 "k8s.io/api/rbac/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    
+
+)
+
+// +groupName=alustan.io
+
+// TerraformSpec defines the desired state of Terraform
+type TerraformSpec struct {
+    Environment      string            `json:"environment"`
+    Variables         map[string]string `json:"variables"`
+    VariablesFrom     []VariableFrom    `json:"variablesFrom,omitempty"`
+    Scripts           Scripts           `json:"scripts"`
+    PostDeploy        PostDeploy        `json:"postDeploy"`
+    ContainerRegistry ContainerRegistry `json:"containerRegistry"`
+    Approval          Approval          `json:"approval,omitempty"`
+    DriftDetection    DriftDetection    `json:"driftDetection,omitempty"`
+    RunHistoryLimit   int               `json:"runHistoryLimit,omitempty"`
+    Runner            RunnerSpec        `json:"runner,omitempty"`
+    Cache             Cache             `json:"cache,omitempty"`
+    ServiceAccountName string           `json:"serviceAccountName,omitempty"`
+    RBAC              RBAC              `json:"rbac,omitempty"`
+    Module            *Module           `json:"module,omitempty"`
+    Engine            string            `json:"engine,omitempty"`
+    ClusterSecret     ClusterSecret     `json:"clusterSecret,omitempty"`
+    SensitiveOutputs  []string          `json:"sensitiveOutputs,omitempty"`
+    OutputsSecretName string            `json:"outputsSecretName,omitempty"`
+    DependsOn         []string          `json:"dependsOn,omitempty"`
+    Timeout           *metav1.Duration  `json:"timeout,omitempty"`
+    DeletionPolicy    string            `json:"deletionPolicy,omitempty"`
+    Schedule          string            `json:"schedule,omitempty"`
+    MaintenanceWindows []TimeWindow     `json:"maintenanceWindows,omitempty"`
+    FreezeWindows     []TimeWindow      `json:"freezeWindows,omitempty"`
+    ArgoCluster       *ArgoCluster      `json:"argoCluster,omitempty"`
+}
+
+// ArgoCluster maps outputs to the Argo CD cluster the Apps of the environment deploy to
+type ArgoCluster struct {
+    Name              string             `json:"name,omitempty"`
+    ServerOutput      string             `json:"serverOutput"`
+    CADataOutput      string             `json:"caDataOutput,omitempty"`
+    BearerTokenOutput string             `json:"bearerTokenOutput,omitempty"`
+    AWSAuth           *ArgoClusterAWSAuth `json:"awsAuth,omitempty"`
+    ExecProvider      *ArgoClusterExec   `json:"execProvider,omitempty"`
+}
+
+// ArgoClusterAWSAuth maps outputs to the IAM authentication of an EKS cluster
+type ArgoClusterAWSAuth struct {
+    ClusterNameOutput string `json:"clusterNameOutput"`
+    RoleARNOutput     string `json:"roleARNOutput,omitempty"`
+}
+
+// ArgoClusterExec defines the exec credential plugin Argo CD runs to authenticate
+type ArgoClusterExec struct {
+    Command     string            `json:"command"`
+    Args        []string          `json:"args,omitempty"`
+    Env         map[string]string `json:"env,omitempty"`
+    APIVersion  string            `json:"apiVersion"`
+    InstallHint string            `json:"installHint,omitempty"`
+}
+
+// TimeWindow defines a recurring window opening on a cron schedule for a fixed duration
+type TimeWindow struct {
+    Schedule string          `json:"schedule"`
+    Duration metav1.Duration `json:"duration"`
+}
+
+// VariableFrom defines a variable whose value is read from a Secret or ConfigMap key
+type VariableFrom struct {
+    Name      string         `json:"name"`
+    ValueFrom VariableSource `json:"valueFrom"`
+}
+
+// VariableSource selects the Secret or ConfigMap key holding a variable value
+type VariableSource struct {
+    SecretKeyRef    *corev1.SecretKeySelector    `json:"secretKeyRef,omitempty"`
+    ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+}
+
+// Scripts defines the deployment and destruction scripts
+type Scripts struct {
+    Deploy  string `json:"deploy"`
+    Destroy string `json:"destroy"`
+    Plan    string `json:"plan,omitempty"`
+}
+
+// Approval defines the manual sign-off required between plan and apply
+type Approval struct {
+    Required     bool   `json:"required,omitempty"`
+    ApprovedPlan string `json:"approvedPlan,omitempty"`
+}
+
+// PostDeploy defines the post-deployment actions
+type PostDeploy struct {
+    Script string            `json:"script"`
+    Args   map[string]string `json:"args"`
+}
+
+// ContainerRegistry defines the container registry settings
+type ContainerRegistry struct {
+    Provider        string `json:"provider"`
+    ImageName       string `json:"imageName"`
+    SemanticVersion string `json:"semanticVersion"`
+}
+
+// DriftDetection defines the scheduled plan-only runs that detect out of band changes
+type DriftDetection struct {
+    Enabled       bool `json:"enabled,omitempty"`
+    AutoRemediate bool `json:"autoRemediate,omitempty"`
+}
+
+// RunnerSpec defines the limits of the Jobs executing the scripts
+type RunnerSpec struct {
+    BackoffLimit            *int32 `json:"backoffLimit,omitempty"`
+    ActiveDeadlineSeconds   *int64 `json:"activeDeadlineSeconds,omitempty"`
+    TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+    // PodTemplate is a partial core/v1 PodTemplateSpec strategically merged over the runner pod.
+    // It is kept raw so that only the fields actually set override the defaults
+    PodTemplate *runtime.RawExtension `json:"podTemplate,omitempty"`
+}
+
+// Cache defines the persistent volume holding the provider plugin cache and .terraform directory
+type Cache struct {
+    Enabled          bool   `json:"enabled,omitempty"`
+    ClaimName        string `json:"claimName,omitempty"`
+    Size             string `json:"size,omitempty"`
+    StorageClassName string `json:"storageClassName,omitempty"`
+    AccessMode       string `json:"accessMode,omitempty"`
+}
+
+// RBAC defines the permissions and annotations of the generated runner ServiceAccount
+type RBAC struct {
+    Rules                     []rbacv1.PolicyRule `json:"rules,omitempty"`
+    ClusterRules              []rbacv1.PolicyRule `json:"clusterRules,omitempty"`
+    ServiceAccountAnnotations map[string]string   `json:"serviceAccountAnnotations,omitempty"`
+}
+
+// Module defines the IaC module or program the selected engine runs natively in a stock image
+type Module struct {
+    Source        string            `json:"source"`
+    Path          string            `json:"path,omitempty"`
+    BackendConfig map[string]string `json:"backendConfig,omitempty"`
+    Workspace     string            `json:"workspace,omitempty"`
+    Version       string            `json:"version,omitempty"`
+    Image         string            `json:"image,omitempty"`
+}
+
+// ClusterSecret defines how outputs are published to the alustan cluster secret read by Apps
+type ClusterSecret struct {
+    Disabled   bool              `json:"disabled,omitempty"`
+    KeyMapping map[string]string `json:"keyMapping,omitempty"`
+}
+
+// TerraformStatus defines the observed state of Terraform
+type TerraformStatus struct {
+	State            string                           `json:"state"`
+	Message          string                           `json:"message"`
+	PostDeployOutput map[string]runtime.RawExtension  `json:"postDeployOutput,omitempty"`
+	ObservedGeneration int                         `json:"observedGeneration,omitempty"`
+	Plan             *PlanStatus                      `json:"plan,omitempty"`
+	Drift            *DriftStatus                     `json:"drift,omitempty"`
+	Conditions       []metav1.Condition               `json:"conditions,omitempty"`
+	Runs             []TerraformRun                   `json:"runs,omitempty"`
+	OutputsSecretRef *OutputsSecretRef                `json:"outputsSecretRef,omitempty"`
+	DependencyHash   string                           `json:"dependencyHash,omitempty"`
+	LogTail          string                           `json:"logTail,omitempty"`
+	QueuePosition    int                              `json:"queuePosition,omitempty"`
+	PendingChange    *PendingChange                   `json:"pendingChange,omitempty"`
+	NextScheduledRun *metav1.Time                     `json:"nextScheduledRun,omitempty"`
+	ArgoCluster      *ArgoClusterStatus               `json:"argoCluster,omitempty"`
+}
+
+// ArgoClusterStatus identifies the Argo CD cluster registered from the outputs
+type ArgoClusterStatus struct {
+	Name   string `json:"name"`
+	Server string `json:"server"`
+}
+
+// PendingChange describes an apply held back until an allowed window opens
+type PendingChange struct {
+	Generation       int64       `json:"generation"`
+	Scheduled        bool        `json:"scheduled,omitempty"`
+	Reason           string      `json:"reason"`
+	NextEligibleTime metav1.Time `json:"nextEligibleTime"`
+}
+
+// OutputsSecretRef points at the Secret holding the sensitive outputs left out of postDeployOutput
+type OutputsSecretRef struct {
+	Name string   `json:"name"`
+	Keys []string `json:"keys,omitempty"`
+}
+
+// TerraformRun records a single execution of a runner Job
+type TerraformRun struct {
+	Phase      string       `json:"phase"`
+	Image      string       `json:"image"`
+	Generation int64        `json:"generation"`
+	StartTime  metav1.Time  `json:"startTime"`
+	EndTime    *metav1.Time `json:"endTime,omitempty"`
+	ExitCode   *int32       `json:"exitCode,omitempty"`
+	LogsRef    string       `json:"logsRef"`
+	Cancelled  bool         `json:"cancelled,omitempty"`
+}
+
+// DriftStatus holds the outcome of the latest drift check
+type DriftStatus struct {
+	LastChecked metav1.Time `json:"lastChecked"`
+	Resources   []string    `json:"resources,omitempty"`
+}
+
+// PlanStatus holds the summary of the latest saved plan
+type PlanStatus struct {
+	ID        string      `json:"id"`
+	SpecHash  string      `json:"specHash"`
+	Image     string      `json:"image"`
+	Add       int         `json:"add"`
+	Change    int         `json:"change"`
+	Destroy   int         `json:"destroy"`
+	Summary   string      `json:"summary"`
+	Resources []string    `json:"resources,omitempty"`
+	Approved  bool        `json:"approved"`
+	PlannedAt metav1.Time `json:"plannedAt,omitempty"`
+}
+
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=terraforms,scope=Namespaced
+
+// Terraform is the Schema for the terraforms API
+type Terraform struct {
+    metav1.TypeMeta   `json:",inline"`
+    metav1.ObjectMeta `json:"metadata,omitempty"`
+
+    Spec   TerraformSpec  `json:"spec,omitempty"`
+    Status TerraformStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// TerraformList contains a list of Terraform
+type TerraformList struct {
+    metav1.TypeMeta `json:",inline"`
+    metav1.ListMeta `json:"metadata,omitempty"`
+    Items           []Terraform `json:"items"`
+}
+
+
+
+
+
+
+
+
+
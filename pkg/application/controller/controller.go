@@ -1,725 +1,985 @@
-package controller
-
-import (
-	"context"
-	"sync"
-	"fmt"
-	"strings"
-	"time"
-	
-	"bytes"
-   
-    "encoding/json"
-    "net/http"
-	"io"
-
-	
-	
-    "go.uber.org/zap"
-	"k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/runtime/schema"
-	
-	
-	
-	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/tools/leaderelection"
-	"k8s.io/client-go/tools/leaderelection/resourcelock"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"  
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	
-	"k8s.io/client-go/util/workqueue"
-	"k8s.io/client-go/dynamic/dynamicinformer"
-	apiclient "github.com/argoproj/argo-cd/v2/pkg/apiclient"
-	appv1alpha1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
-	
-	applicationsetpkg "github.com/argoproj/argo-cd/v2/pkg/apiclient/applicationset"
-	applicationpkg "github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
-
-	
-	
-	
-
-	"github.com/alustan/alustan/pkg/application/registry"
-	"github.com/alustan/alustan/api/app/v1alpha1"
-	"github.com/alustan/alustan/pkg/application/service"
-	"github.com/alustan/alustan/pkg/util"
-	"github.com/alustan/alustan/pkg/application/listers"
-	Kubernetespkg "github.com/alustan/alustan/pkg/application/kubernetes"
-	"github.com/alustan/alustan/pkg/checkargo"
-	
-)
-
-var (
-    token     string
-    tokenLock sync.Mutex
-)
-
-
-type Controller struct {
-	Clientset        kubernetes.Interface
-	dynClient        dynamic.Interface
-	syncInterval     time.Duration
-	lastSyncTime     time.Time
-	workqueue        workqueue.RateLimitingInterface
-	appLister    listers.AppLister
-	informerFactory  dynamicinformer.DynamicSharedInformerFactory // Shared informer factory for App resources
-	informer         cache.SharedIndexInformer                    // Informer for App resources
-	logger           *zap.SugaredLogger
-	mu               sync.Mutex
-	numWorkers       int
-	maxWorkers       int
-	workerStopCh  chan struct{}
-    managerStopCh chan struct{}
-	argoClient   apiclient.Client
-	appSetClient   applicationsetpkg.ApplicationSetServiceClient
-	appClient    applicationpkg.ApplicationServiceClient
-	
-	
-	
-}
-
-
-// NewController initializes a new controller
-func NewController(clientset kubernetes.Interface, dynClient dynamic.Interface, syncInterval time.Duration, logger *zap.SugaredLogger) *Controller {
-	ctrl := &Controller{
-		Clientset:       clientset,
-		dynClient:       dynClient,
-		syncInterval:    syncInterval,
-		lastSyncTime:    time.Now().Add(-syncInterval), // Initialize to allow immediate first run
-		workqueue:       workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "apps"),
-		informerFactory: dynamicinformer.NewDynamicSharedInformerFactory(dynClient, syncInterval),
-		logger:          logger,
-		numWorkers:      0,
-		maxWorkers:      5,
-		workerStopCh:    make(chan struct{}),
-		managerStopCh:   make(chan struct{}),
-		
-	}
-
-	// Initialize informer
-	ctrl.initInformer()
-
-	return ctrl
-}
-
-
-// NewInClusterController initializes a new controller for in-cluster execution
-func NewInClusterController(syncInterval time.Duration, logger *zap.SugaredLogger) *Controller {
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		logger.Fatalf("Error creating in-cluster config: %v", err)
-	}
-
-	config.QPS = 100.0
-	config.Burst = 200
-
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		logger.Fatalf("Error creating Kubernetes clientset: %v", err)
-	}
-
-	// Check if ArgoCD is installed and ready
-	installed, ready, err := checkargo.IsArgoCDInstalledAndReady(logger, clientset)
-	if err != nil {
-		logger.Fatalf("Error checking ArgoCD installation status: %v", err)
-	}
-
-	if !installed {
-		logger.Fatalf("ArgoCD is not installed in the cluster")
-	}
-
-	if !ready {
-		logger.Fatalf("ArgoCD components are installed but not ready")
-	}
-
-	dynClient, err := dynamic.NewForConfig(config)
-	if err != nil {
-		logger.Fatalf("Error creating dynamic Kubernetes client: %v", err)
-	}
-
-	return NewController(clientset, dynClient, syncInterval, logger)
-}
-
-func (c *Controller) initInformer() {
-	// Define the GroupVersionResource for the custom resource
-	gvr := schema.GroupVersionResource{
-		Group:    "alustan.io",
-		Version:  "v1alpha1",
-		Resource: "apps",
-	}
-
-	// Get the informer and error returned by ForResource
-	informer := c.informerFactory.ForResource(gvr)
-	c.informer = informer.Informer()
-
-	// Set the lister for the custom resource
-	c.appLister = listers.NewAppLister(c.informer.GetIndexer())
-
-	// Add event handlers to the informer
-	c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc:    c.handleAddApp,
-		UpdateFunc: c.handleUpdateApp,
-		DeleteFunc: c.handleDeleteApp,
-	})
-}
-
-
-func (c *Controller) setupInformer(stopCh <-chan struct{}) {
-	if c.informer == nil {
-		c.logger.Fatal("informer is nil, ensure initInformer is called before setupInformer")
-	}
-
-	// Start the informer
-	go c.informer.Run(stopCh)
-
-	// Wait for the informer's cache to sync
-	if !cache.WaitForCacheSync(stopCh, c.informer.HasSynced) {
-		c.logger.Error("timed out waiting for caches to sync")
-		return
-	}
-}
-
-func (c *Controller) handleAddApp(obj interface{}) {
-	key, err := cache.MetaNamespaceKeyFunc(obj)
-	if err != nil {
-		c.logger.Errorf("couldn't get key for object %+v: %v", obj, err)
-		return
-	}
-	c.enqueue(key)
-}
-
-func (c *Controller) handleUpdateApp(old, new interface{}) {
-	key, err := cache.MetaNamespaceKeyFunc(new)
-	if err != nil {
-		c.logger.Errorf("couldn't get key for object %+v: %v", new, err)
-		return
-	}
-	c.enqueue(key)
-}
-
-func (c *Controller) handleDeleteApp(obj interface{}) {
-	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
-	if err != nil {
-		c.logger.Errorf("couldn't get key for object %+v: %v", obj, err)
-		return
-	}
-	c.enqueue(key)
-}
-
-func (c *Controller) enqueue(key string) {
-	c.workqueue.AddRateLimited(key)
-}
-
-
-func (c *Controller) RunLeader(stopCh <-chan struct{}) {
-	defer c.logger.Sync()
-
-	c.logger.Info("Starting App controller")
-
-	// Setup informers and listers
-	c.setupInformer(stopCh)
-
-	// Leader election configuration
-	id := util.GetUniqueID()
-	rl, err := resourcelock.New(
-		resourcelock.LeasesResourceLock,
-		"alustan",
-		"app-controller-lock",
-		c.Clientset.CoreV1(),
-		c.Clientset.CoordinationV1(),
-		resourcelock.ResourceLockConfig{
-			Identity: id,
-		},
-	)
-	if err != nil {
-		c.logger.Fatalf("Failed to create resource lock: %v", err)
-	}
-
-	leaderelection.RunOrDie(context.TODO(), leaderelection.LeaderElectionConfig{
-		Lock:          rl,
-		LeaseDuration: 30 * time.Second,
-        RenewDeadline: 20 * time.Second,
-        RetryPeriod:   5 * time.Second,
-		Callbacks: leaderelection.LeaderCallbacks{
-			OnStartedLeading: func(ctx context.Context) {
-				
-
-				// Authenticate and create ArgoCD client
-			 password, err := getAdminPassword(c.Clientset)
-			 if err != nil {
-				 c.logger.Fatalf("Failed to get admin password: %v", err)
-			 }
-
-			 authToken, err := GetAuthToken(c, password)
-			 if err != nil {
-				 c.logger.Fatalf("Failed to get auth token: %v", err)
-			 }
-
-			 err = refreshClients(c, authToken)
-			 if err != nil {
-				 c.logger.Fatalf("Failed to refresh clients: %v", err)
-			 }
-		
-			 c.logger.Info("Successfully created ArgoCD client")
-             c.logger.Infof("Successfully created ApplicationSet client")
-			 c.logger.Infof("Successfully created Applicationclient")
-			 c.logger.Info("App controller successfuly instantiated!!!")
-
-				// Start processing items
-				go c.manageWorkers()
-			},
-			OnStoppedLeading: func() {
-				c.logger.Infof("Pod %s lost leadership", id)
-				// Stop processing items
-				close(c.workerStopCh)  // Stop all individual runWorker functions
-				close(c.managerStopCh) // Stop the manageWorkers function
-				c.workqueue.ShutDown()
-			},
-			OnNewLeader: func(identity string) {
-				if identity == id {
-					c.logger.Infof("I am the new leader")
-				} else {
-					c.logger.Infof("New leader elected: %s", identity)
-				}
-			},
-		},
-		ReleaseOnCancel: true,
-	})
-}
-
-func (c *Controller) manageWorkers() {
-	for {
-		select {
-		case <-c.managerStopCh:
-		  return // Stops the manageWorkers loop
-        default:
-			queueLength := c.workqueue.Len()
-
-			c.mu.Lock()
-			currentWorkers := c.numWorkers
-			c.mu.Unlock()
-
-			// Calculate the desired number of workers based on the queue length
-			// spawn a new runworker routine for every queue length greater than 50 vice versa
-			desiredWorkers := (queueLength / 50) + 1
-			if desiredWorkers > c.maxWorkers {
-				desiredWorkers = c.maxWorkers
-			}
-
-			// Ensure at least one worker is running
-			if desiredWorkers < 1 {
-				desiredWorkers = 1
-			}
-
-			// Increase workers if needed
-			if currentWorkers < desiredWorkers {
-				for i := currentWorkers; i < desiredWorkers; i++ {
-					go c.runWorker()
-					c.mu.Lock()
-					c.numWorkers++
-					c.mu.Unlock()
-				}
-			}
-
-			// Decrease workers if needed, but ensure at least one worker is running
-			if currentWorkers > desiredWorkers {
-				for i := currentWorkers; i > desiredWorkers && i > 1; i-- {
-					c.mu.Lock()
-					c.numWorkers--
-					c.mu.Unlock()
-					c.workerStopCh <- struct{}{} // Signal a worker to stop
-
-				}
-			}
-
-			time.Sleep(15 * time.Second)
-		}
-	}
-}
-
-
-func (c *Controller) runWorker() {
-    for {
-        select {
-        case <-c.workerStopCh:
-            return // Stops the individual worker
-        default:
-            if !c.processNextWorkItem() {
-                return
-            }
-        }
-    }
-}
-
-
-
-func (c *Controller) processNextWorkItem() bool {
-	obj, shutdown := c.workqueue.Get()
-	if shutdown {
-		return false
-	}
-
-	err := func(obj interface{}) error {
-		defer c.workqueue.Done(obj)
-		key, ok := obj.(string)
-		if !ok {
-			c.workqueue.Forget(obj)
-			c.logger.Errorf("expected string in workqueue but got %T", obj)
-			return nil
-		}
-
-		namespace, name, err := cache.SplitMetaNamespaceKey(key)
-		if err != nil {
-			c.workqueue.Forget(obj)
-			c.logger.Errorf("invalid resource key: %s", key)
-			return nil
-		}
-
-		// Get the actual resource using the lister
-		appObject, err := c.appLister.App(namespace).Get(name)
-		if err != nil {
-		    // Check if the error message contains "not found"
-			if strings.Contains(err.Error(), "not found") {
-				c.workqueue.Forget(obj)
-				c.logger.Infof("resource %s/%s no longer exists", namespace, name)
-				return nil
-			}
-
-			// For other errors, decide whether to requeue or not
-			if errors.IsInternalError(err) || errors.IsServerTimeout(err) {
-				// These are considered transient errors, requeue the item
-				c.workqueue.AddRateLimited(key)
-				c.logger.Errorf("transient error fetching resource. requeing!! %s: %v", key, err)
-				return fmt.Errorf("transient error fetching resource. requeing!! %s: %v", key, err)
-			} else {
-				// Non-transient errors, do not requeue the item
-				c.workqueue.Forget(obj)
-				c.logger.Errorf("non-transient error fetching resource %s: %v", key, err)
-				return fmt.Errorf("non-transient error fetching resource %s: %v", key, err)
-			}
-		}
-
-		appObj := appObject.DeepCopyObject()
-
-		// Convert to *v1alpha1.App
-		unstructuredObj, ok := appObj.(*unstructured.Unstructured)
-		if !ok {
-			c.workqueue.Forget(obj)
-			c.logger.Errorf("expected *unstructured.Unstructured but got %T", appObj)
-			return nil
-		}
-		app := &v1alpha1.App{}
-		err = runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredObj.Object, app)
-		if err != nil {
-			c.workqueue.Forget(obj)
-			c.logger.Errorf("error converting unstructured object to *v1alpha1.App: %v", err)
-			return nil
-		}
-
-		// Retrieve generation information from status
-		generation := app.GetGeneration()
-		observedGeneration := app.Status.ObservedGeneration
-
-		// Convert generation to int if necessary
-		gen := int(generation)
-
-		if gen > observedGeneration {
-			// Perform synchronization and update observed generation
-			finalStatus, err := c.handleSyncRequest(c.appSetClient,c.appClient,app)
-			if finalStatus.Message == "Destroy completed successfully" {
-               return nil
-			}
-			if err != nil {
-				finalStatus.State = "Error"
-				finalStatus.Message = err.Error()
-				c.workqueue.AddRateLimited(key)
-				c.logger.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
-				return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
-			}
-
-			finalStatus.ObservedGeneration = gen
-			updateErr := c.updateStatus(app, finalStatus)
-			if updateErr != nil {
-				c.logger.Infof("Failed to update status for %s: %v", key, updateErr)
-				c.workqueue.AddRateLimited(key)
-				return updateErr
-			}
-		}
-
-		c.workqueue.Forget(obj)
-		return nil
-	}(obj)
-
-	if err != nil {
-		c.logger.Error(err)
-		return true
-	}
-
-	return true
-}
-
-func (c *Controller) handleSyncRequest(appSetClient applicationsetpkg.ApplicationSetServiceClient, appClient applicationpkg.ApplicationServiceClient,observed *v1alpha1.App) (v1alpha1.AppStatus, error) {
-    
-    commonStatus := v1alpha1.AppStatus{
-        State:   "Progressing",
-        Message: "Starting processing",
-    }
-
-    // Add finalizer if not already present
-    err := Kubernetespkg.AddFinalizer(c.logger, c.dynClient, observed.ObjectMeta.Name, observed.ObjectMeta.Namespace)
-    if err != nil {
-        c.logger.Errorf("Failed to add finalizer for %s/%s: %v", observed.ObjectMeta.Namespace, observed.ObjectMeta.Name, err)
-        commonStatus.State = "Error"
-        commonStatus.Message = fmt.Sprintf("Failed to add finalizer: %v", err)
-        return commonStatus, err
-    }
-
-    finalizing := false
-    // Check if the resource is being deleted
-    if observed.ObjectMeta.DeletionTimestamp != nil {
-        finalizing = true
-    }
-
-    var latestTag string
-    if observed.Spec.PreviewEnvironment.Enabled {
-        latestTag = "{{.branch}}-{{.number}}"
-    } else {
-        var registryStatus v1alpha1.AppStatus
-        latestTag, registryStatus = registry.HandleContainerRegistry(c.logger, c.Clientset, observed)
-        commonStatus = mergeStatuses(commonStatus, registryStatus)
-        if registryStatus.State == "Error" {
-            c.logger.Errorf("Error getting tagged image name: %v", registryStatus.Message)
-            return commonStatus, fmt.Errorf("error getting tagged image name")
-        }
-
-        taggedImageName := fmt.Sprintf("%s:%s", observed.Spec.ContainerRegistry.ImageName, latestTag)
-        c.logger.Infof("taggedImageName: %v", taggedImageName)
-    }
-
-    c.logger.Infof("latestTag: %v", latestTag)
-
-    
-    // Handle RunService and process its status and error
-    runServiceStatus, runServiceErr := service.RunService(c.logger, c.Clientset, c.dynClient, appSetClient, appClient, observed, latestTag, finalizing)
-    commonStatus = mergeStatuses(commonStatus, runServiceStatus)
-    if runServiceErr != nil {
-        c.logger.Errorf("Error running service: %v", runServiceErr)
-        return commonStatus, fmt.Errorf("error running service: %v", runServiceErr)
-    }
-
-    return commonStatus, nil
-}
-
-
-
-
-// Define the helper function to check if HealthStatus is empty
-func isEmptyApplicationStatus(conditions []appv1alpha1.ApplicationCondition ) bool {
-    return len(conditions) == 0
-}
- 
-func mergeStatuses(baseStatus, newStatus v1alpha1.AppStatus) v1alpha1.AppStatus {
-    if newStatus.State != "" {
-        baseStatus.State = newStatus.State
-    }
-    if newStatus.Message != "" {
-        baseStatus.Message = newStatus.Message
-    }
-    
-    if !isEmptyApplicationStatus(newStatus.HealthStatus) {
-        baseStatus.HealthStatus = newStatus.HealthStatus
-    }
-
-    if newStatus.PreviewURLs != nil {
-        baseStatus.PreviewURLs = newStatus.PreviewURLs
-    }
-   
-    return baseStatus
-}
-
-
-func (c *Controller) updateStatus(observed *v1alpha1.App, status v1alpha1.AppStatus) error {
-	err := Kubernetespkg.UpdateStatus(c.logger, c.dynClient, observed.ObjectMeta.Name, observed.ObjectMeta.Namespace, status)
-	
-	if err != nil {
-		c.logger.Errorf("Failed to update status for %s/%s: %v", observed.ObjectMeta.Namespace, observed.ObjectMeta.Name, err)
-		return err
-	}
-	return nil
-
-}
-
-func getAdminPassword(clientset kubernetes.Interface) (string, error) {
-    namespace := "argocd"
-    secretName := "argocd-initial-admin-secret"
-
-    // Retrieve the secret from Kubernetes
-    secret, err := clientset.CoreV1().Secrets(namespace).Get(context.TODO(), secretName, metav1.GetOptions{})
-    if err != nil {
-        return "", fmt.Errorf("failed to get secret: %v", err)
-    }
-
-    // Ensure the password field exists
-    passwordBytes, exists := secret.Data["password"]
-    if !exists {
-        return "", fmt.Errorf("password not found in secret")
-    }
-
-    // Print the raw password for debugging
-    password := string(passwordBytes)
-   
-
-
-    return password, nil
-}
-
-
-func GenerateAuthToken(password string) (string, error) {
-    argoURL := "http://argo-cd-argocd-server.argocd.svc.cluster.local/api/v1/session"
-    payload := map[string]string{
-        "username": "admin",
-        "password": password,
-    }
-    payloadBytes, _ := json.Marshal(payload)
-
-
-    client := &http.Client{
-        Timeout: 30 * time.Second,
-    }
-
-    req, err := http.NewRequest("POST", argoURL, bytes.NewBuffer(payloadBytes))
-    if err != nil {
-        return "", fmt.Errorf("failed to create request: %v", err)
-    }
-    req.Header.Set("Content-Type", "application/json")
-
-    resp, err := client.Do(req)
-    if err != nil {
-        return "", fmt.Errorf("failed to send request: %v", err)
-    }
-    defer resp.Body.Close()
-
-    if resp.StatusCode != http.StatusOK {
-        bodyBytes, _ := io.ReadAll(resp.Body)
-      return "", fmt.Errorf("authentication failed: %v, response: %s", resp.Status, string(bodyBytes))
-    }
-
-    var response map[string]interface{}
-    if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-        return "", fmt.Errorf("failed to decode response: %v", err)
-    }
-
-    token, ok := response["token"].(string)
-    if !ok {
-       
-      return "", fmt.Errorf("token not found in response")
-    }
-
-
-    return token, nil
-}
-
-
-
-
-// GetAuthToken retrieves the current token, generating a new one if necessary
-func GetAuthToken(c *Controller, password string) (string, error) {
-    tokenLock.Lock()
-    defer tokenLock.Unlock()
-
-    if token == "" {
-        var err error
-        token, err = GenerateAuthToken(password)
-        if err != nil {
-            return "", fmt.Errorf("failed to generate auth token: %v", err)
-        }
-        go scheduleTokenRefresh(c, password)
-    }
-
-    return token, nil
-}
-
-
-// scheduleTokenRefresh sets up a routine to refresh the token before it expires and update clients
-func scheduleTokenRefresh(c *Controller, password string) {
-    for {
-        // Schedule the token refresh before the actual expiry time
-        time.Sleep(23 * time.Hour) // Assuming a 24-hour token expiry, adjust as necessary
-        tokenLock.Lock()
-
-        newToken, err := GenerateAuthToken(password)
-        if err != nil {
-            fmt.Printf("failed to refresh token: %v\n", err)
-            tokenLock.Unlock()
-            continue
-        }
-
-        token = newToken
-        err = refreshClients(c, newToken) // Pass controller reference
-        if err != nil {
-            fmt.Printf("failed to refresh clients: %v\n", err)
-        }
-
-        tokenLock.Unlock()
-    }
-}
-
-
-// CreateArgoCDClient creates and returns an Argo CD client
-func CreateArgoCDClient(authToken string) (apiclient.Client, error) {
-   
-    argoURL := "argo-cd-argocd-server.argocd.svc.cluster.local"
-
-    // Create Argo CD client options with the token
-    argoClientOpts := apiclient.ClientOptions{
-        ServerAddr: argoURL,
-        AuthToken:  authToken,
-		PlainText: true,
-    }
-
-    // Create the Argo CD client
-    argoClient, err := apiclient.NewClient(&argoClientOpts)
-    if err != nil {
-        return nil, fmt.Errorf("failed to create Argo CD client: %v", err)
-    }
-
-    return argoClient, nil
-}
-
-func refreshClients(c *Controller, newToken string) error {
-    // Update the Argo CD client with the new token
-    newArgoClient, err := CreateArgoCDClient(newToken)
-    if err != nil {
-        return fmt.Errorf("failed to create Argo CD client: %v", err)
-    }
-
-    // Update the clients stored in the controller struct
-    c.argoClient = newArgoClient
-
-   
-
-   appsetconn, newAppSetClient, err := newArgoClient.NewApplicationSetClient()
-    if err != nil {
-       
-        return fmt.Errorf("failed to create ApplicationSet client: %v", err)
-    }
-
-	_, newappClient, err := newArgoClient.NewApplicationClient()
-	if err != nil {
-		appsetconn.Close()
-		return fmt.Errorf("failed to create Application client: %v", err)
-	}
-	
-
-    c.appSetClient = newAppSetClient
-	c.appClient = newappClient
-
-
-    return nil
-}
-
-
+package controller
+
+import (
+	"context"
+	"sync"
+	"fmt"
+	"strings"
+	"time"
+	
+	"bytes"
+   
+    "encoding/json"
+    "net/http"
+	"io"
+
+	
+	
+    "go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	
+	
+	
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"  
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	apiclient "github.com/argoproj/argo-cd/v2/pkg/apiclient"
+	appv1alpha1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	
+	applicationsetpkg "github.com/argoproj/argo-cd/v2/pkg/apiclient/applicationset"
+	applicationpkg "github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+
+	
+	
+	
+
+	"github.com/alustan/alustan/pkg/application/registry"
+	"github.com/alustan/alustan/pkg/application/promotion"
+	"github.com/alustan/alustan/pkg/application/rollout"
+	"github.com/alustan/alustan/api/app/v1alpha1"
+	"github.com/alustan/alustan/pkg/application/service"
+	"github.com/alustan/alustan/pkg/util"
+	"github.com/alustan/alustan/pkg/application/listers"
+	Kubernetespkg "github.com/alustan/alustan/pkg/application/kubernetes"
+	"github.com/alustan/alustan/pkg/checkargo"
+	
+)
+
+var (
+    token     string
+    tokenLock sync.Mutex
+)
+
+
+type Controller struct {
+	Clientset        kubernetes.Interface
+	dynClient        dynamic.Interface
+	syncInterval     time.Duration
+	lastSyncTime     time.Time
+	workqueue        workqueue.RateLimitingInterface
+	appLister    listers.AppLister
+	informerFactory  dynamicinformer.DynamicSharedInformerFactory // Shared informer factory for App resources
+	informer         cache.SharedIndexInformer                    // Informer for App resources
+	logger           *zap.SugaredLogger
+	mu               sync.Mutex
+	numWorkers       int
+	maxWorkers       int
+	workerStopCh  chan struct{}
+    managerStopCh chan struct{}
+	argoClient   apiclient.Client
+	appSetClient   applicationsetpkg.ApplicationSetServiceClient
+	appClient    applicationpkg.ApplicationServiceClient
+	
+	
+	
+}
+
+
+// NewController initializes a new controller
+func NewController(clientset kubernetes.Interface, dynClient dynamic.Interface, syncInterval time.Duration, logger *zap.SugaredLogger) *Controller {
+	ctrl := &Controller{
+		Clientset:       clientset,
+		dynClient:       dynClient,
+		syncInterval:    syncInterval,
+		lastSyncTime:    time.Now().Add(-syncInterval), // Initialize to allow immediate first run
+		workqueue:       workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "apps"),
+		informerFactory: dynamicinformer.NewDynamicSharedInformerFactory(dynClient, syncInterval),
+		logger:          logger,
+		numWorkers:      0,
+		maxWorkers:      5,
+		workerStopCh:    make(chan struct{}),
+		managerStopCh:   make(chan struct{}),
+		
+	}
+
+	// Initialize informer
+	ctrl.initInformer()
+
+	return ctrl
+}
+
+
+// NewInClusterController initializes a new controller for in-cluster execution
+func NewInClusterController(syncInterval time.Duration, logger *zap.SugaredLogger) *Controller {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		logger.Fatalf("Error creating in-cluster config: %v", err)
+	}
+
+	config.QPS = 100.0
+	config.Burst = 200
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		logger.Fatalf("Error creating Kubernetes clientset: %v", err)
+	}
+
+	// Check if ArgoCD is installed and ready
+	installed, ready, err := checkargo.IsArgoCDInstalledAndReady(logger, clientset)
+	if err != nil {
+		logger.Fatalf("Error checking ArgoCD installation status: %v", err)
+	}
+
+	if !installed {
+		logger.Fatalf("ArgoCD is not installed in the cluster")
+	}
+
+	if !ready {
+		logger.Fatalf("ArgoCD components are installed but not ready")
+	}
+
+	dynClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		logger.Fatalf("Error creating dynamic Kubernetes client: %v", err)
+	}
+
+	return NewController(clientset, dynClient, syncInterval, logger)
+}
+
+func (c *Controller) initInformer() {
+	// Define the GroupVersionResource for the custom resource
+	gvr := schema.GroupVersionResource{
+		Group:    "alustan.io",
+		Version:  "v1alpha1",
+		Resource: "apps",
+	}
+
+	// Get the informer and error returned by ForResource
+	informer := c.informerFactory.ForResource(gvr)
+	c.informer = informer.Informer()
+
+	// Set the lister for the custom resource
+	c.appLister = listers.NewAppLister(c.informer.GetIndexer())
+
+	// Add event handlers to the informer
+	c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.handleAddApp,
+		UpdateFunc: c.handleUpdateApp,
+		DeleteFunc: c.handleDeleteApp,
+	})
+}
+
+
+func (c *Controller) setupInformer(stopCh <-chan struct{}) {
+	if c.informer == nil {
+		c.logger.Fatal("informer is nil, ensure initInformer is called before setupInformer")
+	}
+
+	// Start the informer
+	go c.informer.Run(stopCh)
+
+	// Wait for the informer's cache to sync
+	if !cache.WaitForCacheSync(stopCh, c.informer.HasSynced) {
+		c.logger.Error("timed out waiting for caches to sync")
+		return
+	}
+}
+
+func (c *Controller) handleAddApp(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		c.logger.Errorf("couldn't get key for object %+v: %v", obj, err)
+		return
+	}
+	c.enqueue(key)
+	c.enqueueDownstream(obj)
+}
+
+func (c *Controller) handleUpdateApp(old, new interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(new)
+	if err != nil {
+		c.logger.Errorf("couldn't get key for object %+v: %v", new, err)
+		return
+	}
+	c.enqueue(key)
+	c.enqueueDownstream(new)
+}
+
+func (c *Controller) handleDeleteApp(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		c.logger.Errorf("couldn't get key for object %+v: %v", obj, err)
+		return
+	}
+	c.enqueue(key)
+}
+
+func (c *Controller) enqueue(key string) {
+	c.workqueue.AddRateLimited(key)
+}
+
+// enqueueDownstream enqueues the Apps promoting the tag of an App, so they notice when it becomes healthy
+func (c *Controller) enqueueDownstream(obj interface{}) {
+	upstream, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	apps, err := c.appLister.App(upstream.GetNamespace()).List(labels.Everything())
+	if err != nil {
+		c.logger.Errorf("couldn't list Apps promoting %s: %v", upstream.GetName(), err)
+		return
+	}
+	for _, app := range apps {
+		downstream, ok := app.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		from, _, _ := unstructured.NestedString(downstream.Object, "spec", "promotion", "from")
+		if from == upstream.GetName() {
+			c.enqueue(downstream.GetNamespace() + "/" + downstream.GetName())
+		}
+	}
+}
+
+
+func (c *Controller) RunLeader(stopCh <-chan struct{}) {
+	defer c.logger.Sync()
+
+	c.logger.Info("Starting App controller")
+
+	// Setup informers and listers
+	c.setupInformer(stopCh)
+
+	// Leader election configuration
+	id := util.GetUniqueID()
+	rl, err := resourcelock.New(
+		resourcelock.LeasesResourceLock,
+		"alustan",
+		"app-controller-lock",
+		c.Clientset.CoreV1(),
+		c.Clientset.CoordinationV1(),
+		resourcelock.ResourceLockConfig{
+			Identity: id,
+		},
+	)
+	if err != nil {
+		c.logger.Fatalf("Failed to create resource lock: %v", err)
+	}
+
+	leaderelection.RunOrDie(context.TODO(), leaderelection.LeaderElectionConfig{
+		Lock:          rl,
+		LeaseDuration: 30 * time.Second,
+        RenewDeadline: 20 * time.Second,
+        RetryPeriod:   5 * time.Second,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				
+
+				// Authenticate and create ArgoCD client
+			 password, err := getAdminPassword(c.Clientset)
+			 if err != nil {
+				 c.logger.Fatalf("Failed to get admin password: %v", err)
+			 }
+
+			 authToken, err := GetAuthToken(c, password)
+			 if err != nil {
+				 c.logger.Fatalf("Failed to get auth token: %v", err)
+			 }
+
+			 err = refreshClients(c, authToken)
+			 if err != nil {
+				 c.logger.Fatalf("Failed to refresh clients: %v", err)
+			 }
+		
+			 c.logger.Info("Successfully created ArgoCD client")
+             c.logger.Infof("Successfully created ApplicationSet client")
+			 c.logger.Infof("Successfully created Applicationclient")
+			 c.logger.Info("App controller successfuly instantiated!!!")
+
+				// Start processing items
+				go c.manageWorkers()
+			},
+			OnStoppedLeading: func() {
+				c.logger.Infof("Pod %s lost leadership", id)
+				// Stop processing items
+				close(c.workerStopCh)  // Stop all individual runWorker functions
+				close(c.managerStopCh) // Stop the manageWorkers function
+				c.workqueue.ShutDown()
+			},
+			OnNewLeader: func(identity string) {
+				if identity == id {
+					c.logger.Infof("I am the new leader")
+				} else {
+					c.logger.Infof("New leader elected: %s", identity)
+				}
+			},
+		},
+		ReleaseOnCancel: true,
+	})
+}
+
+func (c *Controller) manageWorkers() {
+	for {
+		select {
+		case <-c.managerStopCh:
+		  return // Stops the manageWorkers loop
+        default:
+			queueLength := c.workqueue.Len()
+
+			c.mu.Lock()
+			currentWorkers := c.numWorkers
+			c.mu.Unlock()
+
+			// Calculate the desired number of workers based on the queue length
+			// spawn a new runworker routine for every queue length greater than 50 vice versa
+			desiredWorkers := (queueLength / 50) + 1
+			if desiredWorkers > c.maxWorkers {
+				desiredWorkers = c.maxWorkers
+			}
+
+			// Ensure at least one worker is running
+			if desiredWorkers < 1 {
+				desiredWorkers = 1
+			}
+
+			// Increase workers if needed
+			if currentWorkers < desiredWorkers {
+				for i := currentWorkers; i < desiredWorkers; i++ {
+					go c.runWorker()
+					c.mu.Lock()
+					c.numWorkers++
+					c.mu.Unlock()
+				}
+			}
+
+			// Decrease workers if needed, but ensure at least one worker is running
+			if currentWorkers > desiredWorkers {
+				for i := currentWorkers; i > desiredWorkers && i > 1; i-- {
+					c.mu.Lock()
+					c.numWorkers--
+					c.mu.Unlock()
+					c.workerStopCh <- struct{}{} // Signal a worker to stop
+
+				}
+			}
+
+			time.Sleep(15 * time.Second)
+		}
+	}
+}
+
+
+func (c *Controller) runWorker() {
+    for {
+        select {
+        case <-c.workerStopCh:
+            return // Stops the individual worker
+        default:
+            if !c.processNextWorkItem() {
+                return
+            }
+        }
+    }
+}
+
+
+
+func (c *Controller) processNextWorkItem() bool {
+	obj, shutdown := c.workqueue.Get()
+	if shutdown {
+		return false
+	}
+
+	err := func(obj interface{}) error {
+		defer c.workqueue.Done(obj)
+		key, ok := obj.(string)
+		if !ok {
+			c.workqueue.Forget(obj)
+			c.logger.Errorf("expected string in workqueue but got %T", obj)
+			return nil
+		}
+
+		namespace, name, err := cache.SplitMetaNamespaceKey(key)
+		if err != nil {
+			c.workqueue.Forget(obj)
+			c.logger.Errorf("invalid resource key: %s", key)
+			return nil
+		}
+
+		// Get the actual resource using the lister
+		appObject, err := c.appLister.App(namespace).Get(name)
+		if err != nil {
+		    // Check if the error message contains "not found"
+			if strings.Contains(err.Error(), "not found") {
+				c.workqueue.Forget(obj)
+				c.logger.Infof("resource %s/%s no longer exists", namespace, name)
+				return nil
+			}
+
+			// For other errors, decide whether to requeue or not
+			if errors.IsInternalError(err) || errors.IsServerTimeout(err) {
+				// These are considered transient errors, requeue the item
+				c.workqueue.AddRateLimited(key)
+				c.logger.Errorf("transient error fetching resource. requeing!! %s: %v", key, err)
+				return fmt.Errorf("transient error fetching resource. requeing!! %s: %v", key, err)
+			} else {
+				// Non-transient errors, do not requeue the item
+				c.workqueue.Forget(obj)
+				c.logger.Errorf("non-transient error fetching resource %s: %v", key, err)
+				return fmt.Errorf("non-transient error fetching resource %s: %v", key, err)
+			}
+		}
+
+		appObj := appObject.DeepCopyObject()
+
+		// Convert to *v1alpha1.App
+		unstructuredObj, ok := appObj.(*unstructured.Unstructured)
+		if !ok {
+			c.workqueue.Forget(obj)
+			c.logger.Errorf("expected *unstructured.Unstructured but got %T", appObj)
+			return nil
+		}
+		app := &v1alpha1.App{}
+		err = runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredObj.Object, app)
+		if err != nil {
+			c.workqueue.Forget(obj)
+			c.logger.Errorf("error converting unstructured object to *v1alpha1.App: %v", err)
+			return nil
+		}
+
+		// Retrieve generation information from status
+		generation := app.GetGeneration()
+		observedGeneration := app.Status.ObservedGeneration
+
+		// Convert generation to int if necessary
+		gen := int(generation)
+
+		if gen > observedGeneration {
+			// Perform synchronization and update observed generation
+			latestTag, tagStatus := c.resolveTag(app)
+			finalStatus, err := c.handleSyncRequest(c.appSetClient,c.appClient,app, latestTag, tagStatus)
+			if finalStatus.Message == "Destroy completed successfully" {
+               return nil
+			}
+			if err != nil {
+				finalStatus.State = "Error"
+				finalStatus.Message = err.Error()
+				c.workqueue.AddRateLimited(key)
+				c.logger.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
+				return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
+			}
+
+			finalStatus.ObservedGeneration = gen
+			updateErr := c.updateStatus(app, finalStatus)
+			if updateErr != nil {
+				c.logger.Infof("Failed to update status for %s: %v", key, updateErr)
+				c.workqueue.AddRateLimited(key)
+				return updateErr
+			}
+		} else if rollout.InProgress(app) {
+			progressErr := c.progressRollout(key, app)
+			if progressErr != nil {
+				c.logger.Infof("Failed to progress the rollout of %s: %v", key, progressErr)
+				c.workqueue.AddRateLimited(key)
+				return progressErr
+			}
+		} else if c.applicationSetCheckDue(app) || c.promotionDue(key, app) {
+			updateErr := c.checkApplicationSet(key, app)
+			if updateErr != nil {
+				c.logger.Infof("Failed to update status for %s: %v", key, updateErr)
+				c.workqueue.AddRateLimited(key)
+				return updateErr
+			}
+		}
+
+		c.workqueue.Forget(obj)
+		return nil
+	}(obj)
+
+	if err != nil {
+		c.logger.Error(err)
+		return true
+	}
+
+	return true
+}
+
+func (c *Controller) handleSyncRequest(appSetClient applicationsetpkg.ApplicationSetServiceClient, appClient applicationpkg.ApplicationServiceClient,observed *v1alpha1.App, latestTag string, tagStatus v1alpha1.AppStatus) (v1alpha1.AppStatus, error) {
+    
+    commonStatus := v1alpha1.AppStatus{
+        State:   "Progressing",
+        Message: "Starting processing",
+        // Keep the tag the environment runs until a new one is applied
+        Deployment: observed.Status.Deployment,
+        Rollout:    observed.Status.Rollout,
+    }
+
+    // Add finalizer if not already present
+    err := Kubernetespkg.AddFinalizer(c.logger, c.dynClient, observed.ObjectMeta.Name, observed.ObjectMeta.Namespace)
+    if err != nil {
+        c.logger.Errorf("Failed to add finalizer for %s/%s: %v", observed.ObjectMeta.Namespace, observed.ObjectMeta.Name, err)
+        commonStatus.State = "Error"
+        commonStatus.Message = fmt.Sprintf("Failed to add finalizer: %v", err)
+        return commonStatus, err
+    }
+
+    finalizing := false
+    // Check if the resource is being deleted
+    if observed.ObjectMeta.DeletionTimestamp != nil {
+        finalizing = true
+    }
+
+    commonStatus = mergeStatuses(commonStatus, tagStatus)
+    if tagStatus.State == "Error" {
+        c.logger.Errorf("Error getting tagged image name: %v", tagStatus.Message)
+        return commonStatus, fmt.Errorf("error getting tagged image name")
+    }
+    if latestTag == "" && !finalizing {
+        // A promoted App waits for the first healthy tag of its upstream App
+        c.logger.Infof("Waiting for promotion: %v", tagStatus.Message)
+        return commonStatus, nil
+    }
+    if !observed.Spec.PreviewEnvironment.Enabled {
+        taggedImageName := fmt.Sprintf("%s:%s", observed.Spec.ContainerRegistry.ImageName, latestTag)
+        c.logger.Infof("taggedImageName: %v", taggedImageName)
+    }
+
+    c.logger.Infof("latestTag: %v", latestTag)
+
+    // With a strategy the stable release keeps its tag while the latest one rolls out next to it
+    stableTag, startRollout := rollout.Plan(observed, latestTag)
+
+    // Handle RunService and process its status and error
+    runServiceStatus, runServiceErr := service.RunService(c.logger, c.Clientset, c.dynClient, appSetClient, appClient, observed, stableTag, finalizing)
+    commonStatus = mergeStatuses(commonStatus, runServiceStatus)
+    if runServiceErr != nil {
+        c.logger.Errorf("Error running service: %v", runServiceErr)
+        return commonStatus, fmt.Errorf("error running service: %v", runServiceErr)
+    }
+
+    // Record the tag applied to the environment, promoted Apps read it from their upstream App
+    if !finalizing && !observed.Spec.PreviewEnvironment.Enabled && runServiceStatus.ApplicationSet != nil {
+        commonStatus.Deployment = promotion.Deployment(c.logger, appClient, observed, stableTag, time.Now())
+    }
+    if finalizing {
+        return commonStatus, nil
+    }
+
+    secretName := fmt.Sprintf("%s-container-secret", observed.ObjectMeta.Name)
+    if startRollout {
+        rolloutStatus, err := rollout.Apply(c.logger, c.Clientset, c.dynClient, appSetClient, observed, secretName, "pat", stableTag, latestTag, time.Now())
+        if err != nil {
+            c.logger.Errorf("Error rolling out tag %s: %v", latestTag, err)
+            return commonStatus, fmt.Errorf("error rolling out tag %s: %v", latestTag, err)
+        }
+        commonStatus.Rollout = rolloutStatus
+        commonStatus.State = "Progressing"
+        commonStatus.Message = rolloutStatus.Message
+    } else if rollout.InProgress(observed) && (observed.Spec.Strategy == nil || observed.Status.Rollout.CanaryTag != stableTag) {
+        rolloutStatus, err := rollout.Cancel(c.logger, appSetClient, observed, fmt.Sprintf("tag %s is applied directly", stableTag))
+        if err != nil {
+            c.logger.Errorf("Error cancelling the rollout of tag %s: %v", observed.Status.Rollout.CanaryTag, err)
+            return commonStatus, fmt.Errorf("error cancelling the rollout: %v", err)
+        }
+        commonStatus.Rollout = rolloutStatus
+    }
+
+    return commonStatus, nil
+}
+
+// progressRollout moves the rollout of the App on and requeues it for its next step
+func (c *Controller) progressRollout(key string, observed *v1alpha1.App) error {
+    secretName := fmt.Sprintf("%s-container-secret", observed.ObjectMeta.Name)
+    rolloutStatus, wait, err := rollout.Progress(c.logger, c.Clientset, c.dynClient, c.appSetClient, c.appClient, observed, secretName, "pat", time.Now())
+    if err != nil {
+        return err
+    }
+
+    status := observed.Status
+    status.Rollout = rolloutStatus
+    status.Message = rolloutStatus.Message
+    switch rolloutStatus.Phase {
+    case rollout.PhaseCompleted:
+        status.State = "Completed"
+        status.Deployment = promotion.Deployment(c.logger, c.appClient, observed, rolloutStatus.CanaryTag, time.Now())
+    case rollout.PhaseAborted:
+        status.State = "Aborted"
+    default:
+        status.State = "Progressing"
+    }
+    if err := c.updateStatus(observed, status); err != nil {
+        return err
+    }
+    if wait > 0 {
+        c.workqueue.AddAfter(key, wait)
+    }
+    return nil
+}
+
+// resolveTag returns the image tag the App runs: the preview placeholder, the tag promoted from
+// the upstream App, or the latest registry tag matching the semanticVersion
+func (c *Controller) resolveTag(observed *v1alpha1.App) (string, v1alpha1.AppStatus) {
+    var status v1alpha1.AppStatus
+    if observed.Spec.PreviewEnvironment.Enabled {
+        if observed.Spec.Promotion != nil {
+            return "", v1alpha1.AppStatus{State: "Error", Message: "promotion is not supported with preview environments"}
+        }
+        return "{{.branch}}-{{.number}}", status
+    }
+    if observed.Spec.Promotion == nil {
+        return registry.HandleContainerRegistry(c.logger, c.Clientset, observed)
+    }
+
+    namespace := observed.ObjectMeta.Namespace
+    upstream, err := c.getApp(namespace, observed.Spec.Promotion.From)
+    if err != nil {
+        return "", v1alpha1.AppStatus{State: "Error", Message: fmt.Sprintf("Error getting App %s: %v", observed.Spec.Promotion.From, err)}
+    }
+
+    tag, promotionStatus := promotion.Evaluate(c.logger, c.Clientset, observed, upstream, time.Now())
+    promotionStatus.Pipeline = promotion.Pipeline(observed, func(name string) (*v1alpha1.App, error) {
+        return c.getApp(namespace, name)
+    })
+    status.Promotion = promotionStatus
+    if tag == "" {
+        status.State = "WaitingForPromotion"
+        status.Message = promotionStatus.Message
+    }
+    return tag, status
+}
+
+// promotionDue reports whether the upstream App offers a tag to promote, and requeues the App
+// for when the offered tag has soaked
+func (c *Controller) promotionDue(key string, observed *v1alpha1.App) bool {
+    if observed.Spec.Promotion == nil {
+        return false
+    }
+    upstream, err := c.getApp(observed.ObjectMeta.Namespace, observed.Spec.Promotion.From)
+    if err != nil {
+        c.logger.Errorf("Failed to get App %s promoted to %s: %v", observed.Spec.Promotion.From, key, err)
+        return false
+    }
+    due, wait := promotion.Due(observed, upstream, time.Now())
+    if wait > 0 {
+        c.workqueue.AddAfter(key, wait)
+    }
+    return due
+}
+
+// getApp returns an App of the informer cache, nil when it does not exist
+func (c *Controller) getApp(namespace, name string) (*v1alpha1.App, error) {
+    obj, err := c.appLister.App(namespace).Get(name)
+    if err != nil {
+        if strings.Contains(err.Error(), "not found") {
+            return nil, nil
+        }
+        return nil, err
+    }
+    unstructuredObj, ok := obj.(*unstructured.Unstructured)
+    if !ok {
+        return nil, fmt.Errorf("expected *unstructured.Unstructured but got %T", obj)
+    }
+    app := &v1alpha1.App{}
+    if err := runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredObj.DeepCopy().Object, app); err != nil {
+        return nil, fmt.Errorf("error converting unstructured object to *v1alpha1.App: %v", err)
+    }
+    return app, nil
+}
+
+
+
+
+// applicationSetCheckDue reports whether the ApplicationSet was last compared with the App more than a sync interval ago
+func (c *Controller) applicationSetCheckDue(observed *v1alpha1.App) bool {
+	if observed.ObjectMeta.DeletionTimestamp != nil {
+		return false
+	}
+	if observed.Status.ApplicationSet == nil {
+		return true
+	}
+	return time.Since(observed.Status.ApplicationSet.LastChecked.Time) >= c.syncInterval
+}
+
+// checkApplicationSet renders the ApplicationSet again with the latest image tag and re-applies the App
+// when the live ApplicationSet differs, so new tags roll out without a spec change
+func (c *Controller) checkApplicationSet(key string, observed *v1alpha1.App) error {
+	latestTag, tagStatus := c.resolveTag(observed)
+	if tagStatus.State == "Error" {
+		c.logger.Errorf("ApplicationSet check for %s failed: %v", key, tagStatus.Message)
+		return nil
+	}
+	if latestTag == "" {
+		// Nothing to render until the upstream App offers a tag
+		status := observed.Status
+		status.Promotion = tagStatus.Promotion
+		return c.updateStatus(observed, status)
+	}
+
+	stableTag, startRollout := rollout.Plan(observed, latestTag)
+	secretName := fmt.Sprintf("%s-container-secret", observed.ObjectMeta.Name)
+	desired, err := service.DesiredApplicationSet(c.logger, c.Clientset, c.dynClient, observed, secretName, "pat", stableTag)
+	if err != nil {
+		c.logger.Errorf("ApplicationSet check for %s failed: %v", key, err)
+		return nil
+	}
+	if desired == nil {
+		return nil
+	}
+
+	appSetStatus, err := service.CompareApplicationSet(c.appSetClient, desired)
+	if err != nil {
+		c.logger.Errorf("ApplicationSet check for %s failed: %v", key, err)
+		return nil
+	}
+
+	status := observed.Status
+	if appSetStatus.InSync && !startRollout {
+		status.ApplicationSet = appSetStatus
+		if !observed.Spec.PreviewEnvironment.Enabled {
+			status.Deployment = promotion.Deployment(c.logger, c.appClient, observed, stableTag, time.Now())
+		}
+		if tagStatus.Promotion != nil {
+			status.Promotion = tagStatus.Promotion
+		}
+		return c.updateStatus(observed, status)
+	}
+
+	if startRollout {
+		c.logger.Infof("Rolling out tag %s of %s next to tag %s", latestTag, key, stableTag)
+	} else {
+		c.logger.Infof("ApplicationSet of %s differs from the App: %v, re-applying", key, appSetStatus.Diff)
+	}
+	synced, err := c.handleSyncRequest(c.appSetClient, c.appClient, observed, latestTag, tagStatus)
+	if err != nil {
+		synced.State = "Error"
+		synced.Message = err.Error()
+		// Keep the comparison so the next check waits for the sync interval
+		synced.ApplicationSet = appSetStatus
+	}
+	synced.ObservedGeneration = observed.Status.ObservedGeneration
+	return c.updateStatus(observed, synced)
+}
+
+// Define the helper function to check if HealthStatus is empty
+func isEmptyApplicationStatus(conditions []appv1alpha1.ApplicationCondition ) bool {
+    return len(conditions) == 0
+}
+ 
+func mergeStatuses(baseStatus, newStatus v1alpha1.AppStatus) v1alpha1.AppStatus {
+    if newStatus.State != "" {
+        baseStatus.State = newStatus.State
+    }
+    if newStatus.Message != "" {
+        baseStatus.Message = newStatus.Message
+    }
+    
+    if !isEmptyApplicationStatus(newStatus.HealthStatus) {
+        baseStatus.HealthStatus = newStatus.HealthStatus
+    }
+
+    if newStatus.PreviewURLs != nil {
+        baseStatus.PreviewURLs = newStatus.PreviewURLs
+    }
+
+    if newStatus.ApplicationSet != nil {
+        baseStatus.ApplicationSet = newStatus.ApplicationSet
+    }
+
+    if newStatus.Deployment != nil {
+        baseStatus.Deployment = newStatus.Deployment
+    }
+
+    if newStatus.Promotion != nil {
+        baseStatus.Promotion = newStatus.Promotion
+    }
+
+    if newStatus.Rollout != nil {
+        baseStatus.Rollout = newStatus.Rollout
+    }
+   
+    return baseStatus
+}
+
+
+func (c *Controller) updateStatus(observed *v1alpha1.App, status v1alpha1.AppStatus) error {
+	err := Kubernetespkg.UpdateStatus(c.logger, c.dynClient, observed.ObjectMeta.Name, observed.ObjectMeta.Namespace, status)
+	
+	if err != nil {
+		c.logger.Errorf("Failed to update status for %s/%s: %v", observed.ObjectMeta.Namespace, observed.ObjectMeta.Name, err)
+		return err
+	}
+	return nil
+
+}
+
+func getAdminPassword(clientset kubernetes.Interface) (string, error) {
+    namespace := "argocd"
+    secretName := "argocd-initial-admin-secret"
+
+    // Retrieve the secret from Kubernetes
+    secret, err := clientset.CoreV1().Secrets(namespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+    if err != nil {
+        return "", fmt.Errorf("failed to get secret: %v", err)
+    }
+
+    // Ensure the password field exists
+    passwordBytes, exists := secret.Data["password"]
+    if !exists {
+        return "", fmt.Errorf("password not found in secret")
+    }
+
+    // Print the raw password for debugging
+    password := string(passwordBytes)
+   
+
+
+    return password, nil
+}
+
+
+func GenerateAuthToken(password string) (string, error) {
+    argoURL := "http://argo-cd-argocd-server.argocd.svc.cluster.local/api/v1/session"
+    payload := map[string]string{
+        "username": "admin",
+        "password": password,
+    }
+    payloadBytes, _ := json.Marshal(payload)
+
+
+    client := &http.Client{
+        Timeout: 30 * time.Second,
+    }
+
+    req, err := http.NewRequest("POST", argoURL, bytes.NewBuffer(payloadBytes))
+    if err != nil {
+        return "", fmt.Errorf("failed to create request: %v", err)
+    }
+    req.Header.Set("Content-Type", "application/json")
+
+    resp, err := client.Do(req)
+    if err != nil {
+        return "", fmt.Errorf("failed to send request: %v", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        bodyBytes, _ := io.ReadAll(resp.Body)
+      return "", fmt.Errorf("authentication failed: %v, response: %s", resp.Status, string(bodyBytes))
+    }
+
+    var response map[string]interface{}
+    if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+        return "", fmt.Errorf("failed to decode response: %v", err)
+    }
+
+    token, ok := response["token"].(string)
+    if !ok {
+       
+      return "", fmt.Errorf("token not found in response")
+    }
+
+
+    return token, nil
+}
+
+
+
+
+// GetAuthToken retrieves the current token, generating a new one if necessary
+func GetAuthToken(c *Controller, password string) (string, error) {
+    tokenLock.Lock()
+    defer tokenLock.Unlock()
+
+    if token == "" {
+        var err error
+        token, err = GenerateAuthToken(password)
+        if err != nil {
+            return "", fmt.Errorf("failed to generate auth token: %v", err)
+        }
+        go scheduleTokenRefresh(c, password)
+    }
+
+    return token, nil
+}
+
+
+// scheduleTokenRefresh sets up a routine to refresh the token before it expires and update clients
+func scheduleTokenRefresh(c *Controller, password string) {
+    for {
+        // Schedule the token refresh before the actual expiry time
+        time.Sleep(23 * time.Hour) // Assuming a 24-hour token expiry, adjust as necessary
+        tokenLock.Lock()
+
+        newToken, err := GenerateAuthToken(password)
+        if err != nil {
+            fmt.Printf("failed to refresh token: %v\n", err)
+            tokenLock.Unlock()
+            continue
+        }
+
+        token = newToken
+        err = refreshClients(c, newToken) // Pass controller reference
+        if err != nil {
+            fmt.Printf("failed to refresh clients: %v\n", err)
+        }
+
+        tokenLock.Unlock()
+    }
+}
+
+
+// CreateArgoCDClient creates and returns an Argo CD client
+func CreateArgoCDClient(authToken string) (apiclient.Client, error) {
+   
+    argoURL := "argo-cd-argocd-server.argocd.svc.cluster.local"
+
+    // Create Argo CD client options with the token
+    argoClientOpts := apiclient.ClientOptions{
+        ServerAddr: argoURL,
+        AuthToken:  authToken,
+		PlainText: true,
+    }
+
+    // Create the Argo CD client
+    argoClient, err := apiclient.NewClient(&argoClientOpts)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create Argo CD client: %v", err)
+    }
+
+    return argoClient, nil
+}
+
+func refreshClients(c *Controller, newToken string) error {
+    // Update the Argo CD client with the new token
+    newArgoClient, err := CreateArgoCDClient(newToken)
+    if err != nil {
+        return fmt.Errorf("failed to create Argo CD client: %v", err)
+    }
+
+    // Update the clients stored in the controller struct
+    c.argoClient = newArgoClient
+
+   
+
+   appsetconn, newAppSetClient, err := newArgoClient.NewApplicationSetClient()
+    if err != nil {
+       
+        return fmt.Errorf("failed to create ApplicationSet client: %v", err)
+    }
+
+	_, newappClient, err := newArgoClient.NewApplicationClient()
+	if err != nil {
+		appsetconn.Close()
+		return fmt.Errorf("failed to create Application client: %v", err)
+	}
+	
+
+    c.appSetClient = newAppSetClient
+	c.appClient = newappClient
+
+
+    return nil
+}
+
+
@@ -0,0 +1,61 @@
+package kubernetes
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+
+    "go.uber.org/zap"
+
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes"
+)
+
+// EnsureOCIRepository registers an OCI registry as a Helm repository in Argo CD.
+// Registries the user already declared, e.g with credentials, are left as they are.
+func EnsureOCIRepository(logger *zap.SugaredLogger, clientset kubernetes.Interface, namespace, url string) error {
+    repositories, err := clientset.CoreV1().Secrets(namespace).List(context.TODO(), metav1.ListOptions{
+        LabelSelector: "argocd.argoproj.io/secret-type=repository",
+    })
+    if err != nil {
+        return fmt.Errorf("failed to list Argo CD repositories: %v", err)
+    }
+    for _, repository := range repositories.Items {
+        if string(repository.Data["url"]) == url {
+            return nil
+        }
+    }
+
+    sum := sha256.Sum256([]byte(url))
+    secretName := fmt.Sprintf("oci-repository-%s", hex.EncodeToString(sum[:])[:10])
+
+    secret := &corev1.Secret{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:      secretName,
+            Namespace: namespace,
+            Labels: map[string]string{
+                "argocd.argoproj.io/secret-type": "repository",
+                "app.kubernetes.io/managed-by":   "alustan",
+            },
+        },
+        StringData: map[string]string{
+            "name":      url,
+            "url":       url,
+            "type":      "helm",
+            "enableOCI": "true",
+        },
+        Type: corev1.SecretTypeOpaque,
+    }
+
+    _, err = clientset.CoreV1().Secrets(namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+    if err != nil && !errors.IsAlreadyExists(err) {
+        logger.Errorf("Failed to register OCI repository %s: %v", url, err)
+        return fmt.Errorf("failed to register OCI repository %s: %v", url, err)
+    }
+
+    logger.Infof("OCI repository %s registered in Argo CD", url)
+    return nil
+}
@@ -0,0 +1,43 @@
+package kubernetes
+
+import (
+    "context"
+    "fmt"
+    "strings"
+
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes"
+)
+
+// RepositoryCredentials returns the username and password Argo CD uses for a repository,
+// from the repository secret of the url or else from the longest matching credential template.
+// Both are empty for public repositories.
+func RepositoryCredentials(clientset kubernetes.Interface, namespace, url string) (string, string, error) {
+    repositories, err := clientset.CoreV1().Secrets(namespace).List(context.TODO(), metav1.ListOptions{
+        LabelSelector: "argocd.argoproj.io/secret-type=repository",
+    })
+    if err != nil {
+        return "", "", fmt.Errorf("failed to list Argo CD repositories: %v", err)
+    }
+    for _, repository := range repositories.Items {
+        if strings.TrimSuffix(string(repository.Data["url"]), ".git") == strings.TrimSuffix(url, ".git") &&
+            len(repository.Data["password"]) > 0 {
+            return string(repository.Data["username"]), string(repository.Data["password"]), nil
+        }
+    }
+
+    templates, err := clientset.CoreV1().Secrets(namespace).List(context.TODO(), metav1.ListOptions{
+        LabelSelector: "argocd.argoproj.io/secret-type=repo-creds",
+    })
+    if err != nil {
+        return "", "", fmt.Errorf("failed to list Argo CD repository credentials: %v", err)
+    }
+    username, password, matched := "", "", ""
+    for _, template := range templates.Items {
+        prefix := string(template.Data["url"])
+        if prefix != "" && strings.HasPrefix(url, prefix) && len(prefix) > len(matched) {
+            username, password, matched = string(template.Data["username"]), string(template.Data["password"]), prefix
+        }
+    }
+    return username, password, nil
+}
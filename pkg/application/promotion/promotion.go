@@ -0,0 +1,321 @@
+package promotion
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	application "github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	appv1alpha1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/alustan/alustan/api/app/v1alpha1"
+	"github.com/alustan/alustan/pkg/application/registry"
+	"github.com/alustan/alustan/pkg/application/service"
+)
+
+const (
+	// StatePromoted means the App runs the tag offered by the upstream App
+	StatePromoted = "Promoted"
+	// StateWaitingForUpstream means the upstream App runs no healthy and synced tag
+	StateWaitingForUpstream = "WaitingForUpstream"
+	// StateSoaking means the upstream tag has not been healthy for the soak duration yet
+	StateSoaking = "Soaking"
+	// StateChecksFailed means a promotion check failed, it is retried every sync interval
+	StateChecksFailed = "ChecksFailed"
+	// StateRejected means the registry or the semanticVersion of the App rejects the tag
+	StateRejected = "Rejected"
+)
+
+// maxPipelineStages bounds the walk up the promotion chain, which may be misconfigured as a cycle
+const maxPipelineStages = 20
+
+// checkTimeout bounds each promotion check
+const checkTimeout = 10 * time.Second
+
+// maxCheckBody bounds how much of the answer of a check is read before the connection is closed
+const maxCheckBody = 64 << 10
+
+// awsIPv6Metadata is the IPv6 address of the EC2 instance metadata service
+var awsIPv6Metadata = net.ParseIP("fd00:ec2::254")
+
+// checkAddressAllowed reports whether a check may connect to an address, tests replace it to reach a local server
+var checkAddressAllowed = publicAddress
+
+// publicAddress refuses loopback, link-local, which holds the 169.254.169.254 metadata service, and unspecified addresses
+func publicAddress(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.Equal(awsIPv6Metadata))
+}
+
+// checkClient returns the client of the promotion checks. Addresses are checked when dialing, after name resolution
+// and for every redirect, so a name resolving to a refused address is refused too. Proxies are not used.
+func checkClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: checkTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !checkAddressAllowed(ip) {
+				return fmt.Errorf("address %s is not allowed for promotion checks", host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: checkTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: checkTimeout,
+		},
+	}
+}
+
+// Getter returns an App of the namespace of the promoted App, nil when it does not exist
+type Getter func(name string) (*v1alpha1.App, error)
+
+// Evaluate decides which tag the App runs: the tag running healthy upstream once it soaked,
+// exists in the registry and passes the checks, else the tag the App already runs.
+// The tag is empty while the App never had one to run.
+func Evaluate(
+	logger *zap.SugaredLogger,
+	clientset kubernetes.Interface,
+	observed *v1alpha1.App,
+	upstream *v1alpha1.App,
+	now time.Time,
+) (string, *v1alpha1.PromotionStatus) {
+	current := deployedTag(observed)
+	status := &v1alpha1.PromotionStatus{From: observed.Spec.Promotion.From}
+	if previous := observed.Status.Promotion; previous != nil {
+		status.LastPromoted = previous.LastPromoted
+	}
+
+	candidate, wait, reason := Candidate(observed, upstream, now)
+	status.CandidateTag = candidate
+	if candidate != "" && candidate == current {
+		status.State = StatePromoted
+		status.Message = fmt.Sprintf("running tag %s of %s", current, status.From)
+		return current, status
+	}
+	if reason != "" {
+		status.State = StateWaitingForUpstream
+		if wait > 0 {
+			status.State = StateSoaking
+		}
+		status.Message = reason
+		return current, status
+	}
+
+	if verify := registry.VerifyTag(logger, clientset, observed, candidate); verify.State == "Error" {
+		status.State = StateRejected
+		status.Message = verify.Message
+		return current, status
+	}
+	if err := runChecks(observed.Spec.Promotion.Checks); err != nil {
+		status.State = StateChecksFailed
+		status.Message = err.Error()
+		return current, status
+	}
+
+	logger.Infof("Promoting tag %s from %s to %s", candidate, upstream.ObjectMeta.Name, observed.ObjectMeta.Name)
+	promoted := metav1.NewTime(now)
+	status.State = StatePromoted
+	status.Message = fmt.Sprintf("promoted tag %s from %s", candidate, status.From)
+	status.LastPromoted = &promoted
+	return candidate, status
+}
+
+// Candidate returns the tag the upstream App runs. When it may not be promoted yet the reason tells why,
+// with how long is left to soak.
+func Candidate(observed, upstream *v1alpha1.App, now time.Time) (string, time.Duration, string) {
+	from := observed.Spec.Promotion.From
+	if upstream == nil {
+		return "", 0, fmt.Sprintf("App %s not found", from)
+	}
+	deployment := upstream.Status.Deployment
+	if deployment == nil || deployment.Tag == "" {
+		return "", 0, fmt.Sprintf("App %s has not deployed a tag yet", from)
+	}
+	if !deployment.Healthy || deployment.HealthySince == nil {
+		return deployment.Tag, 0, fmt.Sprintf("tag %s is not healthy and synced in %s", deployment.Tag, upstream.Spec.Environment)
+	}
+	soakedAt := deployment.HealthySince.Add(observed.Spec.Promotion.SoakDuration.Duration)
+	if soakedAt.After(now) {
+		return deployment.Tag, soakedAt.Sub(now), fmt.Sprintf("tag %s soaks in %s until %s", deployment.Tag, upstream.Spec.Environment, soakedAt.UTC().Format(time.RFC3339))
+	}
+	return deployment.Tag, 0, ""
+}
+
+// Due reports whether the upstream App offers a tag the App should evaluate now,
+// or else how long until the offered tag has soaked
+func Due(observed, upstream *v1alpha1.App, now time.Time) (bool, time.Duration) {
+	if observed.Spec.Promotion == nil || observed.ObjectMeta.DeletionTimestamp != nil {
+		return false, 0
+	}
+	candidate, wait, reason := Candidate(observed, upstream, now)
+	if candidate == "" || candidate == deployedTag(observed) {
+		return false, 0
+	}
+	if wait > 0 {
+		return false, wait
+	}
+	if reason != "" {
+		return false, 0
+	}
+	// A tag that was rejected or failed its checks is retried every sync interval, not on every event
+	if previous := observed.Status.Promotion; previous != nil && previous.CandidateTag == candidate &&
+		(previous.State == StateRejected || previous.State == StateChecksFailed) {
+		return false, 0
+	}
+	return true, 0
+}
+
+// Pipeline returns where each tag runs, from the first App of the promotion chain to the App
+func Pipeline(observed *v1alpha1.App, get Getter) []v1alpha1.PromotionStage {
+	stages := []v1alpha1.PromotionStage{stage(observed)}
+	visited := map[string]bool{observed.ObjectMeta.Name: true}
+	app := observed
+	for len(stages) < maxPipelineStages && app.Spec.Promotion != nil {
+		from := app.Spec.Promotion.From
+		if visited[from] {
+			break
+		}
+		upstream, err := get(from)
+		if err != nil || upstream == nil {
+			break
+		}
+		visited[from] = true
+		stages = append([]v1alpha1.PromotionStage{stage(upstream)}, stages...)
+		app = upstream
+	}
+	return stages
+}
+
+// Deployment reports the tag applied to the App and whether the Applications its ApplicationSet generated
+// run it healthy and synced, keeping the time they became healthy while the tag does not change
+func Deployment(
+	logger *zap.SugaredLogger,
+	appClient application.ApplicationServiceClient,
+	observed *v1alpha1.App,
+	tag string,
+	now time.Time,
+) *v1alpha1.DeploymentStatus {
+	healthy := false
+	apps, err := service.GeneratedApplications(appClient, observed.ObjectMeta.Name)
+	if err != nil {
+		logger.Infof("Could not check the health of %s: %v", observed.ObjectMeta.Name, err)
+	} else if reason := runningTag(apps, tag); reason != "" {
+		logger.Infof("Tag %s of %s is not deployed yet: %s", tag, observed.ObjectMeta.Name, reason)
+	} else {
+		healthy = true
+	}
+
+	status := &v1alpha1.DeploymentStatus{
+		Tag:         tag,
+		Healthy:     healthy,
+		LastChecked: metav1.NewTime(now),
+	}
+	if healthy {
+		if previous := observed.Status.Deployment; previous != nil && previous.Tag == tag && previous.HealthySince != nil {
+			status.HealthySince = previous.HealthySince
+		} else {
+			healthySince := metav1.NewTime(now)
+			status.HealthySince = &healthySince
+		}
+	}
+	return status
+}
+
+// runningTag returns why the Applications do not run the tag healthy and synced, empty when they all do.
+// Argo CD must report the tag as the synced revision or as the tag of an image, so the health of the
+// previous tag is not taken for the health of the new one before the Application is updated.
+func runningTag(apps []appv1alpha1.Application, tag string) string {
+	if len(apps) == 0 {
+		return "no Application generated"
+	}
+	for _, app := range apps {
+		if app.Status.Health.Status != "Healthy" || app.Status.Sync.Status != appv1alpha1.SyncStatusCodeSynced {
+			return fmt.Sprintf("Application %s is %s and %s", app.Name, app.Status.Health.Status, app.Status.Sync.Status)
+		}
+		if app.Status.Sync.Revision == tag {
+			continue
+		}
+		running := false
+		for _, image := range app.Status.Summary.Images {
+			if imageTag(image) == tag {
+				running = true
+				break
+			}
+		}
+		if !running {
+			return fmt.Sprintf("Application %s runs images %v", app.Name, app.Status.Summary.Images)
+		}
+	}
+	return ""
+}
+
+// imageTag returns the tag of an image reference, without its digest
+func imageTag(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return ""
+	}
+	return image[i+1:]
+}
+
+// deployedTag returns the tag the App runs, empty before its first deployment
+func deployedTag(observed *v1alpha1.App) string {
+	if observed.Status.Deployment == nil {
+		return ""
+	}
+	return observed.Status.Deployment.Tag
+}
+
+func stage(app *v1alpha1.App) v1alpha1.PromotionStage {
+	s := v1alpha1.PromotionStage{
+		App:         app.ObjectMeta.Name,
+		Environment: app.Spec.Environment,
+	}
+	if app.Status.Deployment != nil {
+		s.Tag = app.Status.Deployment.Tag
+		s.Healthy = app.Status.Deployment.Healthy
+	}
+	return s
+}
+
+// runChecks calls the checks in order and fails on the first unexpected answer.
+// Checks are requested from the controller pod, so only http and https urls to addresses publicAddress allows are called.
+func runChecks(checks []v1alpha1.PromotionCheck) error {
+	client := checkClient()
+	for _, check := range checks {
+		expected := check.ExpectedStatus
+		if expected == 0 {
+			expected = http.StatusOK
+		}
+		if u, err := url.Parse(check.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("check %s: url %q is not an http or https url", check.Name, check.URL)
+		}
+		resp, err := client.Get(check.URL)
+		if err != nil {
+			return fmt.Errorf("check %s failed: %v", check.Name, err)
+		}
+		// Draining the body lets the connection be reused, the limit keeps a large answer from being read
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxCheckBody))
+		resp.Body.Close()
+		if resp.StatusCode != expected {
+			return fmt.Errorf("check %s returned %d, expected %d", check.Name, resp.StatusCode, expected)
+		}
+	}
+	return nil
+}
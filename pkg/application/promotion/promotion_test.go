@@ -0,0 +1,251 @@
+package promotion
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	appv1alpha1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/gitops-engine/pkg/health"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/alustan/alustan/api/app/v1alpha1"
+)
+
+// promotedApp returns an App promoted from staging after a soak of 30m, running the tag when set
+func promotedApp(tag string) *v1alpha1.App {
+	app := &v1alpha1.App{}
+	app.Name = "web-production"
+	app.Spec.Promotion = &v1alpha1.Promotion{From: "web-staging", SoakDuration: metav1.Duration{Duration: 30 * time.Minute}}
+	if tag != "" {
+		app.Status.Deployment = &v1alpha1.DeploymentStatus{Tag: tag, Healthy: true}
+	}
+	return app
+}
+
+// upstreamApp returns the staging App running the tag, healthy since the time when set
+func upstreamApp(tag string, healthySince *time.Time) *v1alpha1.App {
+	app := &v1alpha1.App{}
+	app.Name = "web-staging"
+	app.Spec.Environment = "staging"
+	app.Status.Deployment = &v1alpha1.DeploymentStatus{Tag: tag}
+	if healthySince != nil {
+		since := metav1.NewTime(*healthySince)
+		app.Status.Deployment.Healthy = true
+		app.Status.Deployment.HealthySince = &since
+	}
+	return app
+}
+
+func TestCandidate(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	soaked := now.Add(-time.Hour)
+	soaking := now.Add(-10 * time.Minute)
+
+	tests := []struct {
+		name          string
+		upstream      *v1alpha1.App
+		wantTag       string
+		wantWait      time.Duration
+		wantPromotion bool
+	}{
+		{name: "upstream missing"},
+		{name: "nothing deployed upstream", upstream: upstreamApp("", nil)},
+		{name: "unhealthy", upstream: upstreamApp("v2", nil), wantTag: "v2"},
+		{name: "soaking", upstream: upstreamApp("v2", &soaking), wantTag: "v2", wantWait: 20 * time.Minute},
+		{name: "soaked", upstream: upstreamApp("v2", &soaked), wantTag: "v2", wantPromotion: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag, wait, reason := Candidate(promotedApp("v1"), tt.upstream, now)
+			if tag != tt.wantTag || wait != tt.wantWait || (reason == "") != tt.wantPromotion {
+				t.Fatalf("Candidate() = %q, %v, %q, want %q, %v, promotion %v", tag, wait, reason, tt.wantTag, tt.wantWait, tt.wantPromotion)
+			}
+		})
+	}
+}
+
+func TestDue(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	soaked := now.Add(-time.Hour)
+	soaking := now.Add(-10 * time.Minute)
+
+	rejected := promotedApp("v1")
+	rejected.Status.Promotion = &v1alpha1.PromotionStatus{CandidateTag: "v2", State: StateRejected}
+	rejectedEarlier := promotedApp("v1")
+	rejectedEarlier.Status.Promotion = &v1alpha1.PromotionStatus{CandidateTag: "v1.5", State: StateChecksFailed}
+	deleting := promotedApp("v1")
+	deleting.DeletionTimestamp = &metav1.Time{Time: now}
+	notPromoted := promotedApp("v1")
+	notPromoted.Spec.Promotion = nil
+
+	tests := []struct {
+		name     string
+		observed *v1alpha1.App
+		upstream *v1alpha1.App
+		wantDue  bool
+		wantWait time.Duration
+	}{
+		{name: "new tag soaked", observed: promotedApp("v1"), upstream: upstreamApp("v2", &soaked), wantDue: true},
+		{name: "first tag", observed: promotedApp(""), upstream: upstreamApp("v2", &soaked), wantDue: true},
+		{name: "same tag", observed: promotedApp("v2"), upstream: upstreamApp("v2", &soaked)},
+		{name: "soaking", observed: promotedApp("v1"), upstream: upstreamApp("v2", &soaking), wantWait: 20 * time.Minute},
+		{name: "unhealthy", observed: promotedApp("v1"), upstream: upstreamApp("v2", nil)},
+		{name: "rejected tag waits for the sync interval", observed: rejected, upstream: upstreamApp("v2", &soaked)},
+		{name: "another tag was rejected", observed: rejectedEarlier, upstream: upstreamApp("v2", &soaked), wantDue: true},
+		{name: "being deleted", observed: deleting, upstream: upstreamApp("v2", &soaked)},
+		{name: "no promotion", observed: notPromoted, upstream: upstreamApp("v2", &soaked)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			due, wait := Due(tt.observed, tt.upstream, now)
+			if due != tt.wantDue || wait != tt.wantWait {
+				t.Fatalf("Due() = %v, %v, want %v, %v", due, wait, tt.wantDue, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestRunChecks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			w.Write([]byte("ok"))
+		case "/large":
+			w.Write([]byte(strings.Repeat("a", 4*maxCheckBody)))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		check      v1alpha1.PromotionCheck
+		blockLocal bool
+		wantErr    bool
+	}{
+		{name: "ok", check: v1alpha1.PromotionCheck{Name: "smoke", URL: server.URL + "/healthz"}},
+		{name: "large answer", check: v1alpha1.PromotionCheck{Name: "smoke", URL: server.URL + "/large"}},
+		{name: "expected status", check: v1alpha1.PromotionCheck{Name: "smoke", URL: server.URL + "/down", ExpectedStatus: http.StatusServiceUnavailable}},
+		{name: "unexpected status", check: v1alpha1.PromotionCheck{Name: "smoke", URL: server.URL + "/down"}, wantErr: true},
+		{name: "file url", check: v1alpha1.PromotionCheck{Name: "smoke", URL: "file:///etc/passwd"}, wantErr: true},
+		{name: "gopher url", check: v1alpha1.PromotionCheck{Name: "smoke", URL: "gopher://127.0.0.1:6379/_INFO"}, wantErr: true},
+		{name: "no host", check: v1alpha1.PromotionCheck{Name: "smoke", URL: "http:///healthz"}, wantErr: true},
+		{name: "loopback address", check: v1alpha1.PromotionCheck{Name: "smoke", URL: server.URL + "/healthz"}, blockLocal: true, wantErr: true},
+		{name: "metadata service", check: v1alpha1.PromotionCheck{Name: "smoke", URL: "http://169.254.169.254/latest/meta-data/"}, blockLocal: true, wantErr: true},
+	}
+
+	defer func() { checkAddressAllowed = publicAddress }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkAddressAllowed = func(net.IP) bool { return true }
+			if tt.blockLocal {
+				checkAddressAllowed = publicAddress
+			}
+			err := runChecks([]v1alpha1.PromotionCheck{tt.check})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runChecks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPublicAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{address: "93.184.216.34", want: true},
+		{address: "10.96.0.10", want: true},
+		{address: "127.0.0.1"},
+		{address: "::1"},
+		{address: "169.254.169.254"},
+		{address: "fe80::1"},
+		{address: "fd00:ec2::254"},
+		{address: "0.0.0.0"},
+		{address: "::ffff:127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			if got := publicAddress(net.ParseIP(tt.address)); got != tt.want {
+				t.Fatalf("publicAddress(%s) = %v, want %v", tt.address, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunningTag(t *testing.T) {
+	app := func(name string, healthStatus health.HealthStatusCode, sync appv1alpha1.SyncStatusCode, revision string, images ...string) appv1alpha1.Application {
+		a := appv1alpha1.Application{}
+		a.Name = name
+		a.Status.Health.Status = healthStatus
+		a.Status.Sync.Status = sync
+		a.Status.Sync.Revision = revision
+		a.Status.Summary.Images = images
+		return a
+	}
+
+	tests := []struct {
+		name        string
+		apps        []appv1alpha1.Application
+		wantRunning bool
+	}{
+		{
+			name:        "image with the tag",
+			apps:        []appv1alpha1.Application{app("web", "Healthy", "Synced", "main", "ghcr.io/alustan/web:v2")},
+			wantRunning: true,
+		},
+		{
+			name:        "synced revision is the tag",
+			apps:        []appv1alpha1.Application{app("web", "Healthy", "Synced", "v2")},
+			wantRunning: true,
+		},
+		{
+			name:        "image pinned by digest",
+			apps:        []appv1alpha1.Application{app("web", "Healthy", "Synced", "main", "registry:5000/web:v2@sha256:abc")},
+			wantRunning: true,
+		},
+		{
+			name: "previous tag still running",
+			apps: []appv1alpha1.Application{app("web", "Healthy", "Synced", "main", "ghcr.io/alustan/web:v1")},
+		},
+		{
+			name: "registry port is not a tag",
+			apps: []appv1alpha1.Application{app("web", "Healthy", "Synced", "main", "registry:5000/web")},
+		},
+		{
+			name: "progressing",
+			apps: []appv1alpha1.Application{app("web", "Progressing", "Synced", "main", "ghcr.io/alustan/web:v2")},
+		},
+		{
+			name: "out of sync",
+			apps: []appv1alpha1.Application{app("web", "Healthy", "OutOfSync", "main", "ghcr.io/alustan/web:v2")},
+		},
+		{
+			name: "one cluster behind",
+			apps: []appv1alpha1.Application{
+				app("web", "Healthy", "Synced", "main", "ghcr.io/alustan/web:v2"),
+				app("web", "Healthy", "Synced", "main", "ghcr.io/alustan/web:v1"),
+			},
+		},
+		{
+			name: "no application",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := runningTag(tt.apps, "v2")
+			if (reason == "") != tt.wantRunning {
+				t.Fatalf("runningTag() = %q, want running %v", reason, tt.wantRunning)
+			}
+		})
+	}
+}
@@ -1,111 +1,170 @@
-package registry
-
-import (
-
-	"fmt"
-	
-	"os"
-
-	"github.com/Masterminds/semver/v3"
-	
-	"k8s.io/client-go/kubernetes"
-	
-	"go.uber.org/zap"
-
-	"github.com/alustan/alustan/pkg/imagetag"
-	
-	containers "github.com/alustan/alustan/pkg/containers"
-	"github.com/alustan/alustan/api/app/v1alpha1"
-	"github.com/alustan/alustan/pkg/application/errorstatus"
-	
-)
-
-
-
-func HandleContainerRegistry(
-	logger *zap.SugaredLogger,
-	clientset kubernetes.Interface,
-	observed *v1alpha1.App,
-	
-) (string, v1alpha1.AppStatus) {
-	var status v1alpha1.AppStatus
-
-	encodedDockerConfigJSON := os.Getenv("CONTAINER_REGISTRY_SECRET")
-	if encodedDockerConfigJSON == "" {
-		logger.Info("Environment variable CONTAINER_REGISTRY_SECRET is not set")
-		status = errorstatus.ErrorResponse(logger,"creating Docker config secret", fmt.Errorf("CONTAINER_REGISTRY_SECRET is not set"))
-		return "", status
-	}
-
-	secretName := fmt.Sprintf("%s-container-secret", observed.ObjectMeta.Name)
-	_, token, err := containers.CreateDockerConfigSecret(logger,clientset, secretName, observed.ObjectMeta.Namespace, encodedDockerConfigJSON)
-	if err != nil {
-		status = errorstatus.ErrorResponse(logger,"creating Docker config secret", err)
-		return "", status
-	}
-
-	provider := observed.Spec.ContainerRegistry.Provider
-	registryClient, err := getRegistryClient(provider, token)
-	if err != nil {
-		status = errorstatus.ErrorResponse(logger,"creating registry client", err)
-		return "", status
-	}
-
-	image := observed.Spec.ContainerRegistry.ImageName
-	tags, err := registryClient.GetTags(image)
-	if err != nil {
-		status = errorstatus.ErrorResponse(logger,"fetching image tags", err)
-		return "", status
-	}
-
-	semanticVersion := observed.Spec.ContainerRegistry.SemanticVersion
-	latestTag, err := getLatestTag(tags, semanticVersion)
-	if err != nil {
-		status = errorstatus.ErrorResponse(logger,"determining latest image tag", err)
-		return "", status
-	}
-
-	
-
-	return latestTag, status
-}
-
-func getRegistryClient(provider, token string) (imagetag.RegistryClientInterface, error) {
-	switch provider {
-	case "ghcr":
-		return imagetag.NewGHCRClient(token), nil
-	case "docker":
-		return imagetag.NewDockerHubClient(token), nil
-	default:
-		return nil, fmt.Errorf("unknown container registry provider: %s", provider)
-	}
-}
-
-func getLatestTag(tags []string, semanticVersion string) (string, error) {
-	constraint, err := semver.NewConstraint(semanticVersion)
-	if err != nil {
-		return "", fmt.Errorf("error parsing semantic version constraint: %w", err)
-	}
-
-	var latestVersion *semver.Version
-	for _, tag := range tags {
-		version, err := semver.NewVersion(tag)
-		if err != nil {
-			continue // Skip tags that are not valid semantic versions
-		}
-
-		if constraint.Check(version) {
-			if latestVersion == nil || version.GreaterThan(latestVersion) {
-				latestVersion = version
-			}
-		}
-	}
-
-	if latestVersion == nil {
-		return "", fmt.Errorf("no valid versions found for constraint %s", semanticVersion)
-	}
-
-	return latestVersion.String(), nil
-}
-
-
+package registry
+
+import (
+
+	"fmt"
+	
+	"os"
+
+	"github.com/Masterminds/semver/v3"
+	
+	"k8s.io/client-go/kubernetes"
+	
+	"go.uber.org/zap"
+
+	"github.com/alustan/alustan/pkg/imagetag"
+	
+	containers "github.com/alustan/alustan/pkg/containers"
+	"github.com/alustan/alustan/api/app/v1alpha1"
+	"github.com/alustan/alustan/pkg/application/errorstatus"
+	
+)
+
+
+
+func HandleContainerRegistry(
+	logger *zap.SugaredLogger,
+	clientset kubernetes.Interface,
+	observed *v1alpha1.App,
+	
+) (string, v1alpha1.AppStatus) {
+	tags, status := imageTags(logger, clientset, observed)
+	if status.State == "Error" {
+		return "", status
+	}
+
+	semanticVersion := observed.Spec.ContainerRegistry.SemanticVersion
+	latestTag, err := getLatestTag(tags, semanticVersion)
+	if err != nil {
+		status = errorstatus.ErrorResponse(logger,"determining latest image tag", err)
+		return "", status
+	}
+
+	
+
+	return latestTag, status
+}
+
+// VerifyTag checks that a tag promoted from another App exists in the registry
+// and satisfies the semanticVersion of the App when set
+func VerifyTag(
+	logger *zap.SugaredLogger,
+	clientset kubernetes.Interface,
+	observed *v1alpha1.App,
+	tag string,
+) v1alpha1.AppStatus {
+	tags, status := imageTags(logger, clientset, observed)
+	if status.State == "Error" {
+		return status
+	}
+
+	// Tags resolved from a semantic version constraint are normalized, v1.2.3 is deployed as 1.2.3
+	version, versionErr := semver.NewVersion(tag)
+	found := false
+	for _, t := range tags {
+		if t == tag {
+			found = true
+			break
+		}
+		if candidate, err := semver.NewVersion(t); err == nil && versionErr == nil && candidate.Equal(version) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return errorstatus.ErrorResponse(logger, "verifying image tag", fmt.Errorf("tag %s of %s not found", tag, observed.Spec.ContainerRegistry.ImageName))
+	}
+
+	semanticVersion := observed.Spec.ContainerRegistry.SemanticVersion
+	if semanticVersion == "" {
+		return status
+	}
+	constraint, err := semver.NewConstraint(semanticVersion)
+	if err != nil {
+		return errorstatus.ErrorResponse(logger, "verifying image tag", fmt.Errorf("error parsing semantic version constraint: %w", err))
+	}
+	if versionErr != nil || !constraint.Check(version) {
+		return errorstatus.ErrorResponse(logger, "verifying image tag", fmt.Errorf("tag %s does not satisfy %s", tag, semanticVersion))
+	}
+
+	return status
+}
+
+// imageTags lists the tags of the App image, creating the Docker config secret of the registry
+func imageTags(
+	logger *zap.SugaredLogger,
+	clientset kubernetes.Interface,
+	observed *v1alpha1.App,
+) ([]string, v1alpha1.AppStatus) {
+	var status v1alpha1.AppStatus
+
+	encodedDockerConfigJSON := os.Getenv("CONTAINER_REGISTRY_SECRET")
+	if encodedDockerConfigJSON == "" {
+		logger.Info("Environment variable CONTAINER_REGISTRY_SECRET is not set")
+		status = errorstatus.ErrorResponse(logger,"creating Docker config secret", fmt.Errorf("CONTAINER_REGISTRY_SECRET is not set"))
+		return nil, status
+	}
+
+	secretName := fmt.Sprintf("%s-container-secret", observed.ObjectMeta.Name)
+	_, token, err := containers.CreateDockerConfigSecret(logger,clientset, secretName, observed.ObjectMeta.Namespace, encodedDockerConfigJSON)
+	if err != nil {
+		status = errorstatus.ErrorResponse(logger,"creating Docker config secret", err)
+		return nil, status
+	}
+
+	provider := observed.Spec.ContainerRegistry.Provider
+	registryClient, err := getRegistryClient(provider, token)
+	if err != nil {
+		status = errorstatus.ErrorResponse(logger,"creating registry client", err)
+		return nil, status
+	}
+
+	image := observed.Spec.ContainerRegistry.ImageName
+	tags, err := registryClient.GetTags(image)
+	if err != nil {
+		status = errorstatus.ErrorResponse(logger,"fetching image tags", err)
+		return nil, status
+	}
+
+	return tags, status
+}
+
+func getRegistryClient(provider, token string) (imagetag.RegistryClientInterface, error) {
+	switch provider {
+	case "ghcr":
+		return imagetag.NewGHCRClient(token), nil
+	case "docker":
+		return imagetag.NewDockerHubClient(token), nil
+	default:
+		return nil, fmt.Errorf("unknown container registry provider: %s", provider)
+	}
+}
+
+func getLatestTag(tags []string, semanticVersion string) (string, error) {
+	constraint, err := semver.NewConstraint(semanticVersion)
+	if err != nil {
+		return "", fmt.Errorf("error parsing semantic version constraint: %w", err)
+	}
+
+	var latestVersion *semver.Version
+	for _, tag := range tags {
+		version, err := semver.NewVersion(tag)
+		if err != nil {
+			continue // Skip tags that are not valid semantic versions
+		}
+
+		if constraint.Check(version) {
+			if latestVersion == nil || version.GreaterThan(latestVersion) {
+				latestVersion = version
+			}
+		}
+	}
+
+	if latestVersion == nil {
+		return "", fmt.Errorf("no valid versions found for constraint %s", semanticVersion)
+	}
+
+	return latestVersion.String(), nil
+}
+
+
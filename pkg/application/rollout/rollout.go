@@ -0,0 +1,329 @@
+package rollout
+
+import (
+	"fmt"
+	"time"
+
+	application "github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	applicationset "github.com/argoproj/argo-cd/v2/pkg/apiclient/applicationset"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/alustan/alustan/api/app/v1alpha1"
+	"github.com/alustan/alustan/pkg/application/service"
+)
+
+const (
+	// StrategyCanary shifts the traffic to the new tag in steps
+	StrategyCanary = "Canary"
+	// StrategyBlueGreen switches all the traffic to the new tag once it ran healthy without traffic
+	StrategyBlueGreen = "BlueGreen"
+
+	// PhaseProgressing means the canary release runs the new tag with a share of the traffic
+	PhaseProgressing = "Progressing"
+	// PhaseFinalizing means the stable release is updated to the new tag, the canary release still serving the traffic
+	PhaseFinalizing = "Finalizing"
+	// PhaseCompleted means the stable release runs the new tag and the canary release is removed
+	PhaseCompleted = "Completed"
+	// PhaseAborted means the new tag was unhealthy, the stable release kept or got back the previous tag
+	PhaseAborted = "Aborted"
+)
+
+// defaultProgressDeadline is how long a release may take to become healthy when spec.strategy does not say
+const defaultProgressDeadline = 10 * time.Minute
+
+// pollInterval is how often the health of a rollout is checked
+const pollInterval = 15 * time.Second
+
+// finalizeGrace lets Argo CD notice the stable release changed before its health is trusted
+const finalizeGrace = 30 * time.Second
+
+// step is a share of the traffic sent to the new tag and how long it is held
+type step struct {
+	weight int
+	pause  time.Duration
+}
+
+// Plan returns the tag the stable release runs and whether the latest tag must be rolled out next to it.
+// Without a strategy, before the first deployment or for preview environments the latest tag is applied directly.
+// A tag whose rollout was aborted is not rolled out again until the App spec changes.
+func Plan(observed *v1alpha1.App, latestTag string) (string, bool) {
+	if observed.Spec.Strategy == nil || observed.Spec.PreviewEnvironment.Enabled {
+		return latestTag, false
+	}
+	if r := observed.Status.Rollout; InProgress(observed) && r.Phase == PhaseFinalizing && r.CanaryTag == latestTag {
+		// The stable release already runs the new tag
+		return latestTag, false
+	}
+	deployment := observed.Status.Deployment
+	if deployment == nil || deployment.Tag == "" || deployment.Tag == latestTag {
+		return latestTag, false
+	}
+	if r := observed.Status.Rollout; r != nil && r.Phase == PhaseAborted && r.CanaryTag == latestTag &&
+		r.AbortedGeneration == observed.ObjectMeta.Generation {
+		return deployment.Tag, false
+	}
+	return deployment.Tag, true
+}
+
+// InProgress reports whether a rollout of the App is running
+func InProgress(observed *v1alpha1.App) bool {
+	r := observed.Status.Rollout
+	return observed.ObjectMeta.DeletionTimestamp == nil && r != nil && (r.Phase == PhaseProgressing || r.Phase == PhaseFinalizing)
+}
+
+// Apply starts the rollout of the tag next to the stable one, or re-applies the canary release at its current step
+// when the tag is already rolling out, e.g after a change of the App spec
+func Apply(
+	logger *zap.SugaredLogger,
+	clientset kubernetes.Interface,
+	dynamicClient dynamic.Interface,
+	appSetClient applicationset.ApplicationSetServiceClient,
+	observed *v1alpha1.App,
+	secretName, key, stableTag, tag string,
+	now time.Time,
+) (*v1alpha1.RolloutStatus, error) {
+	strategy, steps, err := strategySteps(observed.Spec.Strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &v1alpha1.RolloutStatus{
+		Strategy:    strategy,
+		Phase:       PhaseProgressing,
+		StableTag:   stableTag,
+		CanaryTag:   tag,
+		Step:        0,
+		Weight:      steps[0].weight,
+		StepStarted: metav1.NewTime(now),
+	}
+	if previous := observed.Status.Rollout; InProgress(observed) && previous.CanaryTag == tag && previous.Phase == PhaseProgressing && previous.Step < len(steps) {
+		status.Step = previous.Step
+		status.Weight = steps[previous.Step].weight
+		status.StepStarted = previous.StepStarted
+	}
+
+	if err := applyCanary(logger, clientset, dynamicClient, appSetClient, observed, secretName, key, tag, status.Weight); err != nil {
+		return nil, err
+	}
+	status.Message = stepMessage(status, len(steps))
+	return status, nil
+}
+
+// Progress moves the rollout on: to the next step once the canary release is healthy and the step has paused,
+// to the stable release once the steps are done, and back to the stable tag when the new tag is unhealthy.
+// It returns the status of the rollout and when to check it again, zero once it is over.
+func Progress(
+	logger *zap.SugaredLogger,
+	clientset kubernetes.Interface,
+	dynamicClient dynamic.Interface,
+	appSetClient applicationset.ApplicationSetServiceClient,
+	appClient application.ApplicationServiceClient,
+	observed *v1alpha1.App,
+	secretName, key string,
+	now time.Time,
+) (*v1alpha1.RolloutStatus, time.Duration, error) {
+	status := *observed.Status.Rollout
+	name := observed.ObjectMeta.Name
+
+	if observed.Spec.Strategy == nil {
+		return abort(logger, clientset, dynamicClient, appSetClient, observed, secretName, key, &status, "spec.strategy was removed")
+	}
+	_, steps, err := strategySteps(observed.Spec.Strategy)
+	if err != nil {
+		return abort(logger, clientset, dynamicClient, appSetClient, observed, secretName, key, &status, err.Error())
+	}
+	deadline := observed.Spec.Strategy.ProgressDeadline.Duration
+	if deadline <= 0 {
+		deadline = defaultProgressDeadline
+	}
+	elapsed := now.Sub(status.StepStarted.Time)
+
+	if status.Phase == PhaseFinalizing {
+		if elapsed < finalizeGrace {
+			return &status, finalizeGrace - elapsed, nil
+		}
+		health, sync, err := service.GetApplicationHealth(appClient, name)
+		if err != nil {
+			return nil, 0, err
+		}
+		if health == "Degraded" || (elapsed > deadline && (health != "Healthy" || sync != "Synced")) {
+			return abort(logger, clientset, dynamicClient, appSetClient, observed, secretName, key, &status,
+				fmt.Sprintf("stable release is %s with tag %s", health, status.CanaryTag))
+		}
+		if health != "Healthy" || sync != "Synced" {
+			return &status, pollInterval, nil
+		}
+		if err := service.DeleteCanaryApplicationSet(logger, appSetClient, observed); err != nil {
+			return nil, 0, err
+		}
+		status.Phase = PhaseCompleted
+		status.Weight = 0
+		status.StepStarted = metav1.NewTime(now)
+		status.Message = fmt.Sprintf("tag %s rolled out", status.CanaryTag)
+		return &status, 0, nil
+	}
+
+	health, sync, err := service.GetApplicationHealth(appClient, service.CanaryName(name))
+	if err != nil {
+		return nil, 0, err
+	}
+	healthy := health == "Healthy" && sync == "Synced"
+	if health == "Degraded" || (!healthy && elapsed > deadline) {
+		return abort(logger, clientset, dynamicClient, appSetClient, observed, secretName, key, &status,
+			fmt.Sprintf("canary release is %s with tag %s", health, status.CanaryTag))
+	}
+	if !healthy {
+		status.Message = fmt.Sprintf("waiting for tag %s to become healthy: %s", status.CanaryTag, health)
+		return &status, pollInterval, nil
+	}
+
+	if status.Step >= len(steps) {
+		status.Step = len(steps) - 1
+	}
+	if remaining := steps[status.Step].pause - elapsed; remaining > 0 {
+		status.Message = stepMessage(&status, len(steps))
+		return &status, remaining, nil
+	}
+
+	if status.Step+1 < len(steps) {
+		status.Step++
+		status.Weight = steps[status.Step].weight
+		status.StepStarted = metav1.NewTime(now)
+		if err := applyCanary(logger, clientset, dynamicClient, appSetClient, observed, secretName, key, status.CanaryTag, status.Weight); err != nil {
+			return nil, 0, err
+		}
+		status.Message = stepMessage(&status, len(steps))
+		return &status, pollInterval, nil
+	}
+
+	// The steps are done, the stable release takes the new tag while the canary release serves the traffic
+	if err := applyStable(logger, clientset, dynamicClient, appSetClient, observed, secretName, key, status.CanaryTag); err != nil {
+		return nil, 0, err
+	}
+	status.Phase = PhaseFinalizing
+	status.StepStarted = metav1.NewTime(now)
+	status.Message = fmt.Sprintf("updating the stable release to tag %s", status.CanaryTag)
+	return &status, finalizeGrace, nil
+}
+
+// Cancel removes the canary release of a rollout the App no longer needs, e.g when the strategy was removed
+// or the latest tag is the stable one again
+func Cancel(
+	logger *zap.SugaredLogger,
+	appSetClient applicationset.ApplicationSetServiceClient,
+	observed *v1alpha1.App,
+	reason string,
+) (*v1alpha1.RolloutStatus, error) {
+	if err := service.DeleteCanaryApplicationSet(logger, appSetClient, observed); err != nil {
+		return nil, err
+	}
+	status := *observed.Status.Rollout
+	status.Phase = PhaseAborted
+	status.Weight = 0
+	status.AbortedGeneration = observed.ObjectMeta.Generation
+	status.Message = fmt.Sprintf("rollout cancelled, %s", reason)
+	return &status, nil
+}
+
+// abort puts the stable release back on the stable tag and removes the canary release
+func abort(
+	logger *zap.SugaredLogger,
+	clientset kubernetes.Interface,
+	dynamicClient dynamic.Interface,
+	appSetClient applicationset.ApplicationSetServiceClient,
+	observed *v1alpha1.App,
+	secretName, key string,
+	status *v1alpha1.RolloutStatus,
+	reason string,
+) (*v1alpha1.RolloutStatus, time.Duration, error) {
+	logger.Infof("Aborting the rollout of tag %s of %s: %s", status.CanaryTag, observed.ObjectMeta.Name, reason)
+	if status.Phase == PhaseFinalizing {
+		if err := applyStable(logger, clientset, dynamicClient, appSetClient, observed, secretName, key, status.StableTag); err != nil {
+			return nil, 0, err
+		}
+	}
+	if err := service.DeleteCanaryApplicationSet(logger, appSetClient, observed); err != nil {
+		return nil, 0, err
+	}
+	status.Phase = PhaseAborted
+	status.Weight = 0
+	status.AbortedGeneration = observed.ObjectMeta.Generation
+	status.Message = fmt.Sprintf("rollout aborted, %s", reason)
+	return status, 0, nil
+}
+
+// applyCanary applies the ApplicationSet of the canary release
+func applyCanary(
+	logger *zap.SugaredLogger,
+	clientset kubernetes.Interface,
+	dynamicClient dynamic.Interface,
+	appSetClient applicationset.ApplicationSetServiceClient,
+	observed *v1alpha1.App,
+	secretName, key, tag string,
+	weight int,
+) error {
+	appSet, err := service.DesiredCanaryApplicationSet(logger, clientset, dynamicClient, observed, secretName, key, tag, weight)
+	if err != nil {
+		return err
+	}
+	if appSet == nil {
+		return fmt.Errorf("cluster secret of environment %s not found", observed.Spec.Environment)
+	}
+	_, err = service.ApplyApplicationSet(logger, appSetClient, appSet)
+	return err
+}
+
+// applyStable applies the ApplicationSet of the stable release with the tag
+func applyStable(
+	logger *zap.SugaredLogger,
+	clientset kubernetes.Interface,
+	dynamicClient dynamic.Interface,
+	appSetClient applicationset.ApplicationSetServiceClient,
+	observed *v1alpha1.App,
+	secretName, key, tag string,
+) error {
+	appSet, err := service.DesiredApplicationSet(logger, clientset, dynamicClient, observed, secretName, key, tag)
+	if err != nil {
+		return err
+	}
+	if appSet == nil {
+		return fmt.Errorf("cluster secret of environment %s not found", observed.Spec.Environment)
+	}
+	_, err = service.ApplyApplicationSet(logger, appSetClient, appSet)
+	return err
+}
+
+// strategySteps returns the name of the strategy and its steps, blue-green being a preview without traffic
+// followed by a switch of all the traffic
+func strategySteps(strategy *v1alpha1.Strategy) (string, []step, error) {
+	switch {
+	case strategy.Canary != nil && strategy.BlueGreen != nil:
+		return "", nil, fmt.Errorf("strategy must be either canary or blueGreen")
+	case strategy.Canary != nil:
+		if len(strategy.Canary.Steps) == 0 {
+			return "", nil, fmt.Errorf("canary strategy requires steps")
+		}
+		steps := make([]step, 0, len(strategy.Canary.Steps))
+		for i, s := range strategy.Canary.Steps {
+			if s.SetWeight < 0 || s.SetWeight > 100 {
+				return "", nil, fmt.Errorf("canary step %d: setWeight must be between 0 and 100", i)
+			}
+			steps = append(steps, step{weight: s.SetWeight, pause: s.Pause.Duration})
+		}
+		return StrategyCanary, steps, nil
+	case strategy.BlueGreen != nil:
+		return StrategyBlueGreen, []step{
+			{weight: 0, pause: strategy.BlueGreen.PreviewDuration.Duration},
+			{weight: 100, pause: strategy.BlueGreen.ScaleDownDelay.Duration},
+		}, nil
+	default:
+		return "", nil, fmt.Errorf("strategy requires canary or blueGreen")
+	}
+}
+
+func stepMessage(status *v1alpha1.RolloutStatus, steps int) string {
+	return fmt.Sprintf("rolling out tag %s, step %d/%d at %d%% of the traffic", status.CanaryTag, status.Step+1, steps, status.Weight)
+}
@@ -0,0 +1,142 @@
+package rollout
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/alustan/alustan/api/app/v1alpha1"
+)
+
+func TestStrategySteps(t *testing.T) {
+	minutes := func(m int) metav1.Duration {
+		return metav1.Duration{Duration: time.Duration(m) * time.Minute}
+	}
+
+	tests := []struct {
+		name         string
+		strategy     v1alpha1.Strategy
+		wantStrategy string
+		wantSteps    []step
+		wantErr      bool
+	}{
+		{
+			name: "canary",
+			strategy: v1alpha1.Strategy{Canary: &v1alpha1.CanaryStrategy{Steps: []v1alpha1.CanaryStep{
+				{SetWeight: 10, Pause: minutes(5)},
+				{SetWeight: 50, Pause: minutes(10)},
+				{SetWeight: 100},
+			}}},
+			wantStrategy: StrategyCanary,
+			wantSteps:    []step{{10, 5 * time.Minute}, {50, 10 * time.Minute}, {100, 0}},
+		},
+		{
+			name:         "blue green",
+			strategy:     v1alpha1.Strategy{BlueGreen: &v1alpha1.BlueGreenStrategy{PreviewDuration: minutes(15), ScaleDownDelay: minutes(2)}},
+			wantStrategy: StrategyBlueGreen,
+			wantSteps:    []step{{0, 15 * time.Minute}, {100, 2 * time.Minute}},
+		},
+		{
+			name:     "canary without steps",
+			strategy: v1alpha1.Strategy{Canary: &v1alpha1.CanaryStrategy{}},
+			wantErr:  true,
+		},
+		{
+			name:     "weight above 100",
+			strategy: v1alpha1.Strategy{Canary: &v1alpha1.CanaryStrategy{Steps: []v1alpha1.CanaryStep{{SetWeight: 120}}}},
+			wantErr:  true,
+		},
+		{
+			name:     "negative weight",
+			strategy: v1alpha1.Strategy{Canary: &v1alpha1.CanaryStrategy{Steps: []v1alpha1.CanaryStep{{SetWeight: -1}}}},
+			wantErr:  true,
+		},
+		{
+			name: "both strategies",
+			strategy: v1alpha1.Strategy{
+				Canary:    &v1alpha1.CanaryStrategy{Steps: []v1alpha1.CanaryStep{{SetWeight: 10}}},
+				BlueGreen: &v1alpha1.BlueGreenStrategy{},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "no strategy",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy, steps, err := strategySteps(&tt.strategy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("strategySteps() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if strategy != tt.wantStrategy || !reflect.DeepEqual(steps, tt.wantSteps) {
+				t.Fatalf("strategySteps() = %s, %v, want %s, %v", strategy, steps, tt.wantStrategy, tt.wantSteps)
+			}
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	app := func(deployed string, rollout *v1alpha1.RolloutStatus) *v1alpha1.App {
+		observed := &v1alpha1.App{}
+		observed.Generation = 2
+		observed.Spec.Strategy = &v1alpha1.Strategy{Canary: &v1alpha1.CanaryStrategy{Steps: []v1alpha1.CanaryStep{{SetWeight: 20}}}}
+		if deployed != "" {
+			observed.Status.Deployment = &v1alpha1.DeploymentStatus{Tag: deployed}
+		}
+		observed.Status.Rollout = rollout
+		return observed
+	}
+	withoutStrategy := app("v1", nil)
+	withoutStrategy.Spec.Strategy = nil
+	preview := app("v1", nil)
+	preview.Spec.PreviewEnvironment.Enabled = true
+
+	tests := []struct {
+		name        string
+		observed    *v1alpha1.App
+		wantStable  string
+		wantRollout bool
+	}{
+		{name: "new tag", observed: app("v1", nil), wantStable: "v1", wantRollout: true},
+		{name: "first deployment", observed: app("", nil), wantStable: "v2"},
+		{name: "tag already deployed", observed: app("v2", nil), wantStable: "v2"},
+		{name: "no strategy", observed: withoutStrategy, wantStable: "v2"},
+		{name: "preview environment", observed: preview, wantStable: "v2"},
+		{
+			name:       "stable release finalizing the tag",
+			observed:   app("v1", &v1alpha1.RolloutStatus{Phase: PhaseFinalizing, CanaryTag: "v2"}),
+			wantStable: "v2",
+		},
+		{
+			name:       "tag aborted for this generation",
+			observed:   app("v1", &v1alpha1.RolloutStatus{Phase: PhaseAborted, CanaryTag: "v2", AbortedGeneration: 2}),
+			wantStable: "v1",
+		},
+		{
+			name:        "tag aborted before the spec changed",
+			observed:    app("v1", &v1alpha1.RolloutStatus{Phase: PhaseAborted, CanaryTag: "v2", AbortedGeneration: 1}),
+			wantStable:  "v1",
+			wantRollout: true,
+		},
+		{
+			name:        "another tag aborted",
+			observed:    app("v1", &v1alpha1.RolloutStatus{Phase: PhaseAborted, CanaryTag: "v1.5", AbortedGeneration: 2}),
+			wantStable:  "v1",
+			wantRollout: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stable, rollout := Plan(tt.observed, "v2")
+			if stable != tt.wantStable || rollout != tt.wantRollout {
+				t.Fatalf("Plan() = %s, %v, want %s, %v", stable, rollout, tt.wantStable, tt.wantRollout)
+			}
+		})
+	}
+}
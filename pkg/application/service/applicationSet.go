@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	applicationset "github.com/argoproj/argo-cd/v2/pkg/apiclient/applicationset"
+	appv1alpha1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/alustan/alustan/api/app/v1alpha1"
+)
+
+// SpecHashAnnotation holds the hash of the spec the ApplicationSet was rendered with
+const SpecHashAnnotation = "alustan.io/spec-hash"
+
+// applicationSetSpecHash returns a stable hash of an ApplicationSet spec
+func applicationSetSpecHash(spec appv1alpha1.ApplicationSetSpec) string {
+	raw, _ := json.Marshal(spec)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// CompareApplicationSet reports how the live ApplicationSet differs from the desired one
+func CompareApplicationSet(appSetClient applicationset.ApplicationSetServiceClient, desired *appv1alpha1.ApplicationSet) (*v1alpha1.ApplicationSetStatus, error) {
+	status := &v1alpha1.ApplicationSetStatus{
+		Name:        desired.Name,
+		SpecHash:    desired.Annotations[SpecHashAnnotation],
+		LastChecked: metav1.Now(),
+	}
+
+	live, err := appSetClient.Get(context.Background(), &applicationset.ApplicationSetGetQuery{
+		Name:            desired.Name,
+		AppsetNamespace: desired.Namespace,
+	})
+	if err != nil {
+		if grpcstatus.Code(err) == codes.NotFound {
+			status.Diff = []string{"applicationset missing"}
+			return status, nil
+		}
+		return nil, fmt.Errorf("failed to get ApplicationSet %s: %v", desired.Name, err)
+	}
+
+	status.LiveSpecHash = live.Annotations[SpecHashAnnotation]
+	status.Diff, err = specDiff(desired.Spec, live.Spec)
+	if err != nil {
+		return nil, err
+	}
+	if status.LiveSpecHash != status.SpecHash {
+		status.Diff = append(status.Diff, "metadata.annotations."+SpecHashAnnotation)
+	}
+	status.InSync = len(status.Diff) == 0
+	return status, nil
+}
+
+// ApplyApplicationSet creates the ApplicationSet, or updates it when the live one differs from the desired one
+func ApplyApplicationSet(logger *zap.SugaredLogger, appSetClient applicationset.ApplicationSetServiceClient, desired *appv1alpha1.ApplicationSet) (*v1alpha1.ApplicationSetStatus, error) {
+	status, err := CompareApplicationSet(appSetClient, desired)
+	if err != nil {
+		return nil, err
+	}
+	if status.InSync {
+		logger.Infof("ApplicationSet '%s' is up to date", desired.Name)
+		return status, nil
+	}
+	logger.Infof("ApplicationSet '%s' differs from the App: %v", desired.Name, status.Diff)
+
+	err = retry.OnError(retry.DefaultRetry, errors.IsInternalError, func() error {
+		_, err := appSetClient.Create(context.Background(), &applicationset.ApplicationSetCreateRequest{
+			Applicationset: desired,
+			Upsert:         true,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Report what is live now, a field Argo CD rewrites would otherwise go unnoticed
+	return CompareApplicationSet(appSetClient, desired)
+}
+
+// specDiff returns the paths of the fields set in the desired spec whose live value differs.
+// Fields only the live spec sets, such as defaults filled in by Argo CD, are ignored.
+func specDiff(desired, live appv1alpha1.ApplicationSetSpec) ([]string, error) {
+	desiredFields, err := toFields(desired)
+	if err != nil {
+		return nil, err
+	}
+	liveFields, err := toFields(live)
+	if err != nil {
+		return nil, err
+	}
+
+	var diff []string
+	subsetDiff("spec", desiredFields, liveFields, &diff)
+	return diff, nil
+}
+
+// toFields converts a spec to its JSON representation
+func toFields(spec appv1alpha1.ApplicationSetSpec) (interface{}, error) {
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal ApplicationSet spec: %v", err)
+	}
+	var fields interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal ApplicationSet spec: %v", err)
+	}
+	return fields, nil
+}
+
+// subsetDiff appends to diff the paths under path where live does not hold the desired value
+func subsetDiff(path string, desired, live interface{}, diff *[]string) {
+	switch desiredValue := desired.(type) {
+	case map[string]interface{}:
+		liveValue, ok := live.(map[string]interface{})
+		if !ok {
+			if len(desiredValue) > 0 {
+				*diff = append(*diff, path)
+			}
+			return
+		}
+		keys := make([]string, 0, len(desiredValue))
+		for key := range desiredValue {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			subsetDiff(path+"."+key, desiredValue[key], liveValue[key], diff)
+		}
+	case []interface{}:
+		liveValue, ok := live.([]interface{})
+		if !ok || len(liveValue) != len(desiredValue) {
+			*diff = append(*diff, path)
+			return
+		}
+		for i := range desiredValue {
+			subsetDiff(fmt.Sprintf("%s[%d]", path, i), desiredValue[i], liveValue[i], diff)
+		}
+	default:
+		if !reflect.DeepEqual(desired, live) {
+			*diff = append(*diff, path)
+		}
+	}
+}
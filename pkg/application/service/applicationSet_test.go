@@ -0,0 +1,111 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	appv1alpha1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+)
+
+func TestSubsetDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		desired string
+		live    string
+		want    []string
+	}{
+		{
+			name:    "equal",
+			desired: `{"a": 1, "b": {"c": "x"}}`,
+			live:    `{"a": 1, "b": {"c": "x"}}`,
+		},
+		{
+			name:    "fields only live sets are ignored",
+			desired: `{"b": {"c": "x"}}`,
+			live:    `{"a": 1, "b": {"c": "x", "d": true}}`,
+		},
+		{
+			name:    "changed value",
+			desired: `{"a": 1, "b": {"c": "y"}}`,
+			live:    `{"a": 1, "b": {"c": "x"}}`,
+			want:    []string{"spec.b.c"},
+		},
+		{
+			name:    "missing live field",
+			desired: `{"a": 1, "b": "x"}`,
+			live:    `{"a": 1}`,
+			want:    []string{"spec.b"},
+		},
+		{
+			name:    "paths in key order",
+			desired: `{"z": 1, "a": 2}`,
+			live:    `{"z": 0, "a": 0}`,
+			want:    []string{"spec.a", "spec.z"},
+		},
+		{
+			name:    "list length",
+			desired: `{"generators": [{"clusters": {}}, {"git": {}}]}`,
+			live:    `{"generators": [{"clusters": {}}]}`,
+			want:    []string{"spec.generators"},
+		},
+		{
+			name:    "list item",
+			desired: `{"generators": [{"clusters": {"selector": "prod"}}]}`,
+			live:    `{"generators": [{"clusters": {"selector": "dev"}}]}`,
+			want:    []string{"spec.generators[0].clusters.selector"},
+		},
+		{
+			name:    "empty desired map",
+			desired: `{"syncPolicy": {}}`,
+			live:    `{}`,
+		},
+		{
+			name:    "map replaced by a scalar",
+			desired: `{"syncPolicy": {"preserve": true}}`,
+			live:    `{"syncPolicy": "none"}`,
+			want:    []string{"spec.syncPolicy"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var desired, live interface{}
+			if err := json.Unmarshal([]byte(tt.desired), &desired); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.live), &live); err != nil {
+				t.Fatal(err)
+			}
+			var diff []string
+			subsetDiff("spec", desired, live, &diff)
+			if !reflect.DeepEqual(diff, tt.want) {
+				t.Fatalf("subsetDiff() = %v, want %v", diff, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpecDiffIgnoresLiveDefaults(t *testing.T) {
+	desired := appv1alpha1.ApplicationSetSpec{GoTemplate: true}
+	desired.Template.Spec.Project = "default"
+
+	live := desired
+	live.Template.Spec.Source = &appv1alpha1.ApplicationSource{RepoURL: "https://github.com/alustan/cluster-manifests"}
+	diff, err := specDiff(desired, live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != 0 {
+		t.Fatalf("specDiff() = %v, want no difference", diff)
+	}
+
+	live.Template.Spec.Project = "other"
+	diff, err = specDiff(desired, live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(diff, []string{"spec.template.spec.project"}) {
+		t.Fatalf("specDiff() = %v, want [spec.template.spec.project]", diff)
+	}
+}
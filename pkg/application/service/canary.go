@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	application "github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	applicationset "github.com/argoproj/argo-cd/v2/pkg/apiclient/applicationset"
+	appv1alpha1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/alustan/alustan/api/app/v1alpha1"
+)
+
+const (
+	// CanaryAnnotation marks the Ingress of the canary release as a canary of the stable one
+	CanaryAnnotation = "nginx.ingress.kubernetes.io/canary"
+	// CanaryWeightAnnotation holds the percentage of the traffic the canary release receives
+	CanaryWeightAnnotation = "nginx.ingress.kubernetes.io/canary-weight"
+	// CanaryByHeaderAnnotation names the header routing a request to the canary release when set to always
+	CanaryByHeaderAnnotation = "nginx.ingress.kubernetes.io/canary-by-header"
+	// CanaryHeader is the header requests are routed to the canary release with, whatever its weight
+	CanaryHeader = "X-Alustan-Canary"
+)
+
+// canaryRelease selects the canary variant of the ApplicationSet and the share of the traffic it receives
+type canaryRelease struct {
+	weight int
+}
+
+// CanaryName returns the name of the canary variant of a resource of the App
+func CanaryName(name string) string {
+	return name + "-canary"
+}
+
+// DesiredCanaryApplicationSet renders the ApplicationSet of the canary release of the App,
+// running the tag and receiving the weight in percent of the traffic of the Ingress
+func DesiredCanaryApplicationSet(
+	logger *zap.SugaredLogger,
+	clientset kubernetes.Interface,
+	dynamicClient dynamic.Interface,
+	observed *v1alpha1.App,
+	secretName, key, tag string,
+	weight int,
+) (*appv1alpha1.ApplicationSet, error) {
+	if t := sourceType(observed.Spec.Source); t == SourceTypeKustomize || t == SourceTypeDirectory {
+		return nil, fmt.Errorf("strategy requires a Helm source, not %s", t)
+	}
+	return desiredApplicationSet(logger, clientset, dynamicClient, observed, secretName, key, tag, &canaryRelease{weight: weight})
+}
+
+// DeleteCanaryApplicationSet deletes the ApplicationSet of the canary release of the App, if any
+func DeleteCanaryApplicationSet(logger *zap.SugaredLogger, appSetClient applicationset.ApplicationSetServiceClient, observed *v1alpha1.App) error {
+	name := CanaryName(observed.ObjectMeta.Name)
+	_, err := appSetClient.Delete(context.Background(), &applicationset.ApplicationSetDeleteRequest{
+		Name: name,
+	})
+	if err != nil && grpcstatus.Code(err) != codes.NotFound {
+		return fmt.Errorf("failed to delete ApplicationSet %s: %v", name, err)
+	}
+	logger.Infof("Deleted canary ApplicationSet '%s'", name)
+	return nil
+}
+
+// GetApplicationHealth returns the health and sync status of an Application, Missing while it does not exist
+func GetApplicationHealth(appClient application.ApplicationServiceClient, appName string) (string, string, error) {
+	appNamespace := "argocd"
+	app, err := appClient.Get(context.Background(), &application.ApplicationQuery{
+		Name:         &appName,
+		AppNamespace: &appNamespace,
+	})
+	if err != nil {
+		if grpcstatus.Code(err) == codes.NotFound {
+			return "Missing", "", nil
+		}
+		return "", "", fmt.Errorf("failed to get application %s: %v", appName, err)
+	}
+	return string(app.Status.Health.Status), string(app.Status.Sync.Status), nil
+}
+
+// GeneratedApplications returns the Applications the ApplicationSet generated, the ones it controls
+func GeneratedApplications(appClient application.ApplicationServiceClient, appSetName string) ([]appv1alpha1.Application, error) {
+	appNamespace := "argocd"
+	appList, err := appClient.List(context.Background(), &application.ApplicationQuery{
+		AppNamespace: &appNamespace,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list applications: %v", err)
+	}
+
+	var apps []appv1alpha1.Application
+	for _, app := range appList.Items {
+		owner := metav1.GetControllerOf(&app)
+		if owner != nil && owner.Kind == "ApplicationSet" && owner.Name == appSetName {
+			apps = append(apps, app)
+		}
+	}
+	return apps, nil
+}
+
+// canaryValues routes the weight of the traffic of the Ingress to the canary release with the NGINX
+// canary annotations, and renames the release resources when the values pin their names
+func canaryValues(values map[string]interface{}, weight int) (map[string]interface{}, error) {
+	ingress, ok := values["ingress"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("strategy requires ingress values to split the traffic")
+	}
+	if enabled, ok := ingress["enabled"].(bool); ok && !enabled {
+		return nil, fmt.Errorf("strategy requires the ingress to be enabled")
+	}
+
+	annotations := make(map[string]interface{})
+	if existing, ok := ingress["annotations"].(map[string]interface{}); ok {
+		for key, value := range existing {
+			annotations[key] = value
+		}
+	}
+	annotations[CanaryAnnotation] = "true"
+	annotations[CanaryWeightAnnotation] = strconv.Itoa(weight)
+	annotations[CanaryByHeaderAnnotation] = CanaryHeader
+	ingress["annotations"] = annotations
+
+	if fullname, ok := values["fullnameOverride"].(string); ok && fullname != "" {
+		values["fullnameOverride"] = CanaryName(fullname)
+	}
+	return values, nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCanaryValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  string
+		weight  int
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "weight annotations",
+			values: "ingress:\n  enabled: true\n  annotations:\n    kubernetes.io/ingress.class: nginx",
+			weight: 20,
+			want: `{"ingress": {"enabled": true, "annotations": {
+				"kubernetes.io/ingress.class": "nginx",
+				"nginx.ingress.kubernetes.io/canary": "true",
+				"nginx.ingress.kubernetes.io/canary-weight": "20",
+				"nginx.ingress.kubernetes.io/canary-by-header": "X-Alustan-Canary"}}}`,
+		},
+		{
+			name:   "blue green preview without traffic",
+			values: "ingress:\n  hosts: [web.example.com]",
+			weight: 0,
+			want: `{"ingress": {"hosts": ["web.example.com"], "annotations": {
+				"nginx.ingress.kubernetes.io/canary": "true",
+				"nginx.ingress.kubernetes.io/canary-weight": "0",
+				"nginx.ingress.kubernetes.io/canary-by-header": "X-Alustan-Canary"}}}`,
+		},
+		{
+			name:   "pinned release name",
+			values: "fullnameOverride: web\ningress:\n  enabled: true",
+			weight: 100,
+			want: `{"fullnameOverride": "web-canary", "ingress": {"enabled": true, "annotations": {
+				"nginx.ingress.kubernetes.io/canary": "true",
+				"nginx.ingress.kubernetes.io/canary-weight": "100",
+				"nginx.ingress.kubernetes.io/canary-by-header": "X-Alustan-Canary"}}}`,
+		},
+		{
+			name:    "no ingress",
+			values:  "replicaCount: 2",
+			wantErr: true,
+		},
+		{
+			name:    "ingress disabled",
+			values:  "ingress:\n  enabled: false",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := parseValues([]byte(tt.values))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := canaryValues(values, tt.weight)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("canaryValues() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			want, err := parseValues([]byte(tt.want))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("canaryValues() = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestOwnedByTerraform(t *testing.T) {
+	controller := true
+	owner := func(kind, name, uid string, isController bool) metav1.OwnerReference {
+		ref := metav1.OwnerReference{APIVersion: "alustan.io/v1alpha1", Kind: kind, Name: name, UID: types.UID("uid-" + uid)}
+		if isController {
+			ref.Controller = &controller
+		}
+		return ref
+	}
+
+	tests := []struct {
+		name   string
+		owners []metav1.OwnerReference
+		want   bool
+	}{
+		{
+			name:   "owned by the resource",
+			owners: []metav1.OwnerReference{owner("Terraform", "database", "1", true)},
+			want:   true,
+		},
+		{
+			name: "no owner",
+		},
+		{
+			name:   "another resource with the same name",
+			owners: []metav1.OwnerReference{owner("Terraform", "database", "2", true)},
+		},
+		{
+			name:   "another resource",
+			owners: []metav1.OwnerReference{owner("Terraform", "network", "1", true)},
+		},
+		{
+			name:   "not the controller",
+			owners: []metav1.OwnerReference{owner("Terraform", "database", "1", false)},
+		},
+		{
+			name:   "another kind",
+			owners: []metav1.OwnerReference{owner("App", "database", "1", true)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{OwnerReferences: tt.owners}}
+			if got := ownedByTerraform(secret, "database", "uid-1"); got != tt.want {
+				t.Fatalf("ownedByTerraform() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSensitivePlaceholder(t *testing.T) {
+	sensitiveOutputs := map[string]string{"db_password": "hunter2", "api_token": "abc", "endpoint": "secret.local"}
+	annotations := map[string]string{"endpoint": "db.local", "region": "eu-west-1"}
+
+	tests := []struct {
+		name   string
+		values map[string]interface{}
+		want   string
+	}{
+		{
+			name:   "public outputs only",
+			values: map[string]interface{}{"region": "{{.region}}"},
+		},
+		{
+			name:   "sensitive output",
+			values: map[string]interface{}{"db": map[string]interface{}{"password": "{{.db_password}}"}},
+			want:   "db_password",
+		},
+		{
+			name:   "sensitive output in a list",
+			values: map[string]interface{}{"env": []interface{}{"TOKEN={{ .api_token }}"}},
+			want:   "api_token",
+		},
+		{
+			name:   "first in name order",
+			values: map[string]interface{}{"a": "{{.db_password}}", "b": "{{.api_token}}"},
+			want:   "api_token",
+		},
+		{
+			name:   "cluster secret key of the same name",
+			values: map[string]interface{}{"host": "{{.endpoint}}"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sensitivePlaceholder(tt.values, sensitiveOutputs, annotations); got != tt.want {
+				t.Fatalf("sensitivePlaceholder() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	appv1alpha1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+
+	"github.com/alustan/alustan/api/app/v1alpha1"
+)
+
+const (
+	// SourceTypeHelm renders a Helm chart from a path of a git repository
+	SourceTypeHelm = "Helm"
+	// SourceTypeHelmRepository renders a chart published to a Helm chart repository
+	SourceTypeHelmRepository = "HelmRepository"
+	// SourceTypeOCI renders a chart published to an OCI registry
+	SourceTypeOCI = "OCI"
+	// SourceTypeKustomize builds a Kustomize directory of a git repository
+	SourceTypeKustomize = "Kustomize"
+	// SourceTypeDirectory applies the plain manifests of a directory of a git repository
+	SourceTypeDirectory = "Directory"
+)
+
+// sourceType returns the type of the source, a Helm chart in git unless set
+func sourceType(source v1alpha1.SourceSpec) string {
+	if source.Type == "" {
+		return SourceTypeHelm
+	}
+	return source.Type
+}
+
+// applicationSource maps the App source to the Argo CD source of its type
+func applicationSource(source v1alpha1.SourceSpec, imageName, helmValues, latestTag string) (*appv1alpha1.ApplicationSource, error) {
+	if source.RepoURL == "" {
+		return nil, fmt.Errorf("source repoURL is missing")
+	}
+
+	switch sourceType(source) {
+	case SourceTypeHelm:
+		if source.Path == "" {
+			return nil, fmt.Errorf("source path is missing")
+		}
+		return &appv1alpha1.ApplicationSource{
+			RepoURL:        source.RepoURL,
+			Path:           source.Path,
+			TargetRevision: source.TargetRevision,
+			Helm: &appv1alpha1.ApplicationSourceHelm{
+				ReleaseName: source.ReleaseName,
+				Values:      helmValues,
+			},
+		}, nil
+
+	case SourceTypeHelmRepository, SourceTypeOCI:
+		if source.Chart == "" {
+			return nil, fmt.Errorf("source chart is missing")
+		}
+		if source.Path != "" {
+			return nil, fmt.Errorf("source path is not supported with %s, the chart is read from the repository", source.Type)
+		}
+		version := source.Version
+		if version == "" {
+			version = source.TargetRevision
+		}
+		if version == "" {
+			return nil, fmt.Errorf("source version of chart %s is missing", source.Chart)
+		}
+		repoURL := source.RepoURL
+		if source.Type == SourceTypeOCI {
+			// Argo CD expects OCI registries without a scheme
+			repoURL = strings.TrimPrefix(repoURL, "oci://")
+		}
+		return &appv1alpha1.ApplicationSource{
+			RepoURL:        repoURL,
+			Chart:          source.Chart,
+			TargetRevision: version,
+			Helm: &appv1alpha1.ApplicationSourceHelm{
+				ReleaseName: source.ReleaseName,
+				Values:      helmValues,
+			},
+		}, nil
+
+	case SourceTypeKustomize:
+		if err := plainSource(source); err != nil {
+			return nil, err
+		}
+		return &appv1alpha1.ApplicationSource{
+			RepoURL:        source.RepoURL,
+			Path:           source.Path,
+			TargetRevision: source.TargetRevision,
+			Kustomize:      kustomizeSource(source.Kustomize, imageName, latestTag),
+		}, nil
+
+	case SourceTypeDirectory:
+		if err := plainSource(source); err != nil {
+			return nil, err
+		}
+		directory := &appv1alpha1.ApplicationSourceDirectory{}
+		if source.Directory != nil {
+			directory.Recurse = source.Directory.Recurse
+			directory.Include = source.Directory.Include
+			directory.Exclude = source.Directory.Exclude
+		}
+		return &appv1alpha1.ApplicationSource{
+			RepoURL:        source.RepoURL,
+			Path:           source.Path,
+			TargetRevision: source.TargetRevision,
+			Directory:      directory,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown source type %s", source.Type)
+	}
+}
+
+// plainSource validates a source rendered without Helm
+func plainSource(source v1alpha1.SourceSpec) error {
+	if source.Path == "" {
+		return fmt.Errorf("source path is missing")
+	}
+	if len(source.Values) > 0 || len(source.ValueFiles) > 0 || len(source.ValuesFrom) > 0 || source.Chart != "" {
+		return fmt.Errorf("source values, valueFiles, valuesFrom and chart are only supported with Helm sources, not %s", source.Type)
+	}
+	return nil
+}
+
+// kustomizeSource maps the Kustomize overrides, pinning the image of the App to the latest tag
+func kustomizeSource(kustomize *v1alpha1.KustomizeSource, imageName, latestTag string) *appv1alpha1.ApplicationSourceKustomize {
+	out := &appv1alpha1.ApplicationSourceKustomize{}
+	if kustomize != nil {
+		out.NamePrefix = kustomize.NamePrefix
+		out.NameSuffix = kustomize.NameSuffix
+		for _, image := range kustomize.Images {
+			// The App image is set below with the latest tag
+			if imageName != "" && kustomizeImageName(image) == imageName {
+				continue
+			}
+			out.Images = append(out.Images, appv1alpha1.KustomizeImage(image))
+		}
+		for _, patch := range kustomize.Patches {
+			kustomizePatch := appv1alpha1.KustomizePatch{Patch: patch.Patch}
+			if target := patch.Target; target != nil {
+				kustomizePatch.Target = &appv1alpha1.KustomizeSelector{
+					KustomizeResId: appv1alpha1.KustomizeResId{
+						KustomizeGvk: appv1alpha1.KustomizeGvk{
+							Group:   target.Group,
+							Version: target.Version,
+							Kind:    target.Kind,
+						},
+						Name:      target.Name,
+						Namespace: target.Namespace,
+					},
+					LabelSelector:      target.LabelSelector,
+					AnnotationSelector: target.AnnotationSelector,
+				}
+			}
+			out.Patches = append(out.Patches, kustomizePatch)
+		}
+	}
+	if imageName != "" && latestTag != "" {
+		out.Images = append(out.Images, appv1alpha1.KustomizeImage(fmt.Sprintf("%s:%s", imageName, latestTag)))
+	}
+	return out
+}
+
+// kustomizeImageName returns the name of the image a Kustomize image override applies to
+func kustomizeImageName(image string) string {
+	if name, _, found := strings.Cut(image, "="); found {
+		return name
+	}
+	if at := strings.Index(image, "@"); at >= 0 {
+		return image[:at]
+	}
+	if colon := strings.LastIndex(image, ":"); colon > strings.LastIndex(image, "/") {
+		return image[:colon]
+	}
+	return image
+}
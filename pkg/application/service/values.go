@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+
+	"github.com/alustan/alustan/api/app/v1alpha1"
+	kubernetespkg "github.com/alustan/alustan/pkg/application/kubernetes"
+	"github.com/alustan/alustan/pkg/gitrepo"
+)
+
+// valuesRefPrefix marks the value files read from the valuesRef repository
+const valuesRefPrefix = "$values/"
+
+// defaultValuesKey is the ConfigMap or Secret key values are read from when none is set
+const defaultValuesKey = "values.yaml"
+
+// sourceValues merges the Helm values of the App, each layer overriding the previous one:
+// the valueFiles in order, then the valuesFrom in order, then the inline values.
+// Placeholders and image tags are replaced afterwards, so they apply to every layer.
+func sourceValues(clientset kubernetes.Interface, observed *v1alpha1.App) (map[string]interface{}, error) {
+	source := observed.Spec.Source
+	merged := make(map[string]interface{})
+	if t := sourceType(source); t == SourceTypeKustomize || t == SourceTypeDirectory {
+		// Sources rendered without Helm take no values
+		return merged, plainSource(source)
+	}
+
+	files, err := readValueFiles(clientset, source)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range source.ValueFiles {
+		values, err := parseValues(files[file])
+		if err != nil {
+			return nil, fmt.Errorf("value file %s: %v", file, err)
+		}
+		mergeValues(merged, values)
+	}
+
+	for _, from := range source.ValuesFrom {
+		content, found, err := readValuesFrom(clientset, observed.ObjectMeta.Namespace, from)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+		values, err := parseValues(content)
+		if err != nil {
+			return nil, fmt.Errorf("values of %s %s: %v", from.Kind, from.Name, err)
+		}
+		mergeValues(merged, values)
+	}
+
+	inline, err := convertRawExtensionsToInterface(source.Values)
+	if err != nil {
+		return nil, err
+	}
+	mergeValues(merged, inline)
+
+	return merged, nil
+}
+
+// readValueFiles reads the value files of the source repository and of the valuesRef repository,
+// keyed by their path in spec.source.valueFiles
+func readValueFiles(clientset kubernetes.Interface, source v1alpha1.SourceSpec) (map[string][]byte, error) {
+	files := make(map[string][]byte, len(source.ValueFiles))
+	if len(source.ValueFiles) == 0 {
+		return files, nil
+	}
+
+	var sourcePaths, refPaths []string
+	repoPaths := make(map[string]string, len(source.ValueFiles))
+	for _, file := range source.ValueFiles {
+		if strings.HasPrefix(file, valuesRefPrefix) {
+			if source.ValuesRef == nil {
+				return nil, fmt.Errorf("value file %s refers to $values but valuesRef is not set", file)
+			}
+			repoPath, err := repositoryPath("", strings.TrimPrefix(file, valuesRefPrefix))
+			if err != nil {
+				return nil, fmt.Errorf("value file %s: %v", file, err)
+			}
+			repoPaths[file] = repoPath
+			refPaths = append(refPaths, repoPath)
+			continue
+		}
+		if sourceType(source) != SourceTypeHelm {
+			// The chart of a Helm or OCI repository is not a git repository the files could be read from
+			return nil, fmt.Errorf("value file %s of a %s source must be read from valuesRef, prefixed with %s", file, sourceType(source), valuesRefPrefix)
+		}
+		repoPath, err := repositoryPath(source.Path, file)
+		if err != nil {
+			return nil, fmt.Errorf("value file %s: %v", file, err)
+		}
+		repoPaths[file] = repoPath
+		sourcePaths = append(sourcePaths, repoPath)
+	}
+
+	read := func(url, revision string, paths []string) (map[string][]byte, error) {
+		if len(paths) == 0 {
+			return nil, nil
+		}
+		username, password, err := kubernetespkg.RepositoryCredentials(clientset, "argocd", url)
+		if err != nil {
+			return nil, err
+		}
+		return gitrepo.ReadFiles(url, revision, username, password, paths)
+	}
+
+	sourceFiles, err := read(source.RepoURL, source.TargetRevision, sourcePaths)
+	if err != nil {
+		return nil, err
+	}
+	var refFiles map[string][]byte
+	if source.ValuesRef != nil {
+		refFiles, err = read(source.ValuesRef.RepoURL, source.ValuesRef.TargetRevision, refPaths)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, file := range source.ValueFiles {
+		if strings.HasPrefix(file, valuesRefPrefix) {
+			files[file] = refFiles[repoPaths[file]]
+		} else {
+			files[file] = sourceFiles[repoPaths[file]]
+		}
+	}
+	return files, nil
+}
+
+// repositoryPath returns the path of a file relative to a directory of the repository,
+// which must not leave the repository
+func repositoryPath(dir, file string) (string, error) {
+	joined := path.Clean(path.Join(dir, file))
+	if joined == ".." || strings.HasPrefix(joined, "../") {
+		return "", fmt.Errorf("path is outside the repository")
+	}
+	return strings.TrimPrefix(joined, "/"), nil
+}
+
+// readValuesFrom returns the values held by a ConfigMap or Secret key of the App namespace.
+// Found is false when an optional reference does not exist.
+func readValuesFrom(clientset kubernetes.Interface, namespace string, from v1alpha1.ValuesFromSource) ([]byte, bool, error) {
+	key := from.Key
+	if key == "" {
+		key = defaultValuesKey
+	}
+
+	var data map[string][]byte
+	var err error
+	switch from.Kind {
+	case "ConfigMap":
+		configMap, getErr := clientset.CoreV1().ConfigMaps(namespace).Get(context.TODO(), from.Name, metav1.GetOptions{})
+		if err = getErr; err == nil {
+			data = make(map[string][]byte, len(configMap.Data))
+			for k, v := range configMap.Data {
+				data[k] = []byte(v)
+			}
+		}
+	case "Secret":
+		secret, getErr := clientset.CoreV1().Secrets(namespace).Get(context.TODO(), from.Name, metav1.GetOptions{})
+		if err = getErr; err == nil {
+			data = secret.Data
+		}
+	default:
+		return nil, false, fmt.Errorf("valuesFrom kind %s is not supported, use ConfigMap or Secret", from.Kind)
+	}
+
+	if err != nil {
+		if errors.IsNotFound(err) && from.Optional {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to get %s %s: %v", from.Kind, from.Name, err)
+	}
+	content, ok := data[key]
+	if !ok {
+		if from.Optional {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("%s %s has no key %s", from.Kind, from.Name, key)
+	}
+	return content, true, nil
+}
+
+// parseValues parses a YAML or JSON values document
+func parseValues(content []byte) (map[string]interface{}, error) {
+	raw, err := yaml.YAMLToJSON(content)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, fmt.Errorf("values must be a map: %v", err)
+	}
+	return values, nil
+}
+
+// mergeValues merges src into dst the way Helm merges values files:
+// maps are merged recursively, other values replace the previous ones and null removes a key
+func mergeValues(dst, src map[string]interface{}) {
+	for key, value := range src {
+		if value == nil {
+			delete(dst, key)
+			continue
+		}
+		if srcMap, ok := value.(map[string]interface{}); ok {
+			if dstMap, ok := dst[key].(map[string]interface{}); ok {
+				mergeValues(dstMap, srcMap)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		layers []string
+		want   map[string]interface{}
+	}{
+		{
+			name:   "later layer overrides",
+			layers: []string{"replicaCount: 1", "replicaCount: 3"},
+			want:   map[string]interface{}{"replicaCount": float64(3)},
+		},
+		{
+			name:   "maps merge key by key",
+			layers: []string{"image:\n  repository: web\n  tag: v1", "image:\n  tag: v2"},
+			want:   map[string]interface{}{"image": map[string]interface{}{"repository": "web", "tag": "v2"}},
+		},
+		{
+			name:   "null removes a key",
+			layers: []string{"resources:\n  limits:\n    cpu: 1\nreplicaCount: 1", "resources: null"},
+			want:   map[string]interface{}{"replicaCount": float64(1)},
+		},
+		{
+			name:   "lists are replaced",
+			layers: []string{"hosts: [a, b]", "hosts: [c]"},
+			want:   map[string]interface{}{"hosts": []interface{}{"c"}},
+		},
+		{
+			name:   "a map replaces a scalar",
+			layers: []string{"ingress: false", `{"ingress": {"enabled": true}}`},
+			want:   map[string]interface{}{"ingress": map[string]interface{}{"enabled": true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := make(map[string]interface{})
+			for _, layer := range tt.layers {
+				values, err := parseValues([]byte(layer))
+				if err != nil {
+					t.Fatalf("parseValues(%q) error = %v", layer, err)
+				}
+				mergeValues(merged, values)
+			}
+			if !reflect.DeepEqual(merged, tt.want) {
+				t.Fatalf("merged = %v, want %v", merged, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseValuesRejectsNonMap(t *testing.T) {
+	for _, content := range []string{"- a\n- b", "just a string", "key: [unclosed"} {
+		if _, err := parseValues([]byte(content)); err == nil {
+			t.Fatalf("parseValues(%q) succeeded", content)
+		}
+	}
+}
+
+func TestRepositoryPath(t *testing.T) {
+	tests := []struct {
+		dir     string
+		file    string
+		want    string
+		wantErr bool
+	}{
+		{dir: "charts/web", file: "values-prod.yaml", want: "charts/web/values-prod.yaml"},
+		{dir: "charts/web", file: "../common/values.yaml", want: "charts/common/values.yaml"},
+		{dir: "", file: "web/prod.yaml", want: "web/prod.yaml"},
+		{dir: "/charts", file: "values.yaml", want: "charts/values.yaml"},
+		{dir: "charts", file: "../../secrets.yaml", wantErr: true},
+		{dir: "", file: "../outside.yaml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dir+"+"+tt.file, func(t *testing.T) {
+			got, err := repositoryPath(tt.dir, tt.file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("repositoryPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("repositoryPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package containers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// CancelledAnnotation marks a runner Job suspended to cancel its run
+	CancelledAnnotation = "alustan.io/cancelled"
+
+	// stopGracePeriodSeconds is how long an interrupted runner has to release its state lock and exit
+	stopGracePeriodSeconds int64 = 300
+
+	runnerStopPollInterval = 2 * time.Second
+)
+
+// ErrRunCancelled is returned when a runner Job was cancelled before it finished
+var ErrRunCancelled = errors.New("run cancelled")
+
+// interruptRunner is the preStop hook of the runner. Deleting the pod, on cancellation or when the Job
+// deadline passes, sends SIGINT to every process but PID 1 so terraform stops gracefully and releases its
+// state lock; the hook then waits for the container to exit within the grace period.
+var interruptRunner = &v1.Lifecycle{
+	PreStop: &v1.LifecycleHandler{
+		Exec: &v1.ExecAction{
+			Command: []string{"/bin/sh", "-c", "kill -INT -1 2>/dev/null; kill -INT 1 2>/dev/null; while true; do sleep 1; done"},
+		},
+	},
+}
+
+// CancelRunJobs suspends the unfinished runner Jobs of a Terraform resource. The Job controller then
+// deletes their pods, which interrupts the runners. It returns the names of the cancelled Jobs.
+func CancelRunJobs(logger *zap.SugaredLogger, clientset kubernetes.Interface, namespace, name string) ([]string, error) {
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", TerraformLabel, name),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}},"spec":{"suspend":true}}`, CancelledAnnotation, time.Now().UTC().Format(time.RFC3339)))
+
+	var cancelled []string
+	for _, job := range jobs.Items {
+		if isJobFinished(&job) || job.Annotations[CancelledAnnotation] != "" {
+			continue
+		}
+
+		_, err := clientset.BatchV1().Jobs(namespace).Patch(context.Background(), job.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			logger.Infof("Failed to cancel runner Job %s: %v", job.Name, err)
+			return cancelled, err
+		}
+		logger.Infof("Cancelled runner Job %s", job.Name)
+		cancelled = append(cancelled, job.Name)
+	}
+
+	return cancelled, nil
+}
+
+// waitForRunnerStop waits until no pod of the Job is still running
+func waitForRunnerStop(ctx context.Context, clientset kubernetes.Interface, namespace, jobName string) error {
+	ticker := time.NewTicker(runnerStopPollInterval)
+	defer ticker.Stop()
+
+	for {
+		pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("job-name=%s", jobName),
+		})
+		if err != nil {
+			return err
+		}
+
+		running := false
+		for _, pod := range pods.Items {
+			if pod.Status.Phase == v1.PodPending || pod.Status.Phase == v1.PodRunning {
+				running = true
+				break
+			}
+		}
+		if !running {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,48 +1,87 @@
-package containers
-
-
-import (
-    "context"
-    
-  
-    "go.uber.org/zap"
-   v1 "k8s.io/api/core/v1"
-    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-   "k8s.io/apimachinery/pkg/api/resource"
-    "k8s.io/client-go/kubernetes"
-)
-
-// EnsurePVC ensures that the specified Persistent Volume Claim exists.
-func EnsurePVC(logger *zap.SugaredLogger,clientset  kubernetes.Interface, namespace, pvcName string) error {
-    pvc, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Get(context.Background(), pvcName, metav1.GetOptions{})
-    if err == nil && pvc != nil {
-        logger.Infof("PVC %s already exists in namespace %s", pvcName, namespace)
-        return nil
-    }
-
-    logger.Infof("Creating PVC %s in namespace %s", pvcName, namespace)
-    pvc = &v1.PersistentVolumeClaim{
-        ObjectMeta: metav1.ObjectMeta{
-            Name: pvcName,
-        },
-        Spec: v1.PersistentVolumeClaimSpec{
-            AccessModes: []v1.PersistentVolumeAccessMode{
-                v1.ReadWriteOnce,
-            },
-            Resources: v1.ResourceRequirements{
-                Requests: v1.ResourceList{
-                    v1.ResourceStorage: resource.MustParse("5Gi"),
-                },
-            },
-        },
-    }
-    
-    _, err = clientset.CoreV1().PersistentVolumeClaims(namespace).Create(context.Background(), pvc, metav1.CreateOptions{})
-    if err != nil {
-        logger.Infof("Failed to create PVC: %v", err)
-        return err
-    }
-
-    logger.Info("PVC created successfully.")
-    return nil
-}
\ No newline at end of file
+package containers
+
+
+import (
+    "context"
+    
+  
+    "go.uber.org/zap"
+   v1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+   "k8s.io/apimachinery/pkg/api/resource"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    "k8s.io/client-go/kubernetes"
+)
+
+// PVCSettings holds the size, storage class and access mode of a Persistent Volume Claim
+type PVCSettings struct {
+    Size             string
+    StorageClassName string
+    AccessMode       v1.PersistentVolumeAccessMode
+}
+
+// EnsurePVC ensures that the specified Persistent Volume Claim exists.
+// Empty settings default to a 5Gi ReadWriteOnce claim of the default storage class.
+func EnsurePVC(logger *zap.SugaredLogger,clientset  kubernetes.Interface, namespace, pvcName string, settings PVCSettings) error {
+    pvc, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Get(context.Background(), pvcName, metav1.GetOptions{})
+    if err == nil && pvc != nil {
+        logger.Infof("PVC %s already exists in namespace %s", pvcName, namespace)
+        return nil
+    }
+
+    size := settings.Size
+    if size == "" {
+        size = "5Gi"
+    }
+    quantity, err := resource.ParseQuantity(size)
+    if err != nil {
+        logger.Infof("Invalid PVC size %s: %v", size, err)
+        return err
+    }
+
+    accessMode := settings.AccessMode
+    if accessMode == "" {
+        accessMode = v1.ReadWriteOnce
+    }
+
+    logger.Infof("Creating PVC %s in namespace %s", pvcName, namespace)
+    pvc = &v1.PersistentVolumeClaim{
+        ObjectMeta: metav1.ObjectMeta{
+            Name: pvcName,
+        },
+        Spec: v1.PersistentVolumeClaimSpec{
+            AccessModes: []v1.PersistentVolumeAccessMode{
+                accessMode,
+            },
+            Resources: v1.ResourceRequirements{
+                Requests: v1.ResourceList{
+                    v1.ResourceStorage: quantity,
+                },
+            },
+        },
+    }
+    if settings.StorageClassName != "" {
+        pvc.Spec.StorageClassName = &settings.StorageClassName
+    }
+    
+    _, err = clientset.CoreV1().PersistentVolumeClaims(namespace).Create(context.Background(), pvc, metav1.CreateOptions{})
+    if err != nil {
+        logger.Infof("Failed to create PVC: %v", err)
+        return err
+    }
+
+    logger.Info("PVC created successfully.")
+    return nil
+}
+
+// DeletePVC deletes the specified Persistent Volume Claim if it exists.
+func DeletePVC(logger *zap.SugaredLogger, clientset kubernetes.Interface, namespace, pvcName string) error {
+    err := clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(context.Background(), pvcName, metav1.DeleteOptions{})
+    if err != nil && !apierrors.IsNotFound(err) {
+        logger.Infof("Failed to delete PVC %s: %v", pvcName, err)
+        return err
+    }
+
+    logger.Infof("PVC %s deleted or already absent in namespace %s", pvcName, namespace)
+    return nil
+}
@@ -1,82 +1,197 @@
-package containers
-
-import (
-	"context"
-	"encoding/json"
-	"fmt"
-	"io"
-	"time"
-
-	"go.uber.org/zap"
-	CoreV1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-)
-
-// ExtractPostDeployOutput retrieves and parses the outputs from a pod's log
-func ExtractPostDeployOutput(logger *zap.SugaredLogger, clientset kubernetes.Interface, namespace, podName string) (map[string]interface{}, error) {
-	for {
-		// Retrieve the current state of the pod
-		pod, err := clientset.CoreV1().Pods(namespace).Get(context.Background(), podName, metav1.GetOptions{})
-		if err != nil {
-			return nil, err
-		}
-
-		// Log the current pod phase
-		logger.Infof("Pod %s is in phase %s", podName, pod.Status.Phase)
-
-		// Check if the pod has succeeded
-		if pod.Status.Phase == CoreV1.PodSucceeded {
-			logger.Infof("Pod %s has succeeded", podName)
-			break
-		}
-
-		// Check if the pod has failed
-		if pod.Status.Phase == CoreV1.PodFailed {
-			logger.Infof("Pod %s has failed", podName)
-			return nil, fmt.Errorf("pod %s failed", podName)
-		}
-
-		// Sleep for 1 minute before checking again
-		time.Sleep(1 * time.Minute)
-	}
-
-	// Retrieve the pod logs
-	req := clientset.CoreV1().Pods(namespace).GetLogs(podName, &CoreV1.PodLogOptions{})
-	logs, err := req.Stream(context.Background())
-	if err != nil {
-		return nil, err
-	}
-	defer logs.Close()
-
-	// Read the logs
-	logsBytes, err := io.ReadAll(logs)
-	if err != nil {
-		return nil, err
-	}
-
-	// Unmarshal the logs into a generic map
-	var logOutput map[string]interface{}
-	if err := json.Unmarshal(logsBytes, &logOutput); err != nil {
-		return nil, err
-	}
-
-	// Extract the "outputs" field
-	outputs, ok := logOutput["outputs"].(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("outputs field not found or invalid format")
-	}
-
-	// Convert outputs to expected object format
-	postDeployOutput := make(map[string]interface{})
-	for key, value := range outputs {
-		postDeployOutput[key] = map[string]interface{}{
-			"value": value,
-		}
-	}
-
-	// Log the final outputs
-	logger.Infof("Final Outputs: %+v", postDeployOutput)
-
-	return postDeployOutput, nil
-}
+package containers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+const (
+	// OutputsDir is the memory backed volume the runner writes its outputs document to, only the controller reads it
+	OutputsDir = "/outputs"
+	// OutputsFile is where the runner writes its outputs document
+	OutputsFile = OutputsDir + "/outputs.json"
+	// OutputsContainer keeps the pod running until the controller has read the outputs document
+	OutputsContainer = "outputs"
+
+	// outputsCollected releases the outputs container once the document is read
+	outputsCollected = OutputsDir + "/.collected"
+	// outputsHoldSeconds bounds how long the outputs container waits for a controller that never collects
+	outputsHoldSeconds = 600
+)
+
+// outputsHoldScript runs in the outputs container, it waits for the controller to collect the document
+var outputsHoldScript = fmt.Sprintf(`trap 'exit 0' TERM; i=0; until [ -f %s ] || [ "$i" -ge %d ]; do if [ -f %s ]; then i=$((i+1)); fi; sleep 1; done`,
+	outputsCollected, outputsHoldSeconds, OutputsFile)
+
+// outputsCollectScript prints the outputs document, removes it and releases the outputs container
+var outputsCollectScript = fmt.Sprintf(`if [ -f %s ]; then cat %s; rm -f %s; fi; touch %s`,
+	OutputsFile, OutputsFile, OutputsFile, outputsCollected)
+
+// CollectJobOutputs waits for the runner container of a Job to stop and reads the outputs document
+// it wrote to OutputsFile through the outputs container. The document never leaves the pod any other way,
+// so sensitive outputs are not exposed to whoever can read pods or their logs. The outputs container is
+// released whether or not the runner succeeded.
+func CollectJobOutputs(ctx context.Context, logger *zap.SugaredLogger, clientset kubernetes.Interface, namespace, jobName string) ([]byte, error) {
+	var pod *v1.Pod
+	for {
+		if found, err := GetJobPod(clientset, namespace, jobName); err == nil && runnerStopped(found) {
+			pod = found
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(runnerStartPollInterval):
+		}
+	}
+
+	document, err := execInContainer(ctx, clientset, namespace, pod.Name, OutputsContainer, []string{"/bin/sh", "-c", outputsCollectScript})
+	if err != nil {
+		return nil, fmt.Errorf("reading the outputs of job %s: %v", jobName, err)
+	}
+
+	logger.Infof("Collected %d bytes of outputs from Job %s", len(document), jobName)
+	return bytes.TrimSpace(document), nil
+}
+
+// runnerStopped reports whether the runner container of the pod has terminated
+func runnerStopped(pod *v1.Pod) bool {
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if containerStatus.Name == "terraform" {
+			return containerStatus.State.Terminated != nil
+		}
+	}
+	return false
+}
+
+// execInContainer runs a command in a container of a pod and returns what it printed to stdout
+func execInContainer(ctx context.Context, clientset kubernetes.Interface, namespace, podName, container string, command []string) ([]byte, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	req := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("exec").
+		VersionedParams(&v1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := executor.StreamWithContext(ctx, remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr}); err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// GetJobOutputs returns the outputs document collected from a finished Job.
+// Runners that write no document may print {"outputs": ...} to the log instead,
+// either as their whole log or as a line of it.
+func GetJobOutputs(logger *zap.SugaredLogger, clientset kubernetes.Interface, namespace, jobName string, document []byte) ([]byte, error) {
+	if len(document) > 0 {
+		return document, nil
+	}
+
+	logger.Infof("Job %s wrote no outputs to %s, reading outputs from the log", jobName, OutputsFile)
+	logs, err := GetJobLogs(logger, clientset, namespace, jobName)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs, err := outputsFromLog(logs)
+	if err != nil {
+		return nil, fmt.Errorf("no outputs written to %s and %v", OutputsFile, err)
+	}
+	return outputs, nil
+}
+
+// outputsFromLog returns the outputs of a log that is an {"outputs": ...} document, or holds one on its own line.
+// The last such line wins.
+func outputsFromLog(logs string) (json.RawMessage, error) {
+	var logOutput struct {
+		Outputs json.RawMessage `json:"outputs"`
+	}
+	if err := json.Unmarshal([]byte(logs), &logOutput); err == nil && len(logOutput.Outputs) > 0 {
+		return logOutput.Outputs, nil
+	}
+
+	lines := strings.Split(logs, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		logOutput.Outputs = nil
+		if err := json.Unmarshal([]byte(line), &logOutput); err == nil && len(logOutput.Outputs) > 0 {
+			return logOutput.Outputs, nil
+		}
+	}
+
+	return nil, fmt.Errorf("the log holds no outputs document")
+}
+
+// ParseOutputs splits an outputs document, a JSON object, into its typed values.
+// Errors name the output whose value is invalid.
+func ParseOutputs(document []byte) (map[string]runtime.RawExtension, error) {
+	decoder := json.NewDecoder(bytes.NewReader(document))
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, fmt.Errorf("invalid outputs document: %v", err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("outputs document must be a JSON object")
+	}
+
+	outputs := make(map[string]runtime.RawExtension)
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("invalid outputs document: %v", err)
+		}
+		key := token.(string)
+
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, fmt.Errorf("output %s: invalid value: %v", key, err)
+		}
+		if _, exists := outputs[key]; exists {
+			return nil, fmt.Errorf("output %s: duplicate key", key)
+		}
+		outputs[key] = runtime.RawExtension{Raw: value}
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return nil, fmt.Errorf("invalid outputs document: %v", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid outputs document: unexpected data after the outputs object")
+	}
+
+	return outputs, nil
+}
@@ -0,0 +1,55 @@
+package containers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOutputsFromLog(t *testing.T) {
+	large := `{"kubeconfig":"` + strings.Repeat("a", 8192) + `"}`
+
+	tests := []struct {
+		name    string
+		logs    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "whole log",
+			logs: "{\n  \"outputs\": {\"endpoint\": \"db.local\"}\n}\n",
+			want: `{"endpoint": "db.local"}`,
+		},
+		{
+			name: "document line after the apply log",
+			logs: "Apply complete! Resources: 1 added.\n{\"outputs\":" + large + "}\n",
+			want: large,
+		},
+		{
+			name: "last document wins",
+			logs: `{"outputs":{"a":1}}` + "\n" + `{"outputs":{"a":2}}`,
+			want: `{"a":2}`,
+		},
+		{
+			name:    "other json",
+			logs:    `{"level":"info","msg":"applied"}`,
+			wantErr: true,
+		},
+		{
+			name:    "no document",
+			logs:    "Apply complete!",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := outputsFromLog(tt.logs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("outputsFromLog() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("outputsFromLog() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
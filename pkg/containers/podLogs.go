@@ -0,0 +1,57 @@
+package containers
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// GetJobPod returns the most recently created pod of a runner Job.
+func GetJobPod(clientset kubernetes.Interface, namespace, jobName string) (*v1.Pod, error) {
+	pods, err := clientset.CoreV1().Pods(namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("job-name=%s", jobName),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(pods.Items) == 0 {
+		return nil, fmt.Errorf("no pod found for job %s", jobName)
+	}
+
+	latest := &pods.Items[0]
+	for i := range pods.Items {
+		if pods.Items[i].CreationTimestamp.After(latest.CreationTimestamp.Time) {
+			latest = &pods.Items[i]
+		}
+	}
+
+	return latest, nil
+}
+
+// GetJobLogs returns the complete log of the runner container of a finished Job.
+func GetJobLogs(logger *zap.SugaredLogger, clientset kubernetes.Interface, namespace, jobName string) (string, error) {
+	pod, err := GetJobPod(clientset, namespace, jobName)
+	if err != nil {
+		return "", err
+	}
+
+	req := clientset.CoreV1().Pods(namespace).GetLogs(pod.Name, &v1.PodLogOptions{Container: "terraform"})
+	logs, err := req.Stream(context.Background())
+	if err != nil {
+		logger.Infof("Failed to stream logs of Pod %s: %v", pod.Name, err)
+		return "", err
+	}
+	defer logs.Close()
+
+	logsBytes, err := io.ReadAll(logs)
+	if err != nil {
+		return "", err
+	}
+
+	return string(logsBytes), nil
+}
@@ -0,0 +1,101 @@
+package containers
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// GetJobExitCode returns the exit code of the runner container, or nil if it has not terminated.
+func GetJobExitCode(clientset kubernetes.Interface, namespace, jobName string) (*int32, error) {
+	pod, err := GetJobPod(clientset, namespace, jobName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if containerStatus.Name == "terraform" && containerStatus.State.Terminated != nil {
+			exitCode := containerStatus.State.Terminated.ExitCode
+			return &exitCode, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// PruneRunJobs deletes the finished runner Jobs of a Terraform resource that are not listed in keep.
+func PruneRunJobs(logger *zap.SugaredLogger, clientset kubernetes.Interface, namespace, name string, keep map[string]bool) error {
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", TerraformLabel, name),
+	})
+	if err != nil {
+		return err
+	}
+
+	propagation := metav1.DeletePropagationBackground
+	for _, job := range jobs.Items {
+		if keep[job.Name] || !isJobFinished(&job) {
+			continue
+		}
+
+		err := clientset.BatchV1().Jobs(namespace).Delete(context.Background(), job.Name, metav1.DeleteOptions{
+			PropagationPolicy: &propagation,
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			logger.Infof("Failed to delete runner Job %s: %v", job.Name, err)
+			return err
+		}
+		logger.Infof("Deleted runner Job %s beyond the run history limit", job.Name)
+	}
+
+	return nil
+}
+
+// ActiveRunJobs returns the names of the runner Jobs of a Terraform resource that are still running.
+// A finished Job whose interrupted runner is still shutting down counts as running.
+func ActiveRunJobs(clientset kubernetes.Interface, namespace, name string) ([]string, error) {
+	selector := metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", TerraformLabel, name)}
+
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(context.Background(), selector)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := clientset.CoreV1().Pods(namespace).List(context.Background(), selector)
+	if err != nil {
+		return nil, err
+	}
+
+	running := make(map[string]bool, len(pods.Items))
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == v1.PodPending || pod.Status.Phase == v1.PodRunning {
+			running[pod.Labels["job-name"]] = true
+		}
+	}
+
+	var active []string
+	for _, job := range jobs.Items {
+		if !isJobFinished(&job) || running[job.Name] {
+			active = append(active, job.Name)
+		}
+	}
+	return active, nil
+}
+
+// isJobFinished reports whether the job has completed, failed or was cancelled and has no pod left running
+func isJobFinished(job *batchv1.Job) bool {
+	if job.Annotations[CancelledAnnotation] != "" && job.Status.Active == 0 {
+		return true
+	}
+	for _, condition := range job.Status.Conditions {
+		if (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) && condition.Status == v1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,289 @@
+package containers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+
+	"github.com/alustan/alustan/pkg/util"
+)
+
+const (
+	// TerraformLabel holds the name of the Terraform resource a runner Job belongs to
+	TerraformLabel = "alustan.io/terraform"
+	// RunPhaseLabel holds the phase a runner Job executes
+	RunPhaseLabel = "alustan.io/run-phase"
+)
+
+// outputsMount is where the runner and the outputs container share the outputs document
+var outputsMount = v1.VolumeMount{
+	Name:      "outputs",
+	MountPath: OutputsDir,
+}
+
+// ClaimMount mounts a Persistent Volume Claim, or a sub path of it, into the runner
+type ClaimMount struct {
+	ClaimName string
+	MountPath string
+	SubPath   string
+}
+
+// JobSettings holds the limits applied to a runner Job
+type JobSettings struct {
+	BackoffLimit            int32
+	ActiveDeadlineSeconds   int64
+	TTLSecondsAfterFinished *int32
+	// ServiceAccountName is the identity the runner pod runs as
+	ServiceAccountName string
+	// Command runs the script content as its last argument instead of the image entrypoint
+	Command []string
+	// PodTemplate is a JSON pod template strategically merged over the default runner pod
+	PodTemplate []byte
+	// CollectOutputs keeps the pod running after the runner until CollectJobOutputs read its outputs
+	CollectOutputs bool
+	// InitScript runs in an init container of the runner image, with the runner volumes, before the runner starts
+	InitScript string
+}
+
+// CreateRunJob creates a Kubernetes Job that runs a script with specified environment variables and image.
+// envSources are variables read from Secrets or ConfigMaps by the kubelet, so their values never pass through the controller.
+// volumeClaims lists existing PersistentVolumeClaims mounted into the runner.
+func CreateRunJob(logger *zap.SugaredLogger, clientset kubernetes.Interface, name, namespace, scriptName string, envVars map[string]string, envSources []v1.EnvVar, taggedImageName, imagePullSecretName, app string, volumeClaims []ClaimMount, settings JobSettings) (string, error) {
+	identifier := fmt.Sprintf("%s-%s", name, app)
+	// Every run gets its own Job so the logs of past runs are retained
+	jobName := fmt.Sprintf("%s-%s-%s", name, app, utilrand.String(5))
+
+	// Generate environment variables
+	env := []v1.EnvVar{}
+	for key, value := range envVars {
+		env = append(env, v1.EnvVar{
+			Name:  key,
+			Value: value,
+		})
+		if util.IsSensitiveVariable(key) {
+			logger.Infof("Setting environment variable %s=<redacted>", key)
+		} else {
+			logger.Infof("Setting environment variable %s=%s", key, value)
+		}
+	}
+
+	env = append(env, v1.EnvVar{
+		Name:  "OUTPUTS_FILE",
+		Value: OutputsFile,
+	})
+
+	// Sourced variables go before SCRIPT and ARGS so the args can reference them as $(NAME)
+	for _, source := range envSources {
+		env = append(env, source)
+		if source.ValueFrom != nil && source.ValueFrom.SecretKeyRef != nil {
+			logger.Infof("Setting environment variable %s from Secret %s", source.Name, source.ValueFrom.SecretKeyRef.Name)
+		} else if source.ValueFrom != nil && source.ValueFrom.ConfigMapKeyRef != nil {
+			logger.Infof("Setting environment variable %s from ConfigMap %s", source.Name, source.ValueFrom.ConfigMapKeyRef.Name)
+		}
+	}
+
+	// With a command the script content runs as is, otherwise the image runs $SCRIPT $ARGS
+	var command []string
+	if len(settings.Command) > 0 {
+		command = append(append([]string(nil), settings.Command...), scriptName)
+	} else {
+		// Ensure the scriptName starts with "./"
+		if !strings.HasPrefix(scriptName, "./") {
+			scriptName = "./" + scriptName
+		}
+
+		// Split the scriptName into script and args
+		parts := strings.SplitN(scriptName, " ", 2)
+		script := parts[0]
+		args := ""
+		if len(parts) > 1 {
+			args = parts[1]
+		}
+
+		env = append(env, v1.EnvVar{
+			Name:  "SCRIPT",
+			Value: script,
+		})
+
+		if args != "" {
+			env = append(env, v1.EnvVar{
+				Name:  "ARGS",
+				Value: args,
+			})
+		}
+	}
+
+	volumeMounts := []v1.VolumeMount{
+		{
+			Name:      "workspace",
+			MountPath: "/workspace",
+		},
+		outputsMount,
+	}
+	volumes := []v1.Volume{
+		{
+			Name: "workspace",
+			VolumeSource: v1.VolumeSource{
+				EmptyDir: &v1.EmptyDirVolumeSource{},
+			},
+		},
+		{
+			// Outputs stay in memory and are only read by the controller, never through the pod status or log
+			Name: outputsMount.Name,
+			VolumeSource: v1.VolumeSource{
+				EmptyDir: &v1.EmptyDirVolumeSource{Medium: v1.StorageMediumMemory},
+			},
+		},
+	}
+	claimVolumes := make(map[string]bool, len(volumeClaims))
+	for _, claim := range volumeClaims {
+		volumeMounts = append(volumeMounts, v1.VolumeMount{
+			Name:      claim.ClaimName,
+			MountPath: claim.MountPath,
+			SubPath:   claim.SubPath,
+		})
+		// A claim mounted at several paths still needs a single volume
+		if claimVolumes[claim.ClaimName] {
+			continue
+		}
+		claimVolumes[claim.ClaimName] = true
+		volumes = append(volumes, v1.Volume{
+			Name: claim.ClaimName,
+			VolumeSource: v1.VolumeSource{
+				PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{
+					ClaimName: claim.ClaimName,
+				},
+			},
+		})
+	}
+
+	gracePeriod := stopGracePeriodSeconds
+
+	// Define the pod spec
+	podSpec := v1.PodSpec{
+		ServiceAccountName: settings.ServiceAccountName,
+		Containers: []v1.Container{
+			{
+				Name:            "terraform",
+				Image:           taggedImageName,
+				ImagePullPolicy: v1.PullAlways,
+				Command:         command,
+				Env:             env,
+				VolumeMounts:    volumeMounts,
+				Lifecycle:       interruptRunner,
+			},
+		},
+		TerminationGracePeriodSeconds: &gracePeriod,
+		RestartPolicy: v1.RestartPolicyNever,
+		Volumes:       volumes,
+		ImagePullSecrets: []v1.LocalObjectReference{
+			{
+				Name: imagePullSecretName,
+			},
+		},
+	}
+
+	if settings.InitScript != "" {
+		podSpec.InitContainers = append(podSpec.InitContainers, v1.Container{
+			Name:            "prepare",
+			Image:           taggedImageName,
+			ImagePullPolicy: v1.PullAlways,
+			Command:         []string{"/bin/sh", "-c", settings.InitScript},
+			VolumeMounts:    volumeMounts,
+		})
+	}
+
+	if settings.CollectOutputs {
+		podSpec.Containers = append(podSpec.Containers, v1.Container{
+			Name:            OutputsContainer,
+			Image:           taggedImageName,
+			ImagePullPolicy: v1.PullIfNotPresent,
+			Command:         []string{"/bin/sh", "-c", outputsHoldScript},
+			VolumeMounts:    []v1.VolumeMount{outputsMount},
+		})
+	}
+
+	labels := map[string]string{
+		"apprun":       identifier,
+		TerraformLabel: name,
+		RunPhaseLabel:  app,
+	}
+
+	template, err := mergePodTemplate(v1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: labels,
+		},
+		Spec: podSpec,
+	}, settings.PodTemplate)
+	if err != nil {
+		logger.Infof("Failed to apply runner pod template: %v", err)
+		return "", err
+	}
+
+	// Define the job object
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   jobName,
+			Labels: labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &settings.BackoffLimit,
+			ActiveDeadlineSeconds:   &settings.ActiveDeadlineSeconds,
+			TTLSecondsAfterFinished: settings.TTLSecondsAfterFinished,
+			Template:                template,
+		},
+	}
+
+	// Create the job with the new spec
+	logger.Infof("Creating Job in namespace: %s with image: %s", namespace, taggedImageName)
+	_, err = clientset.BatchV1().Jobs(namespace).Create(context.Background(), job, metav1.CreateOptions{})
+	if err != nil {
+		logger.Infof("Failed to create Job: %v", err)
+		return "", err
+	}
+
+	logger.Infof("Job %s created successfully.", jobName)
+	return jobName, nil
+}
+
+// mergePodTemplate strategically merges the override over the default runner pod template.
+// The labels and restart policy the controller relies on cannot be overridden.
+func mergePodTemplate(defaults v1.PodTemplateSpec, override []byte) (v1.PodTemplateSpec, error) {
+	if len(override) == 0 {
+		return defaults, nil
+	}
+
+	original, err := json.Marshal(defaults)
+	if err != nil {
+		return defaults, err
+	}
+
+	merged, err := strategicpatch.StrategicMergePatch(original, override, v1.PodTemplateSpec{})
+	if err != nil {
+		return defaults, fmt.Errorf("invalid runner pod template: %v", err)
+	}
+
+	var template v1.PodTemplateSpec
+	if err := json.Unmarshal(merged, &template); err != nil {
+		return defaults, fmt.Errorf("invalid runner pod template: %v", err)
+	}
+
+	if template.ObjectMeta.Labels == nil {
+		template.ObjectMeta.Labels = map[string]string{}
+	}
+	for key, value := range defaults.ObjectMeta.Labels {
+		template.ObjectMeta.Labels[key] = value
+	}
+	template.Spec.RestartPolicy = defaults.Spec.RestartPolicy
+
+	return template, nil
+}
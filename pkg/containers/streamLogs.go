@@ -0,0 +1,234 @@
+package containers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// maxTailLineLength keeps a single long line from filling the log tail
+	maxTailLineLength = 512
+	// maxDocumentLines bounds the lines held back while a JSON document is read, a longer one is let through
+	maxDocumentLines = 10000
+
+	// RedactedOutputs replaces an outputs document printed to the log
+	RedactedOutputs = "<outputs document redacted>"
+	// Redacted replaces a secret value printed to the log
+	Redacted = "<redacted>"
+
+	runnerStartPollInterval = 2 * time.Second
+)
+
+// LogTail keeps the last lines of a runner log. Outputs documents printed to the log are dropped
+// and the masked values replaced, so the tail is safe to store in the status.
+type LogTail struct {
+	mu    sync.Mutex
+	limit int
+	lines []string
+	masks []string
+	// document holds the lines of a JSON document until it is known whether it is an outputs document
+	document []string
+	depth    int
+}
+
+// NewLogTail returns a tail keeping at most limit lines
+func NewLogTail(limit int) *LogTail {
+	return &LogTail{limit: limit}
+}
+
+// Mask replaces the values wherever they appear in the lines added afterwards
+func (t *LogTail) Mask(values ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.masks = append(t.masks, maskableValues(values)...)
+}
+
+// Add appends a line, dropping the oldest one past the limit. It returns the lines safe to log:
+// none while a JSON document is held back, the whole document or its redaction once it ends.
+func (t *LogTail) Add(line string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.document) == 0 && !strings.HasPrefix(strings.TrimSpace(line), "{") {
+		return t.append(line)
+	}
+	t.document = append(t.document, line)
+	t.depth += jsonDepth(line)
+	if t.depth > 0 && len(t.document) < maxDocumentLines {
+		return nil
+	}
+	return t.flush()
+}
+
+// flush appends the held back document, redacted when it is an outputs document
+func (t *LogTail) flush() []string {
+	document := t.document
+	t.document, t.depth = nil, 0
+	if isOutputsDocument(strings.Join(document, "\n")) {
+		return t.append(RedactedOutputs)
+	}
+	var added []string
+	for _, line := range document {
+		added = append(added, t.append(line)...)
+	}
+	return added
+}
+
+func (t *LogTail) append(line string) []string {
+	line = MaskValues(line, t.masks)
+	if len(line) > maxTailLineLength {
+		line = line[:maxTailLineLength] + "..."
+	}
+	t.lines = append(t.lines, line)
+	if len(t.lines) > t.limit {
+		t.lines = t.lines[len(t.lines)-t.limit:]
+	}
+	return []string{line}
+}
+
+// AddText appends every line of text
+func (t *LogTail) AddText(text string) {
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		t.Add(line)
+	}
+}
+
+// Empty reports whether no line was added
+func (t *LogTail) Empty() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.lines) == 0 && len(t.document) == 0
+}
+
+func (t *LogTail) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// A document cut short is redacted when it names outputs, it may be one that was not fully written
+	if len(t.document) > 0 {
+		if strings.Contains(strings.Join(t.document, "\n"), `"outputs"`) {
+			t.document, t.depth = nil, 0
+			t.append(RedactedOutputs)
+		} else {
+			t.flush()
+		}
+	}
+	return strings.Join(t.lines, "\n")
+}
+
+// MaskValues replaces every value in text, as printed and as escaped in a JSON string.
+// Values shorter than 4 bytes are left alone, masking them would garble the text.
+func MaskValues(text string, values []string) string {
+	for _, value := range maskableValues(values) {
+		text = strings.ReplaceAll(text, value, Redacted)
+		if escaped, err := json.Marshal(value); err == nil {
+			if inner := string(escaped[1 : len(escaped)-1]); inner != value {
+				text = strings.ReplaceAll(text, inner, Redacted)
+			}
+		}
+	}
+	return text
+}
+
+// maskableValues drops the values too short to mask without garbling the log
+func maskableValues(values []string) []string {
+	maskable := make([]string, 0, len(values))
+	for _, value := range values {
+		if len(value) >= 4 {
+			maskable = append(maskable, value)
+		}
+	}
+	return maskable
+}
+
+// isOutputsDocument reports whether text is a JSON object with an outputs field, the document runners print to the log
+func isOutputsDocument(text string) bool {
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(text), &document); err != nil {
+		return false
+	}
+	_, ok := document["outputs"]
+	return ok
+}
+
+// jsonDepth returns how many more braces and brackets the line opens than it closes, outside of strings
+func jsonDepth(line string) int {
+	depth := 0
+	inString, escaped := false, false
+	for _, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && r == '\\':
+			escaped = true
+		case r == '"':
+			inString = !inString
+		case inString:
+		case r == '{' || r == '[':
+			depth++
+		case r == '}' || r == ']':
+			depth--
+		}
+	}
+	return depth
+}
+
+// StreamJobLogs follows the log of the runner container of a Job as it is written, logging every line
+// and keeping the last ones in tail. Outputs documents and masked values are redacted from both. It returns when the container exits or ctx is cancelled.
+func StreamJobLogs(ctx context.Context, logger *zap.SugaredLogger, clientset kubernetes.Interface, namespace, jobName string, tail *LogTail) {
+	pod, err := waitForRunnerStart(ctx, clientset, namespace, jobName)
+	if err != nil {
+		return
+	}
+
+	stream, err := clientset.CoreV1().Pods(namespace).GetLogs(pod.Name, &v1.PodLogOptions{
+		Container: "terraform",
+		Follow:    true,
+	}).Stream(ctx)
+	if err != nil {
+		logger.Infof("Failed to stream logs of Pod %s: %v", pod.Name, err)
+		return
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		for _, line := range tail.Add(scanner.Text()) {
+			logger.Infof("[%s] %s", jobName, line)
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		logger.Infof("Log stream of Pod %s ended: %v", pod.Name, err)
+	}
+}
+
+// waitForRunnerStart returns the pod of the Job once its runner container is running or has exited
+func waitForRunnerStart(ctx context.Context, clientset kubernetes.Interface, namespace, jobName string) (*v1.Pod, error) {
+	ticker := time.NewTicker(runnerStartPollInterval)
+	defer ticker.Stop()
+
+	for {
+		pod, err := GetJobPod(clientset, namespace, jobName)
+		if err == nil {
+			for _, containerStatus := range pod.Status.ContainerStatuses {
+				if containerStatus.Name == "terraform" && (containerStatus.State.Running != nil || containerStatus.State.Terminated != nil) {
+					return pod, nil
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
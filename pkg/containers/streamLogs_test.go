@@ -0,0 +1,81 @@
+package containers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLogTailRedactsOutputsDocument(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []string
+	}{
+		{
+			name:  "plain lines",
+			lines: []string{"Initializing", "Apply complete!"},
+			want:  []string{"Initializing", "Apply complete!"},
+		},
+		{
+			name:  "single line document",
+			lines: []string{"Apply complete!", `{"outputs": {"db_password": "hunter22"}}`},
+			want:  []string{"Apply complete!", RedactedOutputs},
+		},
+		{
+			name:  "multi line document",
+			lines: []string{"{", `  "outputs": {`, `    "kubeconfig": "apiVersion: v1 {"`, "  }", "}", "done"},
+			want:  []string{RedactedOutputs, "done"},
+		},
+		{
+			name:  "other json",
+			lines: []string{`{"level": "info",`, `"msg": "planned"}`},
+			want:  []string{`{"level": "info",`, `"msg": "planned"}`},
+		},
+		{
+			name:  "unterminated document",
+			lines: []string{"starting", `{"outputs": {"token": "abcd"`},
+			want:  []string{"starting", RedactedOutputs},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tail := NewLogTail(20)
+			for _, line := range tt.lines {
+				tail.Add(line)
+			}
+			if got := tail.String(); got != strings.Join(tt.want, "\n") {
+				t.Fatalf("tail = %q, want %q", got, strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestLogTailAddReturnsLoggedLines(t *testing.T) {
+	tail := NewLogTail(20)
+	if got := tail.Add(`{"outputs": {`); len(got) != 0 {
+		t.Fatalf("lines of an open document were logged: %q", got)
+	}
+	if got := tail.Add(`"a": "secret"}}`); len(got) != 1 || got[0] != RedactedOutputs {
+		t.Fatalf("logged %q, want the redaction", got)
+	}
+}
+
+func TestLogTailMask(t *testing.T) {
+	tail := NewLogTail(3)
+	tail.Mask("s3cr3t-value", "ab", "")
+	tail.Add("password is s3cr3t-value")
+	tail.Add("short ab stays")
+	tail.Add(`escaped "line\nbreak"`)
+	want := "password is <redacted>\nshort ab stays\n" + `escaped "line\nbreak"`
+	if got := tail.String(); got != want {
+		t.Fatalf("tail = %q, want %q", got, want)
+	}
+
+	if got := MaskValues(`{"key": "-----BEGIN\nKEY-----"}`, []string{"-----BEGIN\nKEY-----"}); got != `{"key": "<redacted>"}` {
+		t.Fatalf("escaped value not masked: %q", got)
+	}
+	if got := MaskValues("password is s3cr3t-value", []string{"s3cr3t-value"}); got != "password is <redacted>" {
+		t.Fatalf("value not masked: %q", got)
+	}
+}
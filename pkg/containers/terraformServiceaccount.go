@@ -1,124 +1,430 @@
-package containers
-
-import (
-	"context"
-	"fmt"
-	"go.uber.org/zap"
-	v1 "k8s.io/api/core/v1"
-	rbacv1 "k8s.io/api/rbac/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
-)
-
-// CreateOrUpdateServiceAccountAndRoles creates or updates a namespace, ServiceAccount, ClusterRole, and ClusterRoleBinding for the specified namespace.
-// It returns the ServiceAccount name and any error encountered.
-func CreateOrUpdateServiceAccountAndRoles(logger *zap.SugaredLogger, clientset kubernetes.Interface, name string, namespace string) (string, error) {
-	saIdentifier := fmt.Sprintf("terraform-%s", name)
-	roleIdentifier := fmt.Sprintf("terraform-role-%s", name)
-
-	// Define Namespace
-	ns := &v1.Namespace{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: namespace,
-		},
-	}
-
-	// Create Namespace if it doesn't exist
-	_, err := clientset.CoreV1().Namespaces().Create(context.Background(), ns, metav1.CreateOptions{})
-	if err != nil && !apierrors.IsAlreadyExists(err) {
-		logger.Infof("Failed to create Namespace: %v", err)
-		return "", err
-	}
-
-	logger.Infof("Namespace %s created or already exists.", namespace)
-
-	// Get annotations from existing ServiceAccount in the alustan namespace
-	alustanSAName := "terraform-sa"
-	alustanSANamespace := "alustan"
-	alustanSA, err := clientset.CoreV1().ServiceAccounts(alustanSANamespace).Get(context.Background(), alustanSAName, metav1.GetOptions{})
-	if err != nil && !apierrors.IsNotFound(err) {
-		logger.Infof("Failed to get Service Account from namespace 'alustan': %v", err)
-		return "", err
-	}
-	var annotations map[string]string
-	if alustanSA != nil {
-		annotations = alustanSA.Annotations
-	}
-
-	// Define Service Account
-	sa := &v1.ServiceAccount{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        saIdentifier,
-			Namespace:   namespace,
-			Annotations: annotations,
-		},
-	}
-
-	// Create or Update Service Account
-	_, err = clientset.CoreV1().ServiceAccounts(namespace).Create(context.Background(), sa, metav1.CreateOptions{})
-	if err != nil && !apierrors.IsAlreadyExists(err) {
-		logger.Infof("Failed to create Service Account: %v", err)
-		return "", err
-	}
-
-	logger.Infof("Service Account %s created or already exists in namespace %s.", sa.Name, namespace)
-
-	// Define ClusterRole with expanded permissions
-	cr := &rbacv1.ClusterRole{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: roleIdentifier,
-		},
-		Rules: []rbacv1.PolicyRule{
-			{
-				APIGroups: []string{"*"},
-				Resources: []string{"*"},
-				Verbs:     []string{"*"},
-			},
-			{
-				NonResourceURLs: []string{"*"},
-				Verbs:           []string{"*"},
-			},
-		},
-	}
-
-	// Create or Update ClusterRole
-	_, err = clientset.RbacV1().ClusterRoles().Create(context.Background(), cr, metav1.CreateOptions{})
-	if err != nil && !apierrors.IsAlreadyExists(err) {
-		logger.Infof("Failed to create ClusterRole: %v", err)
-		return "", err
-	}
-
-	logger.Infof("ClusterRole %s created or already exists.", roleIdentifier)
-
-	// Define ClusterRoleBinding
-	crb := &rbacv1.ClusterRoleBinding{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: fmt.Sprintf("%s-binding", roleIdentifier),
-		},
-		Subjects: []rbacv1.Subject{
-			{
-				Kind:      "ServiceAccount",
-				Name:      sa.Name,
-				Namespace: namespace,
-			},
-		},
-		RoleRef: rbacv1.RoleRef{
-			APIGroup: "rbac.authorization.k8s.io",
-			Kind:     "ClusterRole",
-			Name:     roleIdentifier,
-		},
-	}
-
-	// Create or Update ClusterRoleBinding
-	_, err = clientset.RbacV1().ClusterRoleBindings().Create(context.Background(), crb, metav1.CreateOptions{})
-	if err != nil && !apierrors.IsAlreadyExists(err) {
-		logger.Infof("Failed to create ClusterRoleBinding: %v", err)
-		return "", err
-	}
-
-	logger.Infof("ClusterRoleBinding %s created or already exists.", roleIdentifier)
-
-	// Return the ServiceAccount name
-	return sa.Name, nil
-}
+package containers
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// RBACPolicyRestricted refuses the rules validateClusterRules and validateRoleRules list, which are the known
+	// paths to cluster-admin, not every sensitive permission; runners only get the rules they declare
+	RBACPolicyRestricted = "restricted"
+	// RBACPolicyPermissive keeps the legacy cluster-admin like ClusterRole for runners declaring no rules
+	RBACPolicyPermissive = "permissive"
+)
+
+// RunnerRBAC describes the identity and permissions of the runner pods of a Terraform resource
+type RunnerRBAC struct {
+	// ServiceAccountName selects an existing ServiceAccount instead of a generated one
+	ServiceAccountName string
+	// Rules are granted in the resource namespace through a Role
+	Rules []rbacv1.PolicyRule
+	// ClusterRules are granted cluster wide through a ClusterRole
+	ClusterRules []rbacv1.PolicyRule
+	// Annotations are added to the generated ServiceAccount e.g for IRSA or workload identity
+	Annotations map[string]string
+	// Policy is the controller wide RBAC policy, RBACPolicyRestricted or RBACPolicyPermissive
+	Policy string
+}
+
+// CreateOrUpdateServiceAccountAndRoles creates or updates a namespace, ServiceAccount, Role and ClusterRole with their bindings for the specified namespace.
+// It returns the ServiceAccount name and any error encountered.
+func CreateOrUpdateServiceAccountAndRoles(logger *zap.SugaredLogger, clientset kubernetes.Interface, name string, namespace string, rbac RunnerRBAC) (string, error) {
+	saIdentifier := fmt.Sprintf("terraform-%s", name)
+	roleIdentifier := fmt.Sprintf("terraform-role-%s", name)
+
+	clusterRules := rbac.ClusterRules
+	if rbac.Policy == RBACPolicyPermissive && rbac.ServiceAccountName == "" && len(rbac.Rules) == 0 && len(clusterRules) == 0 {
+		clusterRules = []rbacv1.PolicyRule{
+			{
+				APIGroups: []string{"*"},
+				Resources: []string{"*"},
+				Verbs:     []string{"*"},
+			},
+			{
+				NonResourceURLs: []string{"*"},
+				Verbs:           []string{"*"},
+			},
+		}
+	}
+	if rbac.Policy != RBACPolicyPermissive {
+		if err := validateRoleRules(rbac.Rules); err != nil {
+			logger.Infof("Refusing Role for %s: %v", name, err)
+			return "", err
+		}
+		if err := validateClusterRules(clusterRules); err != nil {
+			logger.Infof("Refusing ClusterRole for %s: %v", name, err)
+			return "", err
+		}
+	}
+
+	// An existing ServiceAccount is managed by its owner, only make sure it is there
+	if rbac.ServiceAccountName != "" {
+		_, err := clientset.CoreV1().ServiceAccounts(namespace).Get(context.Background(), rbac.ServiceAccountName, metav1.GetOptions{})
+		if err != nil {
+			logger.Infof("Failed to get Service Account %s: %v", rbac.ServiceAccountName, err)
+			return "", fmt.Errorf("service account %s: %v", rbac.ServiceAccountName, err)
+		}
+
+		// Roles generated for the resource earlier must not outlive the switch to an existing ServiceAccount
+		if err := DeleteRunnerRoles(logger, clientset, name, namespace); err != nil {
+			return "", err
+		}
+
+		return rbac.ServiceAccountName, nil
+	}
+
+	// Define Namespace
+	ns := &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: namespace,
+		},
+	}
+
+	// Create Namespace if it doesn't exist
+	_, err := clientset.CoreV1().Namespaces().Create(context.Background(), ns, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		logger.Infof("Failed to create Namespace: %v", err)
+		return "", err
+	}
+
+	logger.Infof("Namespace %s created or already exists.", namespace)
+
+	// Get annotations from existing ServiceAccount in the alustan namespace
+	alustanSAName := "terraform-sa"
+	alustanSANamespace := "alustan"
+	alustanSA, err := clientset.CoreV1().ServiceAccounts(alustanSANamespace).Get(context.Background(), alustanSAName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		logger.Infof("Failed to get Service Account from namespace 'alustan': %v", err)
+		return "", err
+	}
+	annotations := map[string]string{}
+	if err == nil && alustanSA != nil {
+		for key, value := range alustanSA.Annotations {
+			annotations[key] = value
+		}
+	}
+	// Annotations declared on the resource take precedence
+	for key, value := range rbac.Annotations {
+		annotations[key] = value
+	}
+
+	// Define Service Account
+	sa := &v1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        saIdentifier,
+			Namespace:   namespace,
+			Annotations: annotations,
+		},
+	}
+
+	// Create or Update Service Account
+	existingSA, err := clientset.CoreV1().ServiceAccounts(namespace).Get(context.Background(), saIdentifier, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = clientset.CoreV1().ServiceAccounts(namespace).Create(context.Background(), sa, metav1.CreateOptions{})
+	} else if err == nil {
+		if existingSA.Annotations == nil {
+			existingSA.Annotations = map[string]string{}
+		}
+		for key, value := range annotations {
+			existingSA.Annotations[key] = value
+		}
+		_, err = clientset.CoreV1().ServiceAccounts(namespace).Update(context.Background(), existingSA, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		logger.Infof("Failed to create or update Service Account: %v", err)
+		return "", err
+	}
+
+	logger.Infof("Service Account %s created or updated in namespace %s.", sa.Name, namespace)
+
+	subjects := []rbacv1.Subject{
+		{
+			Kind:      "ServiceAccount",
+			Name:      sa.Name,
+			Namespace: namespace,
+		},
+	}
+
+	// Namespaced permissions
+	if len(rbac.Rules) > 0 {
+		role := &rbacv1.Role{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      roleIdentifier,
+				Namespace: namespace,
+			},
+			Rules: rbac.Rules,
+		}
+		if err := createOrUpdateRole(clientset, role); err != nil {
+			logger.Infof("Failed to create or update Role: %v", err)
+			return "", err
+		}
+
+		rb := &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-binding", roleIdentifier),
+				Namespace: namespace,
+			},
+			Subjects: subjects,
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: "rbac.authorization.k8s.io",
+				Kind:     "Role",
+				Name:     roleIdentifier,
+			},
+		}
+		_, err = clientset.RbacV1().RoleBindings(namespace).Create(context.Background(), rb, metav1.CreateOptions{})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			logger.Infof("Failed to create RoleBinding: %v", err)
+			return "", err
+		}
+
+		logger.Infof("Role %s created or updated in namespace %s.", roleIdentifier, namespace)
+	} else if err := deleteRole(logger, clientset, roleIdentifier, namespace); err != nil {
+		return "", err
+	}
+
+	// Cluster wide permissions
+	if len(clusterRules) > 0 {
+		cr := &rbacv1.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: roleIdentifier,
+			},
+			Rules: clusterRules,
+		}
+		if err := createOrUpdateClusterRole(clientset, cr); err != nil {
+			logger.Infof("Failed to create or update ClusterRole: %v", err)
+			return "", err
+		}
+
+		logger.Infof("ClusterRole %s created or updated.", roleIdentifier)
+
+		// Define ClusterRoleBinding
+		crb := &rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: fmt.Sprintf("%s-binding", roleIdentifier),
+			},
+			Subjects: subjects,
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: "rbac.authorization.k8s.io",
+				Kind:     "ClusterRole",
+				Name:     roleIdentifier,
+			},
+		}
+
+		// Create ClusterRoleBinding
+		_, err = clientset.RbacV1().ClusterRoleBindings().Create(context.Background(), crb, metav1.CreateOptions{})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			logger.Infof("Failed to create ClusterRoleBinding: %v", err)
+			return "", err
+		}
+
+		logger.Infof("ClusterRoleBinding %s created or already exists.", roleIdentifier)
+	} else if err := deleteClusterRole(logger, clientset, roleIdentifier); err != nil {
+		// Also removes the wildcard ClusterRole granted to runners by earlier versions
+		return "", err
+	}
+
+	// Return the ServiceAccount name
+	return sa.Name, nil
+}
+
+// DeleteRunnerRoles deletes the Role, ClusterRole and bindings generated for the runners of a Terraform resource
+func DeleteRunnerRoles(logger *zap.SugaredLogger, clientset kubernetes.Interface, name string, namespace string) error {
+	roleIdentifier := fmt.Sprintf("terraform-role-%s", name)
+
+	if err := deleteRole(logger, clientset, roleIdentifier, namespace); err != nil {
+		return err
+	}
+	return deleteClusterRole(logger, clientset, roleIdentifier)
+}
+
+// escalatingVerbs let a subject grant itself permissions it does not hold
+var escalatingVerbs = map[string]bool{"escalate": true, "bind": true, "impersonate": true}
+
+// rbacResources are the RBAC resources a runner must not write, writing them amounts to cluster-admin
+var rbacResources = map[string]bool{"roles": true, "clusterroles": true, "rolebindings": true, "clusterrolebindings": true}
+
+// readVerbs are the verbs exposing the content of a resource
+var readVerbs = map[string]bool{"get": true, "list": true, "watch": true}
+
+// podSpecVerbs are the verbs setting the pod spec of a workload
+var podSpecVerbs = map[string]bool{"create": true, "update": true, "patch": true}
+
+// podResources are the resources, by group, that run pods or commands in them. Granted cluster wide they run
+// a pod as any ServiceAccount of any namespace, including the controller's
+var podResources = map[string]map[string]bool{
+	"":      {"pods": true, "pods/exec": true, "pods/attach": true, "pods/ephemeralcontainers": true, "replicationcontrollers": true},
+	"apps":  {"deployments": true, "daemonsets": true, "statefulsets": true, "replicasets": true},
+	"batch": {"jobs": true, "cronjobs": true},
+}
+
+// admissionResources are the admission configurations able to rewrite or block any object of the cluster
+var admissionResources = map[string]bool{
+	"mutatingwebhookconfigurations":     true,
+	"validatingwebhookconfigurations":   true,
+	"validatingadmissionpolicies":       true,
+	"validatingadmissionpolicybindings": true,
+}
+
+// validateClusterRules rejects ClusterRole rules the restricted RBAC policy forbids: wildcards, nonResourceURLs,
+// the escalate, bind and impersonate verbs, writing RBAC resources, reading secrets, requesting service account tokens,
+// running pods or commands in them, proxying to nodes, writing admission webhooks or policies, approving or signing
+// certificate signing requests and creating persistent volumes
+func validateClusterRules(rules []rbacv1.PolicyRule) error {
+	return validateRules("cluster rule", rules, validateClusterRule)
+}
+
+// validateRoleRules rejects Role rules the restricted RBAC policy forbids: wildcards, the escalate, bind and
+// impersonate verbs and writing RBAC resources. Other namespaced permissions, such as reading secrets or creating
+// pods, stay within the resource namespace and are allowed
+func validateRoleRules(rules []rbacv1.PolicyRule) error {
+	return validateRules("rule", rules, validateRoleRule)
+}
+
+func validateRules(kind string, rules []rbacv1.PolicyRule, validate func(rbacv1.PolicyRule) error) error {
+	for i, rule := range rules {
+		if err := validate(rule); err != nil {
+			return fmt.Errorf("%s %d (apiGroups=%q resources=%q verbs=%q nonResourceURLs=%q) %v, which the %s RBAC policy forbids",
+				kind, i, rule.APIGroups, rule.Resources, rule.Verbs, rule.NonResourceURLs, err, RBACPolicyRestricted)
+		}
+	}
+	return nil
+}
+
+func validateRoleRule(rule rbacv1.PolicyRule) error {
+	for _, values := range [][]string{rule.APIGroups, rule.Resources, rule.Verbs, rule.NonResourceURLs} {
+		for _, value := range values {
+			if value == "*" {
+				return fmt.Errorf("uses a wildcard")
+			}
+		}
+	}
+
+	for _, verb := range rule.Verbs {
+		if escalatingVerbs[verb] {
+			return fmt.Errorf("grants the %s verb", verb)
+		}
+	}
+
+	if ruleWrites(rule) {
+		for _, group := range rule.APIGroups {
+			for _, resource := range rule.Resources {
+				if group == "rbac.authorization.k8s.io" && rbacResources[resource] {
+					return fmt.Errorf("writes %s", resource)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func validateClusterRule(rule rbacv1.PolicyRule) error {
+	if err := validateRoleRule(rule); err != nil {
+		return err
+	}
+	if len(rule.NonResourceURLs) > 0 {
+		return fmt.Errorf("grants nonResourceURLs")
+	}
+
+	write := ruleWrites(rule)
+	read := false
+	podSpec := false
+	for _, verb := range rule.Verbs {
+		read = read || readVerbs[verb]
+		podSpec = podSpec || podSpecVerbs[verb]
+	}
+
+	for _, group := range rule.APIGroups {
+		for _, resource := range rule.Resources {
+			switch {
+			case group == "" && resource == "secrets" && read:
+				return fmt.Errorf("reads secrets cluster wide")
+			case group == "" && resource == "serviceaccounts/token" && write:
+				return fmt.Errorf("requests service account tokens")
+			case podResources[group][resource] && podSpec:
+				return fmt.Errorf("runs %s cluster wide", resource)
+			case group == "" && resource == "nodes/proxy":
+				return fmt.Errorf("proxies to the kubelet")
+			case group == "" && resource == "persistentvolumes" && podSpec:
+				return fmt.Errorf("writes persistentvolumes")
+			case group == "admissionregistration.k8s.io" && admissionResources[resource] && write:
+				return fmt.Errorf("writes %s", resource)
+			case group == "certificates.k8s.io" && (resource == "certificatesigningrequests/approval" || resource == "signers") && write:
+				return fmt.Errorf("approves or signs certificates")
+			}
+		}
+	}
+	return nil
+}
+
+// ruleWrites reports whether a rule grants a verb other than reading
+func ruleWrites(rule rbacv1.PolicyRule) bool {
+	for _, verb := range rule.Verbs {
+		if !readVerbs[verb] {
+			return true
+		}
+	}
+	return false
+}
+
+func createOrUpdateRole(clientset kubernetes.Interface, role *rbacv1.Role) error {
+	existing, err := clientset.RbacV1().Roles(role.Namespace).Get(context.Background(), role.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = clientset.RbacV1().Roles(role.Namespace).Create(context.Background(), role, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	existing.Rules = role.Rules
+	_, err = clientset.RbacV1().Roles(role.Namespace).Update(context.Background(), existing, metav1.UpdateOptions{})
+	return err
+}
+
+func createOrUpdateClusterRole(clientset kubernetes.Interface, cr *rbacv1.ClusterRole) error {
+	existing, err := clientset.RbacV1().ClusterRoles().Get(context.Background(), cr.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = clientset.RbacV1().ClusterRoles().Create(context.Background(), cr, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	existing.Rules = cr.Rules
+	_, err = clientset.RbacV1().ClusterRoles().Update(context.Background(), existing, metav1.UpdateOptions{})
+	return err
+}
+
+func deleteRole(logger *zap.SugaredLogger, clientset kubernetes.Interface, roleIdentifier, namespace string) error {
+	err := clientset.RbacV1().RoleBindings(namespace).Delete(context.Background(), fmt.Sprintf("%s-binding", roleIdentifier), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		logger.Infof("Failed to delete RoleBinding: %v", err)
+		return err
+	}
+	err = clientset.RbacV1().Roles(namespace).Delete(context.Background(), roleIdentifier, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		logger.Infof("Failed to delete Role: %v", err)
+		return err
+	}
+	return nil
+}
+
+func deleteClusterRole(logger *zap.SugaredLogger, clientset kubernetes.Interface, roleIdentifier string) error {
+	err := clientset.RbacV1().ClusterRoleBindings().Delete(context.Background(), fmt.Sprintf("%s-binding", roleIdentifier), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		logger.Infof("Failed to delete ClusterRoleBinding: %v", err)
+		return err
+	}
+	err = clientset.RbacV1().ClusterRoles().Delete(context.Background(), roleIdentifier, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		logger.Infof("Failed to delete ClusterRole: %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package containers
+
+import (
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+func TestValidateClusterRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    rbacv1.PolicyRule
+		wantErr bool
+	}{
+		{
+			name: "read nodes",
+			rule: rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"get", "list"}},
+		},
+		{
+			name: "write namespaces",
+			rule: rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"namespaces"}, Verbs: []string{"create", "delete"}},
+		},
+		{
+			name: "read cluster roles",
+			rule: rbacv1.PolicyRule{APIGroups: []string{"rbac.authorization.k8s.io"}, Resources: []string{"clusterroles"}, Verbs: []string{"get"}},
+		},
+		{
+			name: "create secrets",
+			rule: rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"create"}},
+		},
+		{
+			name:    "wildcard verb",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"*"}},
+			wantErr: true,
+		},
+		{
+			name:    "wildcard group",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{"*"}, Resources: []string{"pods"}, Verbs: []string{"get"}},
+			wantErr: true,
+		},
+		{
+			name:    "non resource urls",
+			rule:    rbacv1.PolicyRule{NonResourceURLs: []string{"/metrics"}, Verbs: []string{"get"}},
+			wantErr: true,
+		},
+		{
+			name:    "escalate",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{"rbac.authorization.k8s.io"}, Resources: []string{"clusterroles"}, Verbs: []string{"escalate"}},
+			wantErr: true,
+		},
+		{
+			name:    "bind",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{"rbac.authorization.k8s.io"}, Resources: []string{"roles"}, Verbs: []string{"bind"}},
+			wantErr: true,
+		},
+		{
+			name:    "impersonate",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"users"}, Verbs: []string{"impersonate"}},
+			wantErr: true,
+		},
+		{
+			name:    "create cluster role bindings",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{"rbac.authorization.k8s.io"}, Resources: []string{"clusterrolebindings"}, Verbs: []string{"create"}},
+			wantErr: true,
+		},
+		{
+			name:    "update cluster roles",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{"rbac.authorization.k8s.io"}, Resources: []string{"clusterroles"}, Verbs: []string{"update"}},
+			wantErr: true,
+		},
+		{
+			name:    "get secrets",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}},
+			wantErr: true,
+		},
+		{
+			name:    "list secrets",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"configmaps", "secrets"}, Verbs: []string{"list"}},
+			wantErr: true,
+		},
+		{
+			name:    "service account tokens",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"serviceaccounts/token"}, Verbs: []string{"create"}},
+			wantErr: true,
+		},
+		{
+			name:    "create pods",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"create"}},
+			wantErr: true,
+		},
+		{
+			name: "delete pods",
+			rule: rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list", "delete"}},
+		},
+		{
+			name:    "exec into pods",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods/exec"}, Verbs: []string{"create"}},
+			wantErr: true,
+		},
+		{
+			name:    "create deployments",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"create"}},
+			wantErr: true,
+		},
+		{
+			name:    "patch daemonsets",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{"apps"}, Resources: []string{"daemonsets"}, Verbs: []string{"patch"}},
+			wantErr: true,
+		},
+		{
+			name:    "create statefulsets",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{"apps"}, Resources: []string{"statefulsets"}, Verbs: []string{"create"}},
+			wantErr: true,
+		},
+		{
+			name:    "create replicasets",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{"apps"}, Resources: []string{"replicasets"}, Verbs: []string{"create"}},
+			wantErr: true,
+		},
+		{
+			name:    "create jobs",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{"batch"}, Resources: []string{"jobs"}, Verbs: []string{"create"}},
+			wantErr: true,
+		},
+		{
+			name:    "create cronjobs",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{"batch"}, Resources: []string{"cronjobs"}, Verbs: []string{"create"}},
+			wantErr: true,
+		},
+		{
+			name: "read deployments",
+			rule: rbacv1.PolicyRule{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"get", "list", "watch"}},
+		},
+		{
+			name:    "node proxy",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"nodes/proxy"}, Verbs: []string{"get"}},
+			wantErr: true,
+		},
+		{
+			name:    "create mutating webhooks",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{"admissionregistration.k8s.io"}, Resources: []string{"mutatingwebhookconfigurations"}, Verbs: []string{"create"}},
+			wantErr: true,
+		},
+		{
+			name:    "update validating webhooks",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{"admissionregistration.k8s.io"}, Resources: []string{"validatingwebhookconfigurations"}, Verbs: []string{"update"}},
+			wantErr: true,
+		},
+		{
+			name: "read webhooks",
+			rule: rbacv1.PolicyRule{APIGroups: []string{"admissionregistration.k8s.io"}, Resources: []string{"mutatingwebhookconfigurations"}, Verbs: []string{"get"}},
+		},
+		{
+			name:    "approve certificate signing requests",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{"certificates.k8s.io"}, Resources: []string{"certificatesigningrequests/approval"}, Verbs: []string{"update"}},
+			wantErr: true,
+		},
+		{
+			name:    "sign certificates",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{"certificates.k8s.io"}, Resources: []string{"signers"}, Verbs: []string{"approve", "sign"}},
+			wantErr: true,
+		},
+		{
+			name:    "create persistent volumes",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"persistentvolumes"}, Verbs: []string{"create"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateClusterRules([]rbacv1.PolicyRule{tt.rule})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateClusterRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateClusterRulesNamesRule(t *testing.T) {
+	rules := []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"get"}},
+		{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}},
+	}
+	err := validateClusterRules(rules)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	want := `cluster rule 1 (apiGroups=[""] resources=["secrets"] verbs=["get"] nonResourceURLs=[]) reads secrets cluster wide, which the restricted RBAC policy forbids`
+	if err.Error() != want {
+		t.Fatalf("error = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestValidateRoleRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    rbacv1.PolicyRule
+		wantErr bool
+	}{
+		{
+			name: "read secrets",
+			rule: rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "list"}},
+		},
+		{
+			name: "create pods",
+			rule: rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"create"}},
+		},
+		{
+			name:    "wildcard verb",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"*"}},
+			wantErr: true,
+		},
+		{
+			name:    "bind",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{"rbac.authorization.k8s.io"}, Resources: []string{"clusterroles"}, Verbs: []string{"bind"}},
+			wantErr: true,
+		},
+		{
+			name:    "create role bindings",
+			rule:    rbacv1.PolicyRule{APIGroups: []string{"rbac.authorization.k8s.io"}, Resources: []string{"rolebindings"}, Verbs: []string{"create"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRoleRules([]rbacv1.PolicyRule{tt.rule})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateRoleRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
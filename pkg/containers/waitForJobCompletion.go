@@ -0,0 +1,93 @@
+package containers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// WaitForJobCompletion watches the job until it completes or fails, giving up after timeout.
+func WaitForJobCompletion(logger *zap.SugaredLogger, clientset kubernetes.Interface, namespace, jobName string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", jobName).String()
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fieldSelector
+			return clientset.BatchV1().Jobs(namespace).List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fieldSelector
+			return clientset.BatchV1().Jobs(namespace).Watch(ctx, options)
+		},
+	}
+
+	var jobErr error
+	cancelled := false
+	_, err := watchtools.UntilWithSync(ctx, listWatch, &batchv1.Job{}, nil, func(event watch.Event) (bool, error) {
+		if event.Type == watch.Deleted {
+			return false, fmt.Errorf("job %s was deleted", jobName)
+		}
+
+		job, ok := event.Object.(*batchv1.Job)
+		if !ok {
+			return false, nil
+		}
+
+		if job.Annotations[CancelledAnnotation] != "" {
+			logger.Infof("Job %s was cancelled, waiting for the runner to stop", jobName)
+			cancelled = true
+			return true, nil
+		}
+
+		for _, condition := range job.Status.Conditions {
+			if condition.Status != v1.ConditionTrue {
+				continue
+			}
+			switch condition.Type {
+			case batchv1.JobComplete:
+				logger.Infof("Job %s has succeeded", jobName)
+				return true, nil
+			case batchv1.JobFailed:
+				logger.Infof("Job %s has failed: %s", jobName, condition.Message)
+				if condition.Reason == "DeadlineExceeded" {
+					jobErr = fmt.Errorf("job %s exceeded its deadline and was interrupted", jobName)
+				} else {
+					jobErr = fmt.Errorf("job %s failed: %s", jobName, condition.Reason)
+				}
+				return true, nil
+			}
+		}
+
+		logger.Infof("Job %s is running, active pods: %d", jobName, job.Status.Active)
+		return false, nil
+	})
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("timed out after %v waiting for job %s", timeout, jobName)
+		}
+		return err
+	}
+
+	// The runner gets its grace period to release the state lock before the run counts as cancelled
+	if cancelled {
+		if err := waitForRunnerStop(ctx, clientset, namespace, jobName); err != nil {
+			return fmt.Errorf("waiting for cancelled job %s to stop: %v", jobName, err)
+		}
+		return ErrRunCancelled
+	}
+
+	return jobErr
+}
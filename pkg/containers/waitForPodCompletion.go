@@ -1,43 +0,0 @@
-package containers
-
-import (
-	"context"
-	"fmt"
-	"time"
-
-	"go.uber.org/zap"
-	v1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-)
-
-// WaitForPodCompletion waits for the pod to complete.
-func WaitForPodCompletion(logger *zap.SugaredLogger, clientset kubernetes.Interface, namespace, podName string) error {
-	for {
-		// Retrieve the current state of the pod
-		pod, err := clientset.CoreV1().Pods(namespace).Get(context.Background(), podName, metav1.GetOptions{})
-		if err != nil {
-			return err
-		}
-
-		// Log the current pod phase
-		logger.Infof("Pod %s is in phase %s", podName, pod.Status.Phase)
-
-		// Check if the pod has succeeded
-		if pod.Status.Phase == v1.PodSucceeded {
-			logger.Infof("Pod %s has succeeded", podName)
-			break
-		}
-
-		// Check if the pod has failed
-		if pod.Status.Phase == v1.PodFailed {
-			logger.Infof("Pod %s has failed", podName)
-			return fmt.Errorf("pod %s failed", podName)
-		}
-
-		// Sleep for 1 minute before checking again
-		time.Sleep(1 * time.Minute)
-	}
-
-	return nil
-}
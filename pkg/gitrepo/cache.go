@@ -0,0 +1,61 @@
+package gitrepo
+
+import "sync"
+
+// maxCachedRevisions bounds the revisions whose files are kept, the oldest one is dropped first
+const maxCachedRevisions = 64
+
+// cache holds the files read from repository revisions, keyed by repository@hash
+var cache = newFileCache(maxCachedRevisions)
+
+// fileCache is a bounded cache of the files read from repository revisions
+type fileCache struct {
+	mu        sync.Mutex
+	limit     int
+	order     []string
+	revisions map[string]map[string][]byte
+}
+
+func newFileCache(limit int) *fileCache {
+	return &fileCache{limit: limit, revisions: make(map[string]map[string][]byte)}
+}
+
+// get returns the files at the paths of the revision when all of them are cached
+func (c *fileCache) get(key string, paths []string) (map[string][]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.revisions[key]
+	if !ok {
+		return nil, false
+	}
+	files := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		content, ok := cached[path]
+		if !ok {
+			return nil, false
+		}
+		files[path] = content
+	}
+	return files, true
+}
+
+// add caches files of the revision next to the ones already cached
+func (c *fileCache) add(key string, files map[string][]byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.revisions[key]
+	if !ok {
+		cached = make(map[string][]byte, len(files))
+		c.revisions[key] = cached
+		c.order = append(c.order, key)
+		for len(c.order) > c.limit {
+			delete(c.revisions, c.order[0])
+			c.order = c.order[1:]
+		}
+	}
+	for path, content := range files {
+		cached[path] = content
+	}
+}
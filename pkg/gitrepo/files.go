@@ -0,0 +1,183 @@
+package gitrepo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// ReadFiles returns the content of the files at the paths of a repository revision.
+// The repository is cloned in memory without a worktree and shallow, and files are cached by
+// repository and the hash the revision points at, so a revision is only cloned again once it moves.
+func ReadFiles(url, revision, username, password string, paths []string) (map[string][]byte, error) {
+	var auth transport.AuthMethod
+	if password != "" {
+		if username == "" {
+			// Hosts such as GitHub accept any username with a token
+			username = "git"
+		}
+		auth = &http.BasicAuth{Username: username, Password: password}
+	}
+
+	hash, err := revisionHash(url, revision, auth)
+	if err != nil {
+		return nil, err
+	}
+	key := url + "@" + hash
+	if files, ok := cache.get(key, paths); ok {
+		return files, nil
+	}
+
+	commit, err := resolveCommit(url, revision, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		file, err := commit.File(path)
+		if err != nil {
+			return nil, fmt.Errorf("file %s not found in %s at %s: %v", path, url, revisionName(revision), err)
+		}
+		reader, err := file.Reader()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s of %s: %v", path, url, err)
+		}
+		content, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s of %s: %v", path, url, err)
+		}
+		files[path] = content
+	}
+	cache.add(key, files)
+	return files, nil
+}
+
+// revisionHash returns the hash a revision points at without cloning: the commit hash itself,
+// or the hash the remote advertises for the branch, the tag or its default branch
+func revisionHash(url, revision string, auth transport.AuthMethod) (string, error) {
+	if plumbing.IsHash(revision) {
+		return revision, nil
+	}
+
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{url}})
+	refs, err := remote.List(&git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", fmt.Errorf("failed to list the references of %s: %v", url, err)
+	}
+	advertised := make(map[plumbing.ReferenceName]*plumbing.Reference, len(refs))
+	for _, ref := range refs {
+		advertised[ref.Name()] = ref
+	}
+
+	names := []plumbing.ReferenceName{plumbing.NewBranchReferenceName(revision), plumbing.NewTagReferenceName(revision)}
+	if revision == "" || revision == "HEAD" {
+		names = []plumbing.ReferenceName{plumbing.HEAD}
+	}
+	for _, name := range names {
+		ref, ok := advertised[name]
+		if ok && ref.Type() == plumbing.SymbolicReference {
+			ref, ok = advertised[ref.Target()]
+		}
+		if ok {
+			return ref.Hash().String(), nil
+		}
+	}
+	return "", fmt.Errorf("revision %s not found in %s", revisionName(revision), url)
+}
+
+// resolveCommit clones the repository and returns the commit of the revision,
+// a branch, a tag, a commit hash or the default branch when empty
+func resolveCommit(url, revision string, auth transport.AuthMethod) (*object.Commit, error) {
+	options := &git.CloneOptions{
+		URL:          url,
+		Auth:         auth,
+		Depth:        1,
+		SingleBranch: true,
+		Tags:         git.NoTags,
+	}
+
+	var repo *git.Repository
+	var err error
+	switch {
+	case revision == "" || revision == "HEAD":
+		repo, err = git.Clone(memory.NewStorage(), nil, options)
+
+	case plumbing.IsHash(revision):
+		repo, err = fetchCommit(url, revision, auth)
+		if errors.Is(err, git.ErrExactSHA1NotSupported) {
+			// Servers that do not let a single commit be fetched by hash need the full history
+			repo, err = git.Clone(memory.NewStorage(), nil, &git.CloneOptions{URL: url, Auth: auth})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch %s of %s: %v", revision, url, err)
+		}
+		commit, err := repo.CommitObject(plumbing.NewHash(revision))
+		if err != nil {
+			return nil, fmt.Errorf("commit %s not found in %s: %v", revision, url, err)
+		}
+		return commit, nil
+
+	default:
+		for _, name := range []plumbing.ReferenceName{plumbing.NewBranchReferenceName(revision), plumbing.NewTagReferenceName(revision)} {
+			options.ReferenceName = name
+			repo, err = git.Clone(memory.NewStorage(), nil, options)
+			if err == nil || !isReferenceNotFound(err) {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to clone %s at %s: %v", url, revisionName(revision), err)
+	}
+
+	// Tags are peeled to their commit when cloned
+	head, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s of %s: %v", revisionName(revision), url, err)
+	}
+	return repo.CommitObject(head.Hash())
+}
+
+// fetchCommit fetches the single commit of the hash, the way git fetch --depth 1 origin <hash> does
+func fetchCommit(url, hash string, auth transport.AuthMethod) (*git.Repository, error) {
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := repo.CreateRemote(&config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{url}})
+	if err != nil {
+		return nil, err
+	}
+	err = remote.Fetch(&git.FetchOptions{
+		Auth:     auth,
+		Depth:    1,
+		RefSpecs: []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:refs/heads/%s", hash, hash))},
+		Tags:     git.NoTags,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// isReferenceNotFound reports whether a clone failed because the remote has no such reference
+func isReferenceNotFound(err error) bool {
+	return errors.Is(err, plumbing.ErrReferenceNotFound) || errors.Is(err, git.NoMatchingRefSpecError{})
+}
+
+func revisionName(revision string) string {
+	if revision == "" {
+		return "HEAD"
+	}
+	return revision
+}
@@ -0,0 +1,104 @@
+package gitrepo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// commitFile commits the content of values.yaml to the repository and returns the commit hash
+func commitFile(t *testing.T, dir string, repo *git.Repository, content string) string {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, "values.yaml"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := worktree.Add("values.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := worktree.Commit(content, &git.CommitOptions{
+		Author: &object.Signature{Name: "alustan", Email: "alustan@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash.String()
+}
+
+func TestReadFiles(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := commitFile(t, dir, repo, "replicaCount: 1\n")
+	second := commitFile(t, dir, repo, "replicaCount: 2\n")
+
+	tests := []struct {
+		name     string
+		revision string
+		want     string
+		wantErr  bool
+	}{
+		{name: "default branch", revision: "", want: "replicaCount: 2\n"},
+		{name: "branch", revision: "master", want: "replicaCount: 2\n"},
+		{name: "latest commit", revision: second, want: "replicaCount: 2\n"},
+		{name: "older commit", revision: first, want: "replicaCount: 1\n"},
+		{name: "unknown branch", revision: "missing", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := ReadFiles(dir, tt.revision, "", "", []string{"values.yaml"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadFiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := string(files["values.yaml"]); got != tt.want {
+				t.Fatalf("values.yaml = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, ok := cache.get(dir+"@"+first, []string{"values.yaml"}); !ok {
+		t.Fatal("files of the commit were not cached")
+	}
+
+	// The branch moved, its files are read again rather than from the cache
+	third := commitFile(t, dir, repo, "replicaCount: 3\n")
+	files, err := ReadFiles(dir, "master", "", "", []string{"values.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(files["values.yaml"]); got != "replicaCount: 3\n" {
+		t.Fatalf("values.yaml = %q after the branch moved to %s", got, third)
+	}
+}
+
+func TestFileCache(t *testing.T) {
+	c := newFileCache(2)
+	c.add("repo@1", map[string][]byte{"a.yaml": []byte("a")})
+	c.add("repo@1", map[string][]byte{"b.yaml": []byte("b")})
+
+	if _, ok := c.get("repo@1", []string{"a.yaml", "b.yaml"}); !ok {
+		t.Fatal("files added separately are not cached together")
+	}
+	if _, ok := c.get("repo@1", []string{"a.yaml", "c.yaml"}); ok {
+		t.Fatal("revision missing a path reported as cached")
+	}
+
+	c.add("repo@2", map[string][]byte{"a.yaml": []byte("a")})
+	c.add("repo@3", map[string][]byte{"a.yaml": []byte("a")})
+	if _, ok := c.get("repo@1", []string{"a.yaml"}); ok {
+		t.Fatal("oldest revision not evicted")
+	}
+	if _, ok := c.get("repo@3", []string{"a.yaml"}); !ok {
+		t.Fatal("newest revision evicted")
+	}
+}
@@ -1,5 +1,5 @@
-package imagetag
-
-type RegistryClientInterface interface {
-	GetTags(imageName string) ([]string, error)
+package imagetag
+
+type RegistryClientInterface interface {
+	GetTags(imageName string) ([]string, error)
 }
\ No newline at end of file
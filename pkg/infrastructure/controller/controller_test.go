@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+	"github.com/alustan/alustan/pkg/infrastructure/terraform"
+)
+
+func TestRemediationApproved(t *testing.T) {
+	awaiting := func(mutate func(*v1alpha1.Terraform)) *v1alpha1.Terraform {
+		observed := &v1alpha1.Terraform{}
+		observed.Spec.DriftDetection = v1alpha1.DriftDetection{Enabled: true, AutoRemediate: true}
+		observed.Spec.Approval.Required = true
+		observed.Status.State = "AwaitingApproval"
+		observed.Status.Plan = &v1alpha1.PlanStatus{ID: "abc123"}
+		if mutate != nil {
+			mutate(observed)
+		}
+		return observed
+	}
+
+	tests := []struct {
+		name     string
+		observed *v1alpha1.Terraform
+		want     bool
+	}{
+		{
+			name:     "not approved yet",
+			observed: awaiting(nil),
+		},
+		{
+			name: "approved through the annotation",
+			observed: awaiting(func(o *v1alpha1.Terraform) {
+				o.Annotations = map[string]string{terraform.ApprovePlanAnnotation: "abc123"}
+			}),
+			want: true,
+		},
+		{
+			name: "approved through the spec",
+			observed: awaiting(func(o *v1alpha1.Terraform) {
+				o.Spec.Approval.ApprovedPlan = "abc123"
+			}),
+			want: true,
+		},
+		{
+			name: "another plan approved",
+			observed: awaiting(func(o *v1alpha1.Terraform) {
+				o.Annotations = map[string]string{terraform.ApprovePlanAnnotation: "def456"}
+			}),
+		},
+		{
+			name: "auto remediation off",
+			observed: awaiting(func(o *v1alpha1.Terraform) {
+				o.Annotations = map[string]string{terraform.ApprovePlanAnnotation: "abc123"}
+				o.Spec.DriftDetection.AutoRemediate = false
+			}),
+		},
+		{
+			name: "being deleted",
+			observed: awaiting(func(o *v1alpha1.Terraform) {
+				o.Annotations = map[string]string{terraform.ApprovePlanAnnotation: "abc123"}
+				now := metav1.Now()
+				o.DeletionTimestamp = &now
+			}),
+		},
+		{
+			name: "not awaiting approval",
+			observed: awaiting(func(o *v1alpha1.Terraform) {
+				o.Annotations = map[string]string{terraform.ApprovePlanAnnotation: "abc123"}
+				o.Status.State = "Completed"
+			}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := remediationApproved(tt.observed); got != tt.want {
+				t.Fatalf("remediationApproved() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDependentsAffected(t *testing.T) {
+	terraformObject := func(state string, outputs map[string]interface{}, secretRef map[string]interface{}) *unstructured.Unstructured {
+		status := map[string]interface{}{"state": state, "message": state}
+		if outputs != nil {
+			status["postDeployOutput"] = outputs
+		}
+		if secretRef != nil {
+			status["outputsSecretRef"] = secretRef
+		}
+		return &unstructured.Unstructured{Object: map[string]interface{}{"status": status}}
+	}
+	outputs := map[string]interface{}{"vpc_id": "vpc-123"}
+	secretRef := map[string]interface{}{"name": "network-outputs", "keys": []interface{}{"password"}}
+
+	tests := []struct {
+		name string
+		old  *unstructured.Unstructured
+		new  *unstructured.Unstructured
+		want bool
+	}{
+		{
+			name: "becomes completed",
+			old:  terraformObject("Progressing", outputs, nil),
+			new:  terraformObject("Completed", outputs, nil),
+			want: true,
+		},
+		{
+			name: "outputs change",
+			old:  terraformObject("Completed", outputs, nil),
+			new:  terraformObject("Completed", map[string]interface{}{"vpc_id": "vpc-456"}, nil),
+			want: true,
+		},
+		{
+			name: "outputs secret changes",
+			old:  terraformObject("Completed", outputs, nil),
+			new:  terraformObject("Completed", outputs, secretRef),
+			want: true,
+		},
+		{
+			name: "status message only",
+			old:  terraformObject("Progressing", outputs, secretRef),
+			new:  terraformObject("Failed", outputs, secretRef),
+		},
+		{
+			name: "resync",
+			old:  terraformObject("Completed", outputs, secretRef),
+			new:  terraformObject("Completed", outputs, secretRef),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dependentsAffected(tt.old, tt.new); got != tt.want {
+				t.Fatalf("dependentsAffected() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"sync"
+	"time"
+)
+
+// runQueue limits how many Terraform resources run at once across the cluster.
+// Resources find a free slot in the order they first asked for one.
+type runQueue struct {
+	mu      sync.Mutex
+	limit   int
+	running map[string]bool
+	waiting []string
+	// lastSeen drops resources that stopped asking, e.g. deleted ones, so they do not hold up the queue
+	lastSeen map[string]time.Time
+	// requeue asks a dropped resource to reconcile again, so one still needing a run asks for a slot again
+	requeue func(key string)
+}
+
+// newRunQueue returns a queue admitting limit resources at once, any number when limit is 0
+func newRunQueue(limit int) *runQueue {
+	return &runQueue{
+		limit:    limit,
+		running:  map[string]bool{},
+		lastSeen: map[string]time.Time{},
+	}
+}
+
+// acquire takes a slot for key when one is free and no resource queued before it.
+// Otherwise key keeps its place in the queue and its 1-based position is returned.
+func (q *runQueue) acquire(key string) (bool, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.limit <= 0 || q.running[key] {
+		q.running[key] = true
+		return true, 0
+	}
+
+	q.expire()
+
+	position := -1
+	for i, waiting := range q.waiting {
+		if waiting == key {
+			position = i
+			break
+		}
+	}
+	if position < 0 {
+		q.waiting = append(q.waiting, key)
+		position = len(q.waiting) - 1
+	}
+	q.lastSeen[key] = time.Now()
+
+	if position == 0 && len(q.running) < q.limit {
+		q.waiting = q.waiting[1:]
+		delete(q.lastSeen, key)
+		q.running[key] = true
+		return true, 0
+	}
+
+	return false, position + 1
+}
+
+// release frees the slot held by key
+func (q *runQueue) release(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.running, key)
+}
+
+// forget removes key from the queue
+func (q *runQueue) forget(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.running, key)
+	delete(q.lastSeen, key)
+	for i, waiting := range q.waiting {
+		if waiting == key {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			break
+		}
+	}
+}
+
+// expire drops the waiting resources that did not ask for a slot for several retry intervals and requeues them.
+// A resource that still needs a run asks again at the end of the queue, a deleted one is not found.
+func (q *runQueue) expire() {
+	var expired []string
+	waiting := q.waiting[:0]
+	for _, key := range q.waiting {
+		if time.Since(q.lastSeen[key]) > 4*queueRetryInterval {
+			delete(q.lastSeen, key)
+			expired = append(expired, key)
+			continue
+		}
+		waiting = append(waiting, key)
+	}
+	q.waiting = waiting
+
+	if q.requeue != nil {
+		for _, key := range expired {
+			q.requeue(key)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRunQueueOrder(t *testing.T) {
+	q := newRunQueue(1)
+
+	steps := []struct {
+		key          string
+		release      bool
+		wantAdmitted bool
+		wantPosition int
+	}{
+		{key: "ns/a", wantAdmitted: true},
+		{key: "ns/a", wantAdmitted: true},
+		{key: "ns/b", wantPosition: 1},
+		{key: "ns/c", wantPosition: 2},
+		{key: "ns/b", wantPosition: 1},
+		{key: "ns/a", release: true},
+		{key: "ns/c", wantPosition: 2},
+		{key: "ns/b", wantAdmitted: true},
+		{key: "ns/c", wantPosition: 1},
+	}
+
+	for i, step := range steps {
+		if step.release {
+			q.release(step.key)
+			continue
+		}
+		admitted, position := q.acquire(step.key)
+		if admitted != step.wantAdmitted || position != step.wantPosition {
+			t.Fatalf("step %d: acquire(%s) = %v, %d, want %v, %d", i, step.key, admitted, position, step.wantAdmitted, step.wantPosition)
+		}
+	}
+}
+
+func TestRunQueueExpireRequeues(t *testing.T) {
+	var requeued []string
+	q := newRunQueue(1)
+	q.requeue = func(key string) { requeued = append(requeued, key) }
+
+	q.acquire("ns/running")
+	q.acquire("ns/stale")
+	q.acquire("ns/waiting")
+	q.lastSeen["ns/stale"] = time.Now().Add(-5 * queueRetryInterval)
+	q.release("ns/running")
+
+	// The stale head of the queue no longer holds up the resources behind it
+	if admitted, position := q.acquire("ns/waiting"); !admitted {
+		t.Fatalf("acquire(ns/waiting) = %v, %d, want admitted", admitted, position)
+	}
+	if !reflect.DeepEqual(requeued, []string{"ns/stale"}) {
+		t.Fatalf("requeued = %v, want [ns/stale]", requeued)
+	}
+
+	// A requeued resource still needing a run asks again at the end of the queue
+	if admitted, position := q.acquire("ns/stale"); admitted || position != 1 {
+		t.Fatalf("acquire(ns/stale) = %v, %d, want position 1", admitted, position)
+	}
+}
@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+)
+
+const (
+	// PhasePlan saves a plan to $PLAN_FILE
+	PhasePlan = "plan"
+	// PhaseApply applies $PLAN_FILE when set and writes the outputs to $OUTPUTS_FILE
+	PhaseApply = "apply"
+	// PhaseDestroy destroys everything the module manages
+	PhaseDestroy = "destroy"
+)
+
+// PlanSummaryNotFound is the summary of a plan whose runner output holds no summary the engine recognises
+const PlanSummaryNotFound = "plan summary not found in runner output"
+
+// PlanParsed reports whether the counts of the plan were read from its runner output,
+// they are all zero otherwise and say nothing about the changes
+func PlanParsed(plan *v1alpha1.PlanStatus) bool {
+	return plan != nil && plan.Summary != PlanSummaryNotFound
+}
+
+// Engine runs a module of an IaC tool in its stock image
+type Engine interface {
+	// Image returns the image the runner uses for the module
+	Image(module *v1alpha1.Module) string
+	// Script returns the shell script running a phase of the module
+	Script(module *v1alpha1.Module, phase string) string
+	// ParsePlan extracts the summary of the changes from the plan log
+	ParsePlan(logs string) *v1alpha1.PlanStatus
+	// ParseOutputs reads the typed outputs from the document the apply phase wrote,
+	// along with the names of the outputs the tool marks sensitive
+	ParseOutputs(document []byte) (map[string]runtime.RawExtension, []string, error)
+}
+
+// Get returns the engine with the given name
+func Get(name string) (Engine, error) {
+	switch name {
+	case "", "terraform":
+		return NewTerraform(), nil
+	case "opentofu":
+		return NewOpenTofu(), nil
+	case "pulumi":
+		return NewPulumi(), nil
+	default:
+		return nil, fmt.Errorf("unknown engine: %s", name)
+	}
+}
+
+// compactJSON joins the lines of an indented JSON document on stdin
+const compactJSON = `sed 's/^ *//' | tr -d '\n'`
+
+// shellQuote quotes a value for use as a single shell word
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
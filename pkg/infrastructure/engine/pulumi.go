@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+	"github.com/alustan/alustan/pkg/containers"
+)
+
+var (
+	previewCountPattern    = regexp.MustCompile(`(\d+) to (create|update|delete|replace)`)
+	previewSummaryPattern  = regexp.MustCompile(`^\s*Resources:\s*$`)
+	previewResourcePattern = regexp.MustCompile(`^\s*(\+-|[+~-])\s+(\S+:\S+)\s+(\S+)\s+(create|update|delete|replace)\b`)
+)
+
+const (
+	// pulumiValuesKey holds the stack outputs with their secret values in the outputs document
+	pulumiValuesKey = "values"
+	// pulumiMaskedKey holds the stack outputs with their secret values masked
+	pulumiMaskedKey = "masked"
+	// pulumiSecret is how pulumi stack output --json shows a secret value
+	pulumiSecret = "[secret]"
+)
+
+// Pulumi runs Pulumi programs; the module workspace is the stack
+type Pulumi struct {
+	defaultVersion string
+}
+
+// NewPulumi returns the engine running Pulumi programs
+func NewPulumi() *Pulumi {
+	return &Pulumi{
+		defaultVersion: "3.121.0",
+	}
+}
+
+func (p *Pulumi) Image(module *v1alpha1.Module) string {
+	if module.Image != "" {
+		return module.Image
+	}
+	version := module.Version
+	if version == "" {
+		version = p.defaultVersion
+	}
+	return fmt.Sprintf("pulumi/pulumi:%s", version)
+}
+
+func (p *Pulumi) Script(module *v1alpha1.Module, phase string) string {
+	repository, ref := gitSource(module.Source)
+
+	clone := []string{"git", "clone", "--depth", "1"}
+	if ref != "" {
+		clone = append(clone, "--branch", shellQuote(ref))
+	}
+	clone = append(clone, shellQuote(repository), "/workspace/src")
+
+	stack := module.Workspace
+	if stack == "" {
+		stack = "dev"
+	}
+	selectStack := []string{"pulumi", "stack", "select", "--create", "--non-interactive", shellQuote(stack)}
+	if secretsProvider := module.BackendConfig["secretsProvider"]; secretsProvider != "" {
+		selectStack = append(selectStack, fmt.Sprintf("--secrets-provider=%s", shellQuote(secretsProvider)))
+	}
+
+	lines := []string{
+		"set -e",
+		strings.Join(clone, " "),
+		fmt.Sprintf("cd %s", shellQuote(strings.TrimSuffix("/workspace/src/"+strings.Trim(module.Path, "/"), "/"))),
+	}
+	// Without a backend url the program uses Pulumi Cloud with PULUMI_ACCESS_TOKEN
+	if url := module.BackendConfig["url"]; url != "" {
+		lines = append(lines, fmt.Sprintf("pulumi login %s", shellQuote(url)))
+	}
+	lines = append(lines,
+		"pulumi install",
+		strings.Join(selectStack, " "),
+	)
+
+	switch phase {
+	case PhasePlan:
+		// Update plans are an experimental feature of the Pulumi CLI
+		lines = append(lines,
+			"export PULUMI_EXPERIMENTAL=true",
+			`pulumi preview --refresh --diff --non-interactive --save-plan "$PLAN_FILE"`,
+		)
+	case PhaseApply:
+		// The update is constrained to the approved plan, it fails rather than doing anything the plan does not
+		lines = append(lines,
+			"export PULUMI_EXPERIMENTAL=true",
+			`if [ -n "$PLAN_FILE" ]; then pulumi up --yes --skip-preview --non-interactive --plan "$PLAN_FILE"; else pulumi up --yes --skip-preview --non-interactive; fi`,
+			// Secrets show as [secret] without --show-secrets, which tells them apart from the plain outputs
+			fmt.Sprintf(`printf '{"%s":%%s,"%s":%%s}' "$(pulumi stack output --json --show-secrets | %s)" "$(pulumi stack output --json | %s)" > "$OUTPUTS_FILE"`,
+				pulumiValuesKey, pulumiMaskedKey, compactJSON, compactJSON),
+		)
+	case PhaseDestroy:
+		lines = append(lines, "pulumi destroy --yes --skip-preview --non-interactive")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// ParsePlan reads the resource summary of pulumi preview; replacements count as changes
+func (p *Pulumi) ParsePlan(logs string) *v1alpha1.PlanStatus {
+	plan := &v1alpha1.PlanStatus{}
+	found := false
+
+	for _, line := range strings.Split(ansiPattern.ReplaceAllString(logs, ""), "\n") {
+		if previewSummaryPattern.MatchString(line) {
+			found = true
+			continue
+		}
+		if match := previewResourcePattern.FindStringSubmatch(line); match != nil {
+			plan.Resources = append(plan.Resources, fmt.Sprintf("%s %s will be %sed", match[2], match[3], strings.TrimSuffix(match[4], "e")))
+			continue
+		}
+		if match := previewCountPattern.FindStringSubmatch(line); match != nil {
+			count, _ := strconv.Atoi(match[1])
+			switch match[2] {
+			case "create":
+				plan.Add += count
+			case "update", "replace":
+				plan.Change += count
+			case "delete":
+				plan.Destroy += count
+			}
+		}
+	}
+
+	if found {
+		plan.Summary = fmt.Sprintf("%d to add, %d to change, %d to destroy", plan.Add, plan.Change, plan.Destroy)
+	} else {
+		plan.Summary = PlanSummaryNotFound
+	}
+
+	return plan
+}
+
+// ParseOutputs reads the outputs of pulumi stack output --json --show-secrets, marking sensitive
+// the outputs that pulumi stack output --json shows as [secret]
+func (p *Pulumi) ParseOutputs(document []byte) (map[string]runtime.RawExtension, []string, error) {
+	var described struct {
+		Values json.RawMessage `json:"values"`
+		Masked json.RawMessage `json:"masked"`
+	}
+	if err := json.Unmarshal(document, &described); err != nil {
+		return nil, nil, fmt.Errorf("invalid outputs document: %v", err)
+	}
+	if len(described.Values) == 0 || len(described.Masked) == 0 {
+		return nil, nil, fmt.Errorf("outputs document must hold the %s and %s stack outputs", pulumiValuesKey, pulumiMaskedKey)
+	}
+
+	outputs, err := containers.ParseOutputs(described.Values)
+	if err != nil {
+		return nil, nil, err
+	}
+	masked, err := containers.ParseOutputs(described.Masked)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var sensitive []string
+	for key := range outputs {
+		var value interface{}
+		if output, ok := masked[key]; ok && json.Unmarshal(output.Raw, &value) == nil && value != pulumiSecret {
+			continue
+		}
+		// An output missing from the masked document is kept out of the status too
+		sensitive = append(sensitive, key)
+	}
+	sort.Strings(sensitive)
+	return outputs, sensitive, nil
+}
+
+// gitSource splits a git module source into the repository url and the ref to check out
+func gitSource(source string) (string, string) {
+	source = strings.TrimPrefix(source, "git::")
+	repository, query, _ := strings.Cut(source, "?")
+	for _, param := range strings.Split(query, "&") {
+		if ref, ok := strings.CutPrefix(param, "ref="); ok {
+			return repository, ref
+		}
+	}
+	return repository, ""
+}
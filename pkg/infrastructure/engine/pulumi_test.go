@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+)
+
+func TestPulumiScriptPinsSavedPlan(t *testing.T) {
+	module := &v1alpha1.Module{Source: "https://github.com/alustan/stacks.git?ref=v1.0.0", Path: "network"}
+	p := NewPulumi()
+
+	plan := p.Script(module, PhasePlan)
+	if !strings.Contains(plan, `pulumi preview --refresh --diff --non-interactive --save-plan "$PLAN_FILE"`) {
+		t.Fatalf("plan script does not save the plan:\n%s", plan)
+	}
+
+	apply := p.Script(module, PhaseApply)
+	if !strings.Contains(apply, `--plan "$PLAN_FILE"`) {
+		t.Fatalf("apply script does not apply the saved plan:\n%s", apply)
+	}
+	for _, script := range []string{plan, apply} {
+		if !strings.Contains(script, "export PULUMI_EXPERIMENTAL=true") {
+			t.Fatalf("script does not enable update plans:\n%s", script)
+		}
+	}
+}
+
+func TestPulumiParseOutputs(t *testing.T) {
+	tests := []struct {
+		name          string
+		document      string
+		wantKeys      []string
+		wantSensitive []string
+		wantErr       bool
+	}{
+		{
+			name:          "secret output",
+			document:      `{"values":{"endpoint":"db.local","password":"hunter22"},"masked":{"endpoint":"db.local","password":"[secret]"}}`,
+			wantKeys:      []string{"endpoint", "password"},
+			wantSensitive: []string{"password"},
+		},
+		{
+			name:     "no secrets",
+			document: `{"values":{"port":5432,"tags":{"a":"b"}},"masked":{"port":5432,"tags":{"a":"b"}}}`,
+			wantKeys: []string{"port", "tags"},
+		},
+		{
+			name:          "output missing from the masked document",
+			document:      `{"values":{"token":"abcd"},"masked":{}}`,
+			wantKeys:      []string{"token"},
+			wantSensitive: []string{"token"},
+		},
+		{
+			name:     "plain stack output document",
+			document: `{"endpoint":"db.local"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "invalid json",
+			document: `{"values":`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputs, sensitive, err := NewPulumi().ParseOutputs([]byte(tt.document))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseOutputs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			for _, key := range tt.wantKeys {
+				if _, ok := outputs[key]; !ok {
+					t.Fatalf("output %s missing from %v", key, outputs)
+				}
+			}
+			if len(outputs) != len(tt.wantKeys) {
+				t.Fatalf("got %d outputs, want %d", len(outputs), len(tt.wantKeys))
+			}
+			if !reflect.DeepEqual(sensitive, tt.wantSensitive) {
+				t.Fatalf("sensitive = %v, want %v", sensitive, tt.wantSensitive)
+			}
+		})
+	}
+
+	outputs, _, _ := NewPulumi().ParseOutputs([]byte(`{"values":{"password":"hunter22"},"masked":{"password":"[secret]"}}`))
+	if got := string(outputs["password"].Raw); got != `"hunter22"` {
+		t.Fatalf("password = %s, want the secret value", got)
+	}
+}
+
+func TestPulumiParsePlan(t *testing.T) {
+	tests := []struct {
+		name    string
+		logs    string
+		want    string
+		changes int
+	}{
+		{
+			name: "changes",
+			logs: strings.Join([]string{
+				"Previewing update (dev)",
+				"    +   aws:s3:Bucket  logs  create",
+				"    ~   aws:ec2:Instance  web  update",
+				"Resources:",
+				"    + 1 to create",
+				"    ~ 1 to update",
+				"    - 2 to delete",
+				"    3 unchanged",
+			}, "\n"),
+			want:    "1 to add, 1 to change, 2 to destroy",
+			changes: 2,
+		},
+		{
+			name:    "no changes",
+			logs:    "Previewing update (dev)\nResources:\n    5 unchanged\n",
+			want:    "0 to add, 0 to change, 0 to destroy",
+			changes: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := NewPulumi().ParsePlan(tt.logs)
+			if plan.Summary != tt.want {
+				t.Fatalf("summary = %q, want %q", plan.Summary, tt.want)
+			}
+			if len(plan.Resources) != tt.changes {
+				t.Fatalf("resources = %v, want %d", plan.Resources, tt.changes)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+	"github.com/alustan/alustan/pkg/containers"
+)
+
+var (
+	ansiPattern       = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+	planCountsPattern = regexp.MustCompile(`Plan: (\d+) to add, (\d+) to change, (\d+) to destroy`)
+	planNoChanges     = regexp.MustCompile(`No changes\.`)
+	planResource      = regexp.MustCompile(`^\s*# (\S+) (will be|must be) (.+)$`)
+)
+
+// Terraform runs modules with the terraform CLI or a CLI compatible with it such as tofu
+type Terraform struct {
+	binary         string
+	repository     string
+	defaultVersion string
+}
+
+// NewTerraform returns the engine running modules with terraform
+func NewTerraform() *Terraform {
+	return &Terraform{
+		binary:         "terraform",
+		repository:     "hashicorp/terraform",
+		defaultVersion: "1.8.1",
+	}
+}
+
+// NewOpenTofu returns the engine running modules with OpenTofu
+func NewOpenTofu() *Terraform {
+	return &Terraform{
+		binary:         "tofu",
+		repository:     "ghcr.io/opentofu/opentofu",
+		defaultVersion: "1.7.2",
+	}
+}
+
+func (t *Terraform) Image(module *v1alpha1.Module) string {
+	if module.Image != "" {
+		return module.Image
+	}
+	version := module.Version
+	if version == "" {
+		version = t.defaultVersion
+	}
+	return fmt.Sprintf("%s:%s", t.repository, version)
+}
+
+func (t *Terraform) Script(module *v1alpha1.Module, phase string) string {
+	init := []string{t.binary, "init", "-input=false", fmt.Sprintf("-from-module=%s", shellQuote(moduleSource(module)))}
+	keys := make([]string, 0, len(module.BackendConfig))
+	for key := range module.BackendConfig {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		init = append(init, fmt.Sprintf("-backend-config=%s", shellQuote(fmt.Sprintf("%s=%s", key, module.BackendConfig[key]))))
+	}
+
+	lines := []string{
+		"set -e",
+		"cd /workspace",
+		strings.Join(init, " "),
+	}
+	if module.Workspace != "" {
+		lines = append(lines, fmt.Sprintf("%s workspace select -or-create=true %s", t.binary, shellQuote(module.Workspace)))
+	}
+
+	switch phase {
+	case PhasePlan:
+		lines = append(lines, fmt.Sprintf(`%s plan -input=false -out="$PLAN_FILE"`, t.binary))
+	case PhaseApply:
+		lines = append(lines,
+			fmt.Sprintf(`if [ -n "$PLAN_FILE" ]; then %s apply -input=false -auto-approve "$PLAN_FILE"; else %s apply -input=false -auto-approve; fi`, t.binary, t.binary),
+			fmt.Sprintf(`%s output -json | %s > "$OUTPUTS_FILE"`, t.binary, compactJSON),
+		)
+	case PhaseDestroy:
+		lines = append(lines, fmt.Sprintf("%s destroy -input=false -auto-approve", t.binary))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (t *Terraform) ParsePlan(logs string) *v1alpha1.PlanStatus {
+	return ParseTerraformPlan(logs)
+}
+
+// ParseOutputs reads terraform output -json, keeping the value of each output and its sensitive flag
+func (t *Terraform) ParseOutputs(document []byte) (map[string]runtime.RawExtension, []string, error) {
+	outputs, err := containers.ParseOutputs(document)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := make(map[string]runtime.RawExtension, len(outputs))
+	var sensitive []string
+	for key, output := range outputs {
+		var described struct {
+			Sensitive bool            `json:"sensitive"`
+			Value     json.RawMessage `json:"value"`
+		}
+		if err := json.Unmarshal(output.Raw, &described); err != nil {
+			return nil, nil, fmt.Errorf("output %s: %v", key, err)
+		}
+		if len(described.Value) == 0 {
+			return nil, nil, fmt.Errorf("output %s: value missing", key)
+		}
+		values[key] = runtime.RawExtension{Raw: described.Value}
+		if described.Sensitive {
+			sensitive = append(sensitive, key)
+		}
+	}
+	sort.Strings(sensitive)
+	return values, sensitive, nil
+}
+
+// ParseTerraformPlan extracts the add/change/destroy counts and affected resources from terraform plan output
+func ParseTerraformPlan(logs string) *v1alpha1.PlanStatus {
+	plan := &v1alpha1.PlanStatus{}
+	found := false
+
+	for _, line := range strings.Split(ansiPattern.ReplaceAllString(logs, ""), "\n") {
+		if match := planResource.FindStringSubmatch(line); match != nil {
+			plan.Resources = append(plan.Resources, fmt.Sprintf("%s %s %s", match[1], match[2], match[3]))
+			continue
+		}
+		if match := planCountsPattern.FindStringSubmatch(line); match != nil {
+			plan.Add, _ = strconv.Atoi(match[1])
+			plan.Change, _ = strconv.Atoi(match[2])
+			plan.Destroy, _ = strconv.Atoi(match[3])
+			found = true
+			continue
+		}
+		if planNoChanges.MatchString(line) {
+			found = true
+		}
+	}
+
+	if found {
+		plan.Summary = fmt.Sprintf("%d to add, %d to change, %d to destroy", plan.Add, plan.Change, plan.Destroy)
+	} else {
+		plan.Summary = PlanSummaryNotFound
+	}
+
+	return plan
+}
+
+// moduleSource returns the module source address including the sub directory
+func moduleSource(module *v1alpha1.Module) string {
+	path := strings.Trim(module.Path, "/")
+	if path == "" {
+		return module.Source
+	}
+
+	// A ref query has to stay after the sub directory e.g git::https://host/repo.git//stacks/network?ref=v1.0.0
+	source, query, hasQuery := strings.Cut(module.Source, "?")
+	address := fmt.Sprintf("%s//%s", strings.TrimSuffix(source, "/"), path)
+	if hasQuery {
+		address = fmt.Sprintf("%s?%s", address, query)
+	}
+	return address
+}
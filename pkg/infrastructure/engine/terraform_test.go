@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+)
+
+func TestParseTerraformPlan(t *testing.T) {
+	tests := []struct {
+		name      string
+		logs      string
+		want      v1alpha1.PlanStatus
+		wantParse bool
+	}{
+		{
+			name: "changes",
+			logs: strings.Join([]string{
+				"Terraform will perform the following actions:",
+				"  # aws_s3_bucket.logs will be created",
+				"  # aws_instance.web must be replaced",
+				"\x1b[1mPlan:\x1b[0m 1 to add, 1 to change, 1 to destroy.",
+			}, "\n"),
+			want: v1alpha1.PlanStatus{
+				Add: 1, Change: 1, Destroy: 1,
+				Summary:   "1 to add, 1 to change, 1 to destroy",
+				Resources: []string{"aws_s3_bucket.logs will be created", "aws_instance.web must be replaced"},
+			},
+			wantParse: true,
+		},
+		{
+			name:      "no changes",
+			logs:      "No changes. Your infrastructure matches the configuration.",
+			want:      v1alpha1.PlanStatus{Summary: "0 to add, 0 to change, 0 to destroy"},
+			wantParse: true,
+		},
+		{
+			name:      "unknown wording",
+			logs:      "Planned: 2 additions, 0 modifications, 0 removals",
+			want:      v1alpha1.PlanStatus{Summary: PlanSummaryNotFound},
+			wantParse: false,
+		},
+		{
+			name:      "empty output",
+			logs:      "",
+			want:      v1alpha1.PlanStatus{Summary: PlanSummaryNotFound},
+			wantParse: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := ParseTerraformPlan(tt.logs)
+			if !reflect.DeepEqual(*plan, tt.want) {
+				t.Fatalf("ParseTerraformPlan() = %+v, want %+v", *plan, tt.want)
+			}
+			if PlanParsed(plan) != tt.wantParse {
+				t.Fatalf("PlanParsed() = %v, want %v", PlanParsed(plan), tt.wantParse)
+			}
+		})
+	}
+}
+
+func TestPulumiPlanWithoutSummaryIsNotParsed(t *testing.T) {
+	plan := NewPulumi().ParsePlan("Previewing update (dev)\nerror: preview failed\n")
+	if PlanParsed(plan) {
+		t.Fatalf("plan without a Resources block reported as parsed: %+v", plan)
+	}
+}
+
+func TestTerraformParseOutputs(t *testing.T) {
+	document := `{"endpoint":{"sensitive":false,"type":"string","value":"db.local"},"password":{"sensitive":true,"type":"string","value":"hunter22"}}`
+	outputs, sensitive, err := NewTerraform().ParseOutputs([]byte(document))
+	if err != nil {
+		t.Fatalf("ParseOutputs() error = %v", err)
+	}
+	if got := string(outputs["endpoint"].Raw); got != `"db.local"` {
+		t.Fatalf("endpoint = %s", got)
+	}
+	if !reflect.DeepEqual(sensitive, []string{"password"}) {
+		t.Fatalf("sensitive = %v, want [password]", sensitive)
+	}
+
+	if _, _, err := NewTerraform().ParseOutputs([]byte(`{"endpoint":{"sensitive":false}}`)); err == nil {
+		t.Fatal("expected an error for an output without value")
+	}
+}
+
+func TestApplyScriptsKeepOutputsOffTheLog(t *testing.T) {
+	module := &v1alpha1.Module{Source: "https://github.com/alustan/stacks.git?ref=v1.0.0"}
+	for _, e := range []Engine{NewTerraform(), NewOpenTofu(), NewPulumi()} {
+		script := e.Script(module, PhaseApply)
+		if !strings.Contains(script, `> "$OUTPUTS_FILE"`) {
+			t.Fatalf("apply script does not write its outputs to $OUTPUTS_FILE:\n%s", script)
+		}
+		if strings.Contains(script, `cat "$OUTPUTS_FILE"`) {
+			t.Fatalf("apply script prints its outputs to the log:\n%s", script)
+		}
+	}
+}
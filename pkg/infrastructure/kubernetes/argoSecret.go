@@ -1,129 +1,259 @@
-package kubernetes
-
-import (
-	"context"
-	"fmt"
-	"time"
-
-	"github.com/argoproj/argo-cd/v2/pkg/apiclient/cluster"
-	appv1alpha1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
-	"go.uber.org/zap"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
-	"k8s.io/apimachinery/pkg/util/wait"
-)
-
-func CreateOrUpdateArgoCluster(
-    logger *zap.SugaredLogger,
-    clusterClient cluster.ClusterServiceClient,
-    clusterName, environment string,
-) error {
-    if clusterClient == nil {
-        return fmt.Errorf("clusterClient is nil")
-    }
-
-    if environment == "" {
-        return fmt.Errorf("environment is empty")
-    }
-
-    // Create a background context with timeout to avoid indefinite blocking
-    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-    defer cancel()
-
-    // Retry logic using client-go wait package
-    backoffConfig := wait.Backoff{
-        Steps:    3,
-        Duration: 5 * time.Second,
-        Factor:   1.5,
-        Jitter:   0.1,
-    }
-
-    err := wait.ExponentialBackoff(backoffConfig, func() (bool, error) {
-        // Set gRPC call options
-        callOptions := []grpc.CallOption{
-            grpc.WaitForReady(true), // Wait for connection to be ready
-        }
-
-        // List existing clusters
-        clusters, err := clusterClient.List(ctx, &cluster.ClusterQuery{}, callOptions...)
-        if err != nil {
-            logger.Errorf("Failed to list clusters: %v", err)
-            if status.Code(err) == codes.DeadlineExceeded || status.Code(err) == codes.Unavailable {
-                // Retry on transient errors
-                return false, nil
-            }
-            return false, fmt.Errorf("failed to list clusters: %w", err)
-        }
-
-        var defaultCluster *appv1alpha1.Cluster
-        for _, cl := range clusters.Items {
-            if env, exists := cl.Labels["environment"]; exists && env == "control" {
-                logger.Info("Found existing cluster with environment:control, returning without creating or updating a cluster.")
-                return true, nil
-            } else if cl.Server == "https://kubernetes.default.svc" {
-                defaultCluster = &cl
-            } else if env, exists := cl.Labels["environment"]; exists && env == environment {
-                logger.Info("Found existing cluster with the specified environment, returning without creating or updating a cluster.")
-                return true, nil
-            }
-        }
-
-        if defaultCluster != nil {
-            // Initialize Labels map if it is nil
-            if defaultCluster.Labels == nil {
-                defaultCluster.Labels = make(map[string]string)
-            }
-
-            // Update the default cluster with the new environment label
-            if _, exists := defaultCluster.Labels["environment"]; !exists || defaultCluster.Labels["environment"] != environment {
-                defaultCluster.Labels["environment"] = environment
-                updateRequest := &cluster.ClusterUpdateRequest{
-                    Cluster: defaultCluster,
-                }
-                _, err := clusterClient.Update(ctx, updateRequest, callOptions...)
-                if err != nil {
-                    logger.Errorf("Failed to update default cluster: %v", err)
-                    if status.Code(err) == codes.DeadlineExceeded || status.Code(err) == codes.Unavailable {
-                        // Retry on transient errors
-                        return false, nil
-                    }
-                    return false, fmt.Errorf("failed to update default cluster: %w", err)
-                }
-                logger.Infof("Default cluster updated successfully with environment label: %s", environment)
-            }
-            return true, nil
-        }
-
-        // Define the new cluster configuration
-        newCluster := &cluster.ClusterCreateRequest{
-            Cluster: &appv1alpha1.Cluster{
-                Name:   clusterName,
-                Server: "https://kubernetes.default.svc",
-                Labels: map[string]string{
-                    "environment": environment,
-                },
-            },
-        }
-
-        // Create the new cluster
-        _, err = clusterClient.Create(ctx, newCluster, callOptions...)
-        if err != nil {
-            logger.Errorf("Failed to create cluster: %v", err)
-            if status.Code(err) == codes.DeadlineExceeded || status.Code(err) == codes.Unavailable {
-                // Retry on transient errors
-                return false, nil
-            }
-            return false, fmt.Errorf("failed to create cluster: %w", err)
-        }
-
-        logger.Infof("Cluster %s created successfully.", newCluster.Cluster.Name)
-        return true, nil
-    })
-
-    if err != nil {
-        return fmt.Errorf("exceeded retry limit for creating or listing clusters: %w", err)
-    }
-
-    return nil
-}
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/cluster"
+	appv1alpha1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func CreateOrUpdateArgoCluster(
+    logger *zap.SugaredLogger,
+    clusterClient cluster.ClusterServiceClient,
+    clusterName, environment string,
+) error {
+    if clusterClient == nil {
+        return fmt.Errorf("clusterClient is nil")
+    }
+
+    if environment == "" {
+        return fmt.Errorf("environment is empty")
+    }
+
+    // Create a background context with timeout to avoid indefinite blocking
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    // Retry logic using client-go wait package
+    backoffConfig := wait.Backoff{
+        Steps:    3,
+        Duration: 5 * time.Second,
+        Factor:   1.5,
+        Jitter:   0.1,
+    }
+
+    err := wait.ExponentialBackoff(backoffConfig, func() (bool, error) {
+        // Set gRPC call options
+        callOptions := []grpc.CallOption{
+            grpc.WaitForReady(true), // Wait for connection to be ready
+        }
+
+        // List existing clusters
+        clusters, err := clusterClient.List(ctx, &cluster.ClusterQuery{}, callOptions...)
+        if err != nil {
+            logger.Errorf("Failed to list clusters: %v", err)
+            if status.Code(err) == codes.DeadlineExceeded || status.Code(err) == codes.Unavailable {
+                // Retry on transient errors
+                return false, nil
+            }
+            return false, fmt.Errorf("failed to list clusters: %w", err)
+        }
+
+        var defaultCluster *appv1alpha1.Cluster
+        for _, cl := range clusters.Items {
+            if env, exists := cl.Labels["environment"]; exists && env == "control" {
+                logger.Info("Found existing cluster with environment:control, returning without creating or updating a cluster.")
+                return true, nil
+            } else if cl.Server == "https://kubernetes.default.svc" {
+                defaultCluster = &cl
+            } else if env, exists := cl.Labels["environment"]; exists && env == environment {
+                logger.Info("Found existing cluster with the specified environment, returning without creating or updating a cluster.")
+                return true, nil
+            }
+        }
+
+        if defaultCluster != nil {
+            // Initialize Labels map if it is nil
+            if defaultCluster.Labels == nil {
+                defaultCluster.Labels = make(map[string]string)
+            }
+
+            // Update the default cluster with the new environment label
+            if _, exists := defaultCluster.Labels["environment"]; !exists || defaultCluster.Labels["environment"] != environment {
+                defaultCluster.Labels["environment"] = environment
+                updateRequest := &cluster.ClusterUpdateRequest{
+                    Cluster: defaultCluster,
+                }
+                _, err := clusterClient.Update(ctx, updateRequest, callOptions...)
+                if err != nil {
+                    logger.Errorf("Failed to update default cluster: %v", err)
+                    if status.Code(err) == codes.DeadlineExceeded || status.Code(err) == codes.Unavailable {
+                        // Retry on transient errors
+                        return false, nil
+                    }
+                    return false, fmt.Errorf("failed to update default cluster: %w", err)
+                }
+                logger.Infof("Default cluster updated successfully with environment label: %s", environment)
+            }
+            return true, nil
+        }
+
+        // Define the new cluster configuration
+        newCluster := &cluster.ClusterCreateRequest{
+            Cluster: &appv1alpha1.Cluster{
+                Name:   clusterName,
+                Server: "https://kubernetes.default.svc",
+                Labels: map[string]string{
+                    "environment": environment,
+                },
+            },
+        }
+
+        // Create the new cluster
+        _, err = clusterClient.Create(ctx, newCluster, callOptions...)
+        if err != nil {
+            logger.Errorf("Failed to create cluster: %v", err)
+            if status.Code(err) == codes.DeadlineExceeded || status.Code(err) == codes.Unavailable {
+                // Retry on transient errors
+                return false, nil
+            }
+            return false, fmt.Errorf("failed to create cluster: %w", err)
+        }
+
+        logger.Infof("Cluster %s created successfully.", newCluster.Cluster.Name)
+        return true, nil
+    })
+
+    if err != nil {
+        return fmt.Errorf("exceeded retry limit for creating or listing clusters: %w", err)
+    }
+
+    return nil
+}
+
+// ArgoClusterOwnerAnnotation names the Terraform resource that registered an Argo CD cluster
+const ArgoClusterOwnerAnnotation = "alustan.io/terraform"
+
+// RegisterArgoCluster creates or updates a remote cluster labelled with its environment, the in-cluster
+// entry loses the environment label so Apps deploy to the remote cluster only. A cluster registered by
+// the owner under a previous server is removed.
+func RegisterArgoCluster(
+    logger *zap.SugaredLogger,
+    clusterClient cluster.ClusterServiceClient,
+    remote *appv1alpha1.Cluster,
+    owner, previousServer string,
+) error {
+    if clusterClient == nil {
+        return fmt.Errorf("clusterClient is nil")
+    }
+    environment := remote.Labels["environment"]
+
+    return retryArgo(logger, func(ctx context.Context, callOptions []grpc.CallOption) error {
+        clusters, err := clusterClient.List(ctx, &cluster.ClusterQuery{}, callOptions...)
+        if err != nil {
+            return fmt.Errorf("failed to list clusters: %w", err)
+        }
+
+        for i := range clusters.Items {
+            cl := &clusters.Items[i]
+            switch {
+            case cl.Server == remote.Server:
+                if cl.Annotations[ArgoClusterOwnerAnnotation] != owner {
+                    return fmt.Errorf("cluster %s is already registered and not managed by %s", remote.Server, owner)
+                }
+            case cl.Server == "https://kubernetes.default.svc" && cl.Labels["environment"] == environment:
+                delete(cl.Labels, "environment")
+                if _, err := clusterClient.Update(ctx, &cluster.ClusterUpdateRequest{Cluster: cl, UpdatedFields: []string{"labels"}}, callOptions...); err != nil {
+                    return fmt.Errorf("failed to remove the environment label of the default cluster: %w", err)
+                }
+                logger.Infof("Default cluster is no longer labelled with environment %s", environment)
+            }
+        }
+
+        if _, err := clusterClient.Create(ctx, &cluster.ClusterCreateRequest{Cluster: remote, Upsert: true}, callOptions...); err != nil {
+            return fmt.Errorf("failed to register cluster %s: %w", remote.Server, err)
+        }
+        logger.Infof("Cluster %s registered at %s", remote.Name, remote.Server)
+
+        if previousServer != "" && previousServer != remote.Server {
+            return deleteOwnedCluster(ctx, logger, clusterClient, clusters.Items, previousServer, owner, callOptions)
+        }
+        return nil
+    })
+}
+
+// DeleteArgoCluster removes the cluster registered by the owner at server, if it is still there
+func DeleteArgoCluster(
+    logger *zap.SugaredLogger,
+    clusterClient cluster.ClusterServiceClient,
+    server, owner string,
+) error {
+    if clusterClient == nil {
+        return fmt.Errorf("clusterClient is nil")
+    }
+
+    return retryArgo(logger, func(ctx context.Context, callOptions []grpc.CallOption) error {
+        clusters, err := clusterClient.List(ctx, &cluster.ClusterQuery{}, callOptions...)
+        if err != nil {
+            return fmt.Errorf("failed to list clusters: %w", err)
+        }
+        return deleteOwnedCluster(ctx, logger, clusterClient, clusters.Items, server, owner, callOptions)
+    })
+}
+
+// deleteOwnedCluster deletes the cluster at server when the owner registered it
+func deleteOwnedCluster(
+    ctx context.Context,
+    logger *zap.SugaredLogger,
+    clusterClient cluster.ClusterServiceClient,
+    clusters []appv1alpha1.Cluster,
+    server, owner string,
+    callOptions []grpc.CallOption,
+) error {
+    for _, cl := range clusters {
+        if cl.Server != server {
+            continue
+        }
+        if cl.Annotations[ArgoClusterOwnerAnnotation] != owner {
+            logger.Infof("Cluster %s is not managed by %s, leaving it in place", server, owner)
+            return nil
+        }
+        if _, err := clusterClient.Delete(ctx, &cluster.ClusterQuery{Server: server}, callOptions...); err != nil && status.Code(err) != codes.NotFound {
+            return fmt.Errorf("failed to delete cluster %s: %w", server, err)
+        }
+        logger.Infof("Cluster %s removed from Argo CD", server)
+        return nil
+    }
+    return nil
+}
+
+// retryArgo runs an Argo CD API call, retrying it on transient errors
+func retryArgo(logger *zap.SugaredLogger, call func(ctx context.Context, callOptions []grpc.CallOption) error) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    backoffConfig := wait.Backoff{
+        Steps:    3,
+        Duration: 5 * time.Second,
+        Factor:   1.5,
+        Jitter:   0.1,
+    }
+
+    var lastErr error
+    err := wait.ExponentialBackoff(backoffConfig, func() (bool, error) {
+        callOptions := []grpc.CallOption{
+            grpc.WaitForReady(true),
+        }
+        lastErr = call(ctx, callOptions)
+        if lastErr == nil {
+            return true, nil
+        }
+        logger.Error(lastErr)
+        if code := status.Code(errors.Unwrap(lastErr)); code == codes.DeadlineExceeded || code == codes.Unavailable {
+            return false, nil
+        }
+        return false, lastErr
+    })
+    if err == wait.ErrWaitTimeout {
+        return fmt.Errorf("exceeded retry limit: %w", lastErr)
+    }
+    return err
+}
@@ -0,0 +1,167 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// ClusterSecretNamespace is where the App controller looks up the cluster secret
+	ClusterSecretNamespace = "alustan"
+	// ClusterSecretTypeLabel marks the secret whose annotations resolve App placeholders
+	ClusterSecretTypeLabel = "alustan.io/secret-type"
+	// ClusterSecretEnvironmentLabel holds the environment the cluster secret belongs to
+	ClusterSecretEnvironmentLabel = "environment"
+
+	// publishedKeysAnnotation records which annotations each Terraform resource published
+	publishedKeysAnnotation = "alustan.io/published-keys"
+	managedByLabel          = "app.kubernetes.io/managed-by"
+	managedByValue          = "terraform-controller"
+)
+
+// PublishClusterSecret creates or updates the cluster secret of the environment with the values published by owner.
+// Annotations published earlier by owner that are no longer among values are removed; those of other owners are kept.
+func PublishClusterSecret(logger *zap.SugaredLogger, clientset kubernetes.Interface, environment, owner string, values map[string]string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := findClusterSecret(clientset, environment)
+		if err != nil {
+			return err
+		}
+
+		if secret == nil {
+			if len(values) == 0 {
+				return nil
+			}
+			secret = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("%s-cluster", environment),
+					Namespace: ClusterSecretNamespace,
+					Labels: map[string]string{
+						ClusterSecretTypeLabel:        "cluster",
+						ClusterSecretEnvironmentLabel: environment,
+						managedByLabel:                managedByValue,
+					},
+					Annotations: map[string]string{},
+				},
+			}
+			if err := setPublishedValues(secret, owner, values); err != nil {
+				return err
+			}
+			_, err = clientset.CoreV1().Secrets(ClusterSecretNamespace).Create(context.Background(), secret, metav1.CreateOptions{})
+			if err != nil {
+				logger.Infof("Failed to create cluster secret for environment %s: %v", environment, err)
+				return err
+			}
+			logger.Infof("Cluster secret %s created for environment %s", secret.Name, environment)
+			return nil
+		}
+
+		if err := setPublishedValues(secret, owner, values); err != nil {
+			return err
+		}
+		_, err = clientset.CoreV1().Secrets(ClusterSecretNamespace).Update(context.Background(), secret, metav1.UpdateOptions{})
+		if err != nil {
+			logger.Infof("Failed to update cluster secret %s: %v", secret.Name, err)
+			return err
+		}
+		logger.Infof("Cluster secret %s updated with %d values from %s", secret.Name, len(values), owner)
+		return nil
+	})
+}
+
+// UnpublishClusterSecret removes the values published by owner from the cluster secret of the environment.
+// A secret created by the controller is deleted once nothing is published in it anymore.
+func UnpublishClusterSecret(logger *zap.SugaredLogger, clientset kubernetes.Interface, environment, owner string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := findClusterSecret(clientset, environment)
+		if err != nil || secret == nil {
+			return err
+		}
+
+		if err := setPublishedValues(secret, owner, nil); err != nil {
+			return err
+		}
+
+		if secret.Labels[managedByLabel] == managedByValue && secret.Annotations[publishedKeysAnnotation] == "" {
+			err = clientset.CoreV1().Secrets(ClusterSecretNamespace).Delete(context.Background(), secret.Name, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				logger.Infof("Failed to delete cluster secret %s: %v", secret.Name, err)
+				return err
+			}
+			logger.Infof("Cluster secret %s deleted", secret.Name)
+			return nil
+		}
+
+		_, err = clientset.CoreV1().Secrets(ClusterSecretNamespace).Update(context.Background(), secret, metav1.UpdateOptions{})
+		if err != nil {
+			logger.Infof("Failed to update cluster secret %s: %v", secret.Name, err)
+		}
+		return err
+	})
+}
+
+// findClusterSecret returns the cluster secret of the environment, nil if there is none
+func findClusterSecret(clientset kubernetes.Interface, environment string) (*corev1.Secret, error) {
+	secrets, err := clientset.CoreV1().Secrets(ClusterSecretNamespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=cluster,%s=%s", ClusterSecretTypeLabel, ClusterSecretEnvironmentLabel, environment),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(secrets.Items) == 0 {
+		return nil, nil
+	}
+
+	// The App controller uses the first match, so publish into the same secret
+	return &secrets.Items[0], nil
+}
+
+// setPublishedValues replaces the annotations published by owner with values and records their keys
+func setPublishedValues(secret *corev1.Secret, owner string, values map[string]string) error {
+	published := map[string][]string{}
+	if raw := secret.Annotations[publishedKeysAnnotation]; raw != "" {
+		if err := json.Unmarshal([]byte(raw), &published); err != nil {
+			return fmt.Errorf("invalid %s annotation on secret %s: %v", publishedKeysAnnotation, secret.Name, err)
+		}
+	}
+
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	for _, key := range published[owner] {
+		delete(secret.Annotations, key)
+	}
+
+	keys := make([]string, 0, len(values))
+	for key, value := range values {
+		secret.Annotations[key] = value
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if len(keys) > 0 {
+		published[owner] = keys
+	} else {
+		delete(published, owner)
+	}
+
+	if len(published) == 0 {
+		delete(secret.Annotations, publishedKeysAnnotation)
+		return nil
+	}
+	raw, err := json.Marshal(published)
+	if err != nil {
+		return err
+	}
+	secret.Annotations[publishedKeysAnnotation] = string(raw)
+	return nil
+}
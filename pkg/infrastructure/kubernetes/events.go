@@ -0,0 +1,53 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+)
+
+// maxEventMessageLength keeps the end of long messages, where the log tail is
+const maxEventMessageLength = 1024
+
+// RecordEvent emits a Kubernetes Event on the Terraform resource, shown by kubectl describe.
+// Events are best effort, a failure is only logged.
+func RecordEvent(logger *zap.SugaredLogger, clientset kubernetes.Interface, observed *v1alpha1.Terraform, eventType, reason, message string) {
+	if len(message) > maxEventMessageLength {
+		message = "..." + message[len(message)-maxEventMessageLength+3:]
+	}
+
+	now := metav1.NewTime(time.Now())
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", observed.ObjectMeta.Name, now.UnixNano()),
+			Namespace: observed.ObjectMeta.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion:      v1alpha1.SchemaGroupVersion.String(),
+			Kind:            "Terraform",
+			Name:            observed.ObjectMeta.Name,
+			Namespace:       observed.ObjectMeta.Namespace,
+			UID:             observed.ObjectMeta.UID,
+			ResourceVersion: observed.ObjectMeta.ResourceVersion,
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         corev1.EventSource{Component: managedByValue},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+
+	_, err := clientset.CoreV1().Events(observed.ObjectMeta.Namespace).Create(context.Background(), event, metav1.CreateOptions{})
+	if err != nil {
+		logger.Infof("Failed to record %s event for %s/%s: %v", reason, observed.ObjectMeta.Namespace, observed.ObjectMeta.Name, err)
+	}
+}
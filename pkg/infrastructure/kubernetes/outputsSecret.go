@@ -0,0 +1,82 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// OutputsSecretType is the secret type label value of the Secrets holding sensitive outputs
+const OutputsSecretType = "outputs"
+
+// ApplyOutputsSecret creates or replaces the Secret holding the sensitive outputs of a Terraform resource.
+// The Secret is labelled with the environment so the App controller can resolve placeholders from it.
+func ApplyOutputsSecret(logger *zap.SugaredLogger, clientset kubernetes.Interface, namespace, name, environment string, owner metav1.OwnerReference, data map[string][]byte) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secrets := clientset.CoreV1().Secrets(namespace)
+
+		secret, err := secrets.Get(context.Background(), name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			secret = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: namespace,
+				},
+			}
+		} else if err != nil {
+			return err
+		} else if secret.Labels[managedByLabel] != managedByValue {
+			return fmt.Errorf("secret %s/%s exists and is not managed by the controller", namespace, name)
+		}
+
+		if secret.Labels == nil {
+			secret.Labels = map[string]string{}
+		}
+		secret.Labels[ClusterSecretTypeLabel] = OutputsSecretType
+		secret.Labels[ClusterSecretEnvironmentLabel] = environment
+		secret.Labels[managedByLabel] = managedByValue
+		secret.OwnerReferences = []metav1.OwnerReference{owner}
+		secret.Type = corev1.SecretTypeOpaque
+		secret.Data = data
+
+		if secret.ResourceVersion == "" {
+			_, err = secrets.Create(context.Background(), secret, metav1.CreateOptions{})
+		} else {
+			_, err = secrets.Update(context.Background(), secret, metav1.UpdateOptions{})
+		}
+		if err != nil {
+			logger.Infof("Failed to write outputs secret %s/%s: %v", namespace, name, err)
+			return err
+		}
+
+		logger.Infof("Outputs secret %s/%s written with %d keys", namespace, name, len(data))
+		return nil
+	})
+}
+
+// DeleteOutputsSecret deletes the outputs Secret when the controller manages it
+func DeleteOutputsSecret(logger *zap.SugaredLogger, clientset kubernetes.Interface, namespace, name string) error {
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if secret.Labels[managedByLabel] != managedByValue || secret.Labels[ClusterSecretTypeLabel] != OutputsSecretType {
+		return nil
+	}
+
+	err = clientset.CoreV1().Secrets(namespace).Delete(context.Background(), name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	logger.Infof("Outputs secret %s/%s deleted", namespace, name)
+	return nil
+}
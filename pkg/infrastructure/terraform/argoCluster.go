@@ -0,0 +1,142 @@
+package terraform
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/cluster"
+	appv1alpha1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+	kubernetesPkg "github.com/alustan/alustan/pkg/infrastructure/kubernetes"
+)
+
+// registerArgoCluster registers the cluster described by the outputs in Argo CD, labelled with the environment
+func registerArgoCluster(
+	logger *zap.SugaredLogger,
+	clusterClient cluster.ClusterServiceClient,
+	observed *v1alpha1.Terraform,
+	outputs map[string]runtime.RawExtension,
+) (*v1alpha1.ArgoClusterStatus, error) {
+	remote, err := argoCluster(observed, outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	previousServer := ""
+	if observed.Status.ArgoCluster != nil {
+		previousServer = observed.Status.ArgoCluster.Server
+	}
+	if err := kubernetesPkg.RegisterArgoCluster(logger, clusterClient, remote, clusterSecretOwner(observed), previousServer); err != nil {
+		return nil, err
+	}
+	return &v1alpha1.ArgoClusterStatus{Name: remote.Name, Server: remote.Server}, nil
+}
+
+// removeArgoCluster removes the cluster registered from the outputs from Argo CD
+func removeArgoCluster(logger *zap.SugaredLogger, clusterClient cluster.ClusterServiceClient, observed *v1alpha1.Terraform) error {
+	if observed.Status.ArgoCluster == nil {
+		return nil
+	}
+	return kubernetesPkg.DeleteArgoCluster(logger, clusterClient, observed.Status.ArgoCluster.Server, clusterSecretOwner(observed))
+}
+
+// argoCluster builds the Argo CD cluster from the outputs mapped in spec.argoCluster
+func argoCluster(observed *v1alpha1.Terraform, outputs map[string]runtime.RawExtension) (*appv1alpha1.Cluster, error) {
+	spec := observed.Spec.ArgoCluster
+	if observed.Spec.Environment == "" {
+		return nil, fmt.Errorf("argoCluster requires an environment")
+	}
+
+	output := func(field, name string) (string, error) {
+		raw, ok := outputs[name]
+		if !ok {
+			return "", fmt.Errorf("argoCluster %s: output %s not found", field, name)
+		}
+		value, err := outputString(raw)
+		if err != nil {
+			return "", fmt.Errorf("argoCluster %s: output %s: %v", field, name, err)
+		}
+		if value == "" {
+			return "", fmt.Errorf("argoCluster %s: output %s is empty", field, name)
+		}
+		return value, nil
+	}
+
+	server, err := output("serverOutput", spec.ServerOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	name := spec.Name
+	if name == "" {
+		name = observed.ObjectMeta.Name
+	}
+
+	remote := &appv1alpha1.Cluster{
+		Name:   name,
+		Server: server,
+		Labels: map[string]string{
+			"environment": observed.Spec.Environment,
+		},
+		Annotations: map[string]string{
+			kubernetesPkg.ArgoClusterOwnerAnnotation: clusterSecretOwner(observed),
+		},
+	}
+
+	if spec.CADataOutput != "" {
+		caData, err := output("caDataOutput", spec.CADataOutput)
+		if err != nil {
+			return nil, err
+		}
+		remote.Config.TLSClientConfig.CAData = pemData(caData)
+	}
+
+	credentials := 0
+	if spec.BearerTokenOutput != "" {
+		credentials++
+		remote.Config.BearerToken, err = output("bearerTokenOutput", spec.BearerTokenOutput)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if spec.AWSAuth != nil {
+		credentials++
+		awsAuth := &appv1alpha1.AWSAuthConfig{}
+		if awsAuth.ClusterName, err = output("awsAuth.clusterNameOutput", spec.AWSAuth.ClusterNameOutput); err != nil {
+			return nil, err
+		}
+		if spec.AWSAuth.RoleARNOutput != "" {
+			if awsAuth.RoleARN, err = output("awsAuth.roleARNOutput", spec.AWSAuth.RoleARNOutput); err != nil {
+				return nil, err
+			}
+		}
+		remote.Config.AWSAuthConfig = awsAuth
+	}
+	if spec.ExecProvider != nil {
+		credentials++
+		remote.Config.ExecProviderConfig = &appv1alpha1.ExecProviderConfig{
+			Command:     spec.ExecProvider.Command,
+			Args:        spec.ExecProvider.Args,
+			Env:         spec.ExecProvider.Env,
+			APIVersion:  spec.ExecProvider.APIVersion,
+			InstallHint: spec.ExecProvider.InstallHint,
+		}
+	}
+	if credentials != 1 {
+		return nil, fmt.Errorf("argoCluster requires exactly one of bearerTokenOutput, awsAuth or execProvider")
+	}
+
+	return remote, nil
+}
+
+// pemData returns the PEM certificates of a CA output, which providers usually export base64 encoded
+func pemData(value string) []byte {
+	if decoded, err := base64.StdEncoding.DecodeString(value); err == nil && bytes.Contains(decoded, []byte("-----BEGIN")) {
+		return decoded
+	}
+	return []byte(value)
+}
@@ -0,0 +1,77 @@
+package terraform
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+	"github.com/alustan/alustan/pkg/containers"
+)
+
+const (
+	pluginCachePath = "/terraform-cache/plugins"
+	dataDirPath     = "/terraform-cache/data"
+)
+
+// CacheClaimName returns the name of the per-resource PVC holding the plugin cache and .terraform directory
+func CacheClaimName(name string) string {
+	return fmt.Sprintf("%s-terraform-cache", name)
+}
+
+// cacheClaim returns the claim used for the cache and whether it is owned by this resource alone
+func cacheClaim(observed *v1alpha1.Terraform) (string, bool) {
+	if observed.Spec.Cache.ClaimName != "" {
+		return observed.Spec.Cache.ClaimName, false
+	}
+	return CacheClaimName(observed.ObjectMeta.Name), true
+}
+
+// ensureCache provisions the cache claim and returns its mounts and the env variables pointing Terraform at it
+func ensureCache(logger *zap.SugaredLogger, clientset kubernetes.Interface, observed *v1alpha1.Terraform) ([]containers.ClaimMount, map[string]string, error) {
+	cache := observed.Spec.Cache
+	if !cache.Enabled {
+		return nil, nil, nil
+	}
+
+	claimName, owned := cacheClaim(observed)
+
+	// A shared claim is used by the runners of several resources at once
+	accessMode := v1.PersistentVolumeAccessMode(cache.AccessMode)
+	if accessMode == "" && !owned {
+		accessMode = v1.ReadWriteMany
+	}
+
+	err := containers.EnsurePVC(logger, clientset, observed.ObjectMeta.Namespace, claimName, containers.PVCSettings{
+		Size:             cache.Size,
+		StorageClassName: cache.StorageClassName,
+		AccessMode:       accessMode,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to ensure cache volume: %v", err)
+	}
+
+	// Sub paths are created by the kubelet, so the plugin cache directory exists before Terraform starts.
+	// Each resource keeps its own .terraform directory, the provider plugins are shared
+	mounts := []containers.ClaimMount{
+		{ClaimName: claimName, MountPath: pluginCachePath, SubPath: "plugins"},
+		{ClaimName: claimName, MountPath: dataDirPath, SubPath: fmt.Sprintf("data/%s", observed.ObjectMeta.Name)},
+	}
+	env := map[string]string{
+		"TF_PLUGIN_CACHE_DIR": pluginCachePath,
+		"TF_DATA_DIR":         dataDirPath,
+	}
+
+	return mounts, env, nil
+}
+
+// deleteCache removes the per-resource cache claim; shared claims are left to their owner
+func deleteCache(logger *zap.SugaredLogger, clientset kubernetes.Interface, observed *v1alpha1.Terraform) error {
+	claimName, owned := cacheClaim(observed)
+	if !owned {
+		return nil
+	}
+	return containers.DeletePVC(logger, clientset, observed.ObjectMeta.Namespace, claimName)
+}
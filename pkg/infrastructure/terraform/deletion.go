@@ -0,0 +1,142 @@
+package terraform
+
+import (
+	"fmt"
+
+	clusterpkg "github.com/argoproj/argo-cd/v2/pkg/apiclient/cluster"
+	"go.uber.org/zap"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+	"github.com/alustan/alustan/pkg/containers"
+	kubernetesPkg "github.com/alustan/alustan/pkg/infrastructure/kubernetes"
+)
+
+const (
+	// DeletionPolicyDestroy destroys the infrastructure when the resource is deleted
+	DeletionPolicyDestroy = "Destroy"
+	// DeletionPolicyOrphan leaves the infrastructure in place when the resource is deleted
+	DeletionPolicyOrphan = "Orphan"
+
+	// ProtectedLabel marks resources whose destroy must be confirmed
+	ProtectedLabel = "alustan.io/protected"
+	// ConfirmDestroyAnnotation confirms the destroy of a protected resource when set to its name
+	ConfirmDestroyAnnotation = "alustan.io/confirm-destroy"
+
+	destroyedMessage = "Destroy completed successfully"
+	orphanedMessage  = "Deletion completed, infrastructure left in place"
+)
+
+// DeletionPolicy returns the deletion policy of the resource.
+// Without one the infrastructure is destroyed when there is a module or a destroy script to do it.
+func DeletionPolicy(observed *v1alpha1.Terraform) (string, error) {
+	switch observed.Spec.DeletionPolicy {
+	case DeletionPolicyDestroy, DeletionPolicyOrphan:
+		return observed.Spec.DeletionPolicy, nil
+	case "":
+		if IsModule(observed) || observed.Spec.Scripts.Destroy != "" {
+			return DeletionPolicyDestroy, nil
+		}
+		return DeletionPolicyOrphan, nil
+	default:
+		return "", fmt.Errorf("unknown deletionPolicy %s, expected %s or %s", observed.Spec.DeletionPolicy, DeletionPolicyDestroy, DeletionPolicyOrphan)
+	}
+}
+
+// DestroyBlocked reports whether the resource is protected and its destroy not yet confirmed
+func DestroyBlocked(observed *v1alpha1.Terraform) bool {
+	if observed.ObjectMeta.Labels[ProtectedLabel] != "true" {
+		return false
+	}
+	return observed.ObjectMeta.Annotations[ConfirmDestroyAnnotation] != observed.ObjectMeta.Name
+}
+
+// DeletionCompleted reports whether the status is the last one of a deleted resource
+func DeletionCompleted(status v1alpha1.TerraformStatus) bool {
+	return status.State == "Success" && (status.Message == destroyedMessage || status.Message == orphanedMessage)
+}
+
+// OrphanTerraform releases the resource without running a destroy, the infrastructure is left in place
+func OrphanTerraform(
+	logger *zap.SugaredLogger,
+	clientset kubernetes.Interface,
+	dynamicClient dynamic.Interface,
+	clusterClient clusterpkg.ClusterServiceClient,
+	observed *v1alpha1.Terraform,
+) v1alpha1.TerraformStatus {
+	logger.Infof("Orphaning the infrastructure of %s/%s", observed.ObjectMeta.Namespace, observed.ObjectMeta.Name)
+
+	status := releaseResource(logger, clientset, dynamicClient, clusterClient, observed)
+	if status.State == "Error" {
+		return status
+	}
+
+	status.State = "Success"
+	status.Message = orphanedMessage
+	return status
+}
+
+// releaseResource deletes what the controller created for the resource and removes its finalizer
+func releaseResource(
+	logger *zap.SugaredLogger,
+	clientset kubernetes.Interface,
+	dynamicClient dynamic.Interface,
+	clusterClient clusterpkg.ClusterServiceClient,
+	observed *v1alpha1.Terraform,
+) v1alpha1.TerraformStatus {
+	var status v1alpha1.TerraformStatus
+
+	// The run history goes away with the resource, so do the Jobs holding its logs
+	if err := containers.PruneRunJobs(logger, clientset, observed.ObjectMeta.Namespace, observed.ObjectMeta.Name, nil); err != nil {
+		status.State = "Error"
+		status.Message = fmt.Sprintf("Failed to delete runner jobs: %v", err)
+		return status
+	}
+
+	// Saved plans are of no use once the resource is gone
+	if err := containers.DeletePVC(logger, clientset, observed.ObjectMeta.Namespace, PlanClaimName(observed.ObjectMeta.Name)); err != nil {
+		status.State = "Error"
+		status.Message = fmt.Sprintf("Failed to delete plan volume: %v", err)
+		return status
+	}
+
+	// The per-resource cache is of no use once the resource is gone
+	if err := deleteCache(logger, clientset, observed); err != nil {
+		status.State = "Error"
+		status.Message = fmt.Sprintf("Failed to delete cache volume: %v", err)
+		return status
+	}
+
+	// Apps must not resolve placeholders against a resource that is gone
+	if err := unpublishOutputs(logger, clientset, observed); err != nil {
+		status.State = "Error"
+		status.Message = fmt.Sprintf("Failed to remove outputs from the cluster secret: %v", err)
+		return status
+	}
+
+	// Argo CD must not deploy to a cluster that is gone or no longer managed
+	if err := removeArgoCluster(logger, clusterClient, observed); err != nil {
+		status.State = "Error"
+		status.Message = fmt.Sprintf("Failed to remove the Argo CD cluster: %v", err)
+		return status
+	}
+
+	// ClusterRoles are not namespaced, so they would outlive the resource
+	if err := containers.DeleteRunnerRoles(logger, clientset, observed.ObjectMeta.Name, observed.ObjectMeta.Namespace); err != nil {
+		status.State = "Error"
+		status.Message = fmt.Sprintf("Failed to delete runner roles: %v", err)
+		return status
+	}
+
+	logger.Info("Removing finalizers")
+
+	if err := kubernetesPkg.RemoveFinalizer(logger, dynamicClient, observed.ObjectMeta.Name, observed.ObjectMeta.Namespace); err != nil {
+		logger.Errorf("Failed to remove finalizer for %s/%s: %v", observed.ObjectMeta.Namespace, observed.ObjectMeta.Name, err)
+		status.State = "Error"
+		status.Message = fmt.Sprintf("Failed to remove finalizer: %v", err)
+		return status
+	}
+
+	return status
+}
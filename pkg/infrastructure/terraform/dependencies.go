@@ -0,0 +1,221 @@
+package terraform
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+)
+
+// outputReferencePattern matches a variable whose whole value is a single dependency output
+var outputReferencePattern = regexp.MustCompile(`^\{\{\s*\.deps\.([A-Za-z0-9_]+)\.outputs\.([A-Za-z0-9_]+)\s*\}\}$`)
+
+// depsReferencePattern matches a template action referencing .deps, variables without one are kept literally
+var depsReferencePattern = regexp.MustCompile(`\{\{[^}]*\.deps\b`)
+
+// findTerraform returns the resource with the given name, nil when it does not exist
+func findTerraform(resources []*v1alpha1.Terraform, name string) *v1alpha1.Terraform {
+	for _, resource := range resources {
+		if resource.ObjectMeta.Name == name {
+			return resource
+		}
+	}
+	return nil
+}
+
+// DependencyCycle returns an error when the dependencies of observed lead back to it
+func DependencyCycle(observed *v1alpha1.Terraform, resources []*v1alpha1.Terraform) error {
+	visiting := map[string]bool{}
+	done := map[string]bool{}
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		if visiting[name] {
+			return fmt.Errorf("dependency cycle: %s", strings.Join(append(path, name), " -> "))
+		}
+		if done[name] {
+			return nil
+		}
+		resource := findTerraform(resources, name)
+		if resource == nil {
+			return nil
+		}
+
+		visiting[name] = true
+		for _, dependency := range resource.Spec.DependsOn {
+			if err := visit(dependency, append(path, name)); err != nil {
+				return err
+			}
+		}
+		visiting[name] = false
+		done[name] = true
+		return nil
+	}
+
+	return visit(observed.ObjectMeta.Name, nil)
+}
+
+// PendingDependencies returns the dependencies that are missing or have not completed their latest spec
+func PendingDependencies(observed *v1alpha1.Terraform, resources []*v1alpha1.Terraform) []string {
+	var pending []string
+	for _, name := range observed.Spec.DependsOn {
+		dependency := findTerraform(resources, name)
+		if dependency == nil ||
+			dependency.ObjectMeta.DeletionTimestamp != nil ||
+			dependency.Status.State != "Completed" ||
+			int64(dependency.Status.ObservedGeneration) < dependency.GetGeneration() {
+			pending = append(pending, name)
+		}
+	}
+	return pending
+}
+
+// PendingDependents returns the resources depending on observed, which must be destroyed before it
+func PendingDependents(observed *v1alpha1.Terraform, resources []*v1alpha1.Terraform) []string {
+	var pending []string
+	for _, resource := range resources {
+		for _, name := range resource.Spec.DependsOn {
+			if name == observed.ObjectMeta.Name && resource.ObjectMeta.Name != observed.ObjectMeta.Name {
+				pending = append(pending, resource.ObjectMeta.Name)
+				break
+			}
+		}
+	}
+	sort.Strings(pending)
+	return pending
+}
+
+// Dependents returns the names of the resources listing name in dependsOn
+func Dependents(name string, resources []*v1alpha1.Terraform) []string {
+	var dependents []string
+	for _, resource := range resources {
+		for _, dependency := range resource.Spec.DependsOn {
+			if dependency == name {
+				dependents = append(dependents, resource.ObjectMeta.Name)
+				break
+			}
+		}
+	}
+	return dependents
+}
+
+// DependencyHash hashes the outputs of the dependencies, sensitive ones included, so a change re-applies observed
+func DependencyHash(clientset kubernetes.Interface, observed *v1alpha1.Terraform, resources []*v1alpha1.Terraform) (string, error) {
+	hashed := make(map[string]interface{}, len(observed.Spec.DependsOn))
+	for _, name := range observed.Spec.DependsOn {
+		dependency := findTerraform(resources, name)
+		if dependency == nil {
+			return "", fmt.Errorf("dependency %s not found", name)
+		}
+
+		var sensitive map[string][]byte
+		if ref := dependency.Status.OutputsSecretRef; ref != nil {
+			secret, err := clientset.CoreV1().Secrets(dependency.ObjectMeta.Namespace).Get(context.Background(), ref.Name, metav1.GetOptions{})
+			if err != nil {
+				return "", fmt.Errorf("dependency %s: failed to get outputs secret %s: %v", name, ref.Name, err)
+			}
+			sensitive = secret.Data
+		}
+
+		hashed[name] = map[string]interface{}{
+			"outputs":   dependency.Status.PostDeployOutput,
+			"sensitive": sensitive,
+		}
+	}
+
+	raw, err := json.Marshal(hashed)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])[:16], nil
+}
+
+// ResolveDependencies returns a copy of observed whose variables reference the outputs of its dependencies.
+// Only variables referencing .deps are rendered as templates, other values are kept as is even when they hold {{.
+// A variable that is exactly a sensitive output is read from the outputs Secret of the dependency by the kubelet,
+// so its value never appears in the runner Job.
+func ResolveDependencies(observed *v1alpha1.Terraform, resources []*v1alpha1.Terraform) (*v1alpha1.Terraform, error) {
+	if len(observed.Spec.DependsOn) == 0 {
+		return observed, nil
+	}
+
+	deps := make(map[string]interface{}, len(observed.Spec.DependsOn))
+	for _, name := range observed.Spec.DependsOn {
+		dependency := findTerraform(resources, name)
+		if dependency == nil {
+			return nil, fmt.Errorf("dependency %s not found", name)
+		}
+
+		outputs := make(map[string]interface{}, len(dependency.Status.PostDeployOutput))
+		for key, output := range dependency.Status.PostDeployOutput {
+			value, err := outputString(output)
+			if err != nil {
+				return nil, fmt.Errorf("dependency %s: output %s: %v", name, key, err)
+			}
+			outputs[key] = value
+		}
+		deps[name] = map[string]interface{}{"outputs": outputs}
+	}
+	data := map[string]interface{}{"deps": deps}
+
+	resolved := observed.DeepCopyObject().(*v1alpha1.Terraform)
+	resolved.Spec.Variables = make(map[string]string, len(observed.Spec.Variables))
+	resolved.Spec.VariablesFrom = append([]v1alpha1.VariableFrom(nil), observed.Spec.VariablesFrom...)
+
+	for key, value := range observed.Spec.Variables {
+		if !depsReferencePattern.MatchString(value) {
+			resolved.Spec.Variables[key] = value
+			continue
+		}
+
+		if match := outputReferencePattern.FindStringSubmatch(strings.TrimSpace(value)); match != nil {
+			if ref := sensitiveOutputRef(findTerraform(resources, match[1]), match[2]); ref != nil {
+				resolved.Spec.VariablesFrom = append(resolved.Spec.VariablesFrom, v1alpha1.VariableFrom{
+					Name:      key,
+					ValueFrom: v1alpha1.VariableSource{SecretKeyRef: ref},
+				})
+				continue
+			}
+		}
+
+		tmpl, err := template.New(key).Option("missingkey=error").Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("variable %s: %v", key, err)
+		}
+		var rendered bytes.Buffer
+		if err := tmpl.Execute(&rendered, data); err != nil {
+			return nil, fmt.Errorf("variable %s: %v", key, err)
+		}
+		resolved.Spec.Variables[key] = rendered.String()
+	}
+
+	return resolved, nil
+}
+
+// sensitiveOutputRef returns the Secret key holding a sensitive output of the dependency, nil when the output is not sensitive
+func sensitiveOutputRef(dependency *v1alpha1.Terraform, output string) *corev1.SecretKeySelector {
+	if dependency == nil || dependency.Status.OutputsSecretRef == nil {
+		return nil
+	}
+	ref := dependency.Status.OutputsSecretRef
+	if !containsString(ref.Keys, output) {
+		return nil
+	}
+	return &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: ref.Name},
+		Key:                  output,
+	}
+}
@@ -0,0 +1,106 @@
+package terraform
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+)
+
+func TestResolveDependencies(t *testing.T) {
+	network := &v1alpha1.Terraform{
+		ObjectMeta: metav1.ObjectMeta{Name: "network"},
+		Status: v1alpha1.TerraformStatus{
+			PostDeployOutput: map[string]runtime.RawExtension{
+				"vpc_id":  {Raw: []byte(`"vpc-123"`)},
+				"subnets": {Raw: []byte(`["a","b"]`)},
+			},
+			OutputsSecretRef: &v1alpha1.OutputsSecretRef{Name: "network-outputs", Keys: []string{"password"}},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		variables     map[string]string
+		want          map[string]string
+		wantSecretRef map[string]string
+		wantErr       bool
+	}{
+		{
+			name:      "output reference",
+			variables: map[string]string{"TF_VAR_vpc_id": "{{ .deps.network.outputs.vpc_id }}"},
+			want:      map[string]string{"TF_VAR_vpc_id": "vpc-123"},
+		},
+		{
+			name:      "non string output",
+			variables: map[string]string{"TF_VAR_subnets": "{{.deps.network.outputs.subnets}}"},
+			want:      map[string]string{"TF_VAR_subnets": `["a","b"]`},
+		},
+		{
+			name:      "index syntax",
+			variables: map[string]string{"TF_VAR_vpc_id": `vpc={{ index .deps "network" "outputs" "vpc_id" }}`},
+			want:      map[string]string{"TF_VAR_vpc_id": "vpc=vpc-123"},
+		},
+		{
+			name: "literal braces next to a dependency",
+			variables: map[string]string{
+				"TF_VAR_vpc_id":   "{{ .deps.network.outputs.vpc_id }}",
+				"TF_VAR_template": "Hello {{ name }}, {{.Values.host}}",
+			},
+			want: map[string]string{
+				"TF_VAR_vpc_id":   "vpc-123",
+				"TF_VAR_template": "Hello {{ name }}, {{.Values.host}}",
+			},
+		},
+		{
+			name:          "sensitive output",
+			variables:     map[string]string{"TF_VAR_password": "{{ .deps.network.outputs.password }}"},
+			want:          map[string]string{},
+			wantSecretRef: map[string]string{"TF_VAR_password": "network-outputs/password"},
+		},
+		{
+			name:      "missing output",
+			variables: map[string]string{"TF_VAR_zone": "{{ .deps.network.outputs.zone }}"},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			observed := &v1alpha1.Terraform{
+				ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+				Spec: v1alpha1.TerraformSpec{
+					DependsOn: []string{"network"},
+					Variables: tt.variables,
+				},
+			}
+
+			resolved, err := ResolveDependencies(observed, []*v1alpha1.Terraform{network, observed})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveDependencies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(resolved.Spec.Variables, tt.want) {
+				t.Fatalf("variables = %v, want %v", resolved.Spec.Variables, tt.want)
+			}
+
+			secretRefs := map[string]string{}
+			for _, source := range resolved.Spec.VariablesFrom {
+				if ref := source.ValueFrom.SecretKeyRef; ref != nil {
+					secretRefs[source.Name] = ref.Name + "/" + ref.Key
+				}
+			}
+			if len(tt.wantSecretRef) == 0 {
+				tt.wantSecretRef = map[string]string{}
+			}
+			if !reflect.DeepEqual(secretRefs, tt.wantSecretRef) {
+				t.Fatalf("secret references = %v, want %v", secretRefs, tt.wantSecretRef)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package terraform
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+	"github.com/alustan/alustan/pkg/infrastructure/engine"
+)
+
+// DriftedCondition reports whether the live infrastructure differs from the applied configuration
+const DriftedCondition = "Drifted"
+
+// DetectDrift runs a plan-only pass with the applied image and records any drift in the status.
+// It returns the updated status and whether drift was found.
+func DetectDrift(
+	logger *zap.SugaredLogger,
+	clientset kubernetes.Interface,
+	observed *v1alpha1.Terraform,
+	taggedImageName, secretName string,
+	envVars map[string]string,
+) (v1alpha1.TerraformStatus, bool, error) {
+	status := observed.Status
+	status.Conditions = append([]metav1.Condition(nil), observed.Status.Conditions...)
+
+	if planScript(observed) == "" {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               DriftedCondition,
+			Status:             metav1.ConditionUnknown,
+			Reason:             "NoPlanScript",
+			Message:            "drift detection requires a plan script",
+			ObservedGeneration: observed.GetGeneration(),
+		})
+		status.Drift = &v1alpha1.DriftStatus{LastChecked: metav1.Now()}
+		return status, false, nil
+	}
+
+	logger.Infof("Checking %s/%s for drift", observed.ObjectMeta.Namespace, observed.ObjectMeta.Name)
+
+	recorder := newRunRecorder(logger, clientset, observed)
+	plan, err := executePlan(logger, clientset, observed, taggedImageName, secretName, envVars, "drift", "/workspace/drift.tfplan", nil, recorder)
+	status.Runs = recorder.history()
+	status.LogTail = recorder.logTail
+	if err != nil {
+		return status, false, fmt.Errorf("drift check failed: %v", err)
+	}
+
+	// Zero counts read from nothing would claim the infrastructure is in sync
+	if !engine.PlanParsed(plan) {
+		logger.Infof("Drift check for %s/%s: %s", observed.ObjectMeta.Namespace, observed.ObjectMeta.Name, plan.Summary)
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               DriftedCondition,
+			Status:             metav1.ConditionUnknown,
+			Reason:             "PlanUnparsed",
+			Message:            "the plan summary was not found in the runner output, see status.logTail",
+			ObservedGeneration: observed.GetGeneration(),
+		})
+		status.Drift = &v1alpha1.DriftStatus{LastChecked: metav1.Now()}
+		return status, false, nil
+	}
+
+	drifted := plan.Add+plan.Change+plan.Destroy > 0
+	status.Drift = &v1alpha1.DriftStatus{
+		LastChecked: metav1.Now(),
+		Resources:   plan.Resources,
+	}
+
+	condition := metav1.Condition{
+		Type:               DriftedCondition,
+		Status:             metav1.ConditionFalse,
+		Reason:             "InSync",
+		Message:            "infrastructure matches the applied configuration",
+		ObservedGeneration: observed.GetGeneration(),
+	}
+	if drifted {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "DriftDetected"
+		condition.Message = plan.Summary
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+
+	logger.Infof("Drift check for %s/%s: %s", observed.ObjectMeta.Namespace, observed.ObjectMeta.Name, plan.Summary)
+	return status, drifted, nil
+}
+
+// MarkRemediated records that drift was corrected by a re-apply
+func MarkRemediated(status *v1alpha1.TerraformStatus, generation int64) {
+	if status.Drift != nil {
+		status.Drift.Resources = nil
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               DriftedCondition,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Remediated",
+		Message:            "drift was corrected by re-applying the configuration",
+		ObservedGeneration: generation,
+	})
+}
@@ -0,0 +1,213 @@
+package terraform
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+	"github.com/alustan/alustan/pkg/containers"
+	"github.com/alustan/alustan/pkg/util"
+)
+
+const (
+	defaultActiveDeadlineSeconds int64 = 7200
+
+	// waitGracePeriod leaves time for the Job controller to report a deadline it enforced
+	waitGracePeriod = 2 * time.Minute
+
+	// logDrainTimeout bounds the wait for the log stream once the Job is over
+	logDrainTimeout = 10 * time.Second
+)
+
+// jobSettings returns the Job limits configured in spec.runner, falling back to the defaults
+func jobSettings(observed *v1alpha1.Terraform) containers.JobSettings {
+	runner := observed.Spec.Runner
+
+	settings := containers.JobSettings{
+		BackoffLimit:            0,
+		ActiveDeadlineSeconds:   defaultActiveDeadlineSeconds,
+		TTLSecondsAfterFinished: runner.TTLSecondsAfterFinished,
+	}
+	if runner.BackoffLimit != nil {
+		settings.BackoffLimit = *runner.BackoffLimit
+	}
+	if runner.ActiveDeadlineSeconds != nil && *runner.ActiveDeadlineSeconds > 0 {
+		settings.ActiveDeadlineSeconds = *runner.ActiveDeadlineSeconds
+	}
+	if runner.PodTemplate != nil {
+		settings.PodTemplate = runner.PodTemplate.Raw
+	}
+	// spec.timeout bounds every run, the runner is interrupted when it passes
+	if timeout := observed.Spec.Timeout; timeout != nil && timeout.Duration > 0 {
+		settings.ActiveDeadlineSeconds = int64(math.Ceil(timeout.Duration.Seconds()))
+	}
+
+	return settings
+}
+
+// runnerRBAC returns the runner identity declared in the spec under the controller wide policy
+func runnerRBAC(observed *v1alpha1.Terraform) containers.RunnerRBAC {
+	return containers.RunnerRBAC{
+		ServiceAccountName: observed.Spec.ServiceAccountName,
+		Rules:              observed.Spec.RBAC.Rules,
+		ClusterRules:       observed.Spec.RBAC.ClusterRules,
+		Annotations:        observed.Spec.RBAC.ServiceAccountAnnotations,
+		Policy:             util.GetRunnerRBACPolicy(),
+	}
+}
+
+// collectsOutputs reports whether a run phase reports outputs: the apply of a module and the postDeploy script
+func collectsOutputs(observed *v1alpha1.Terraform, app string) bool {
+	return app == "postdeploy" || (app == "deploy" && IsModule(observed))
+}
+
+// runJob creates a runner Job, waits for it to finish and records it in the run history.
+// It returns the outputs document of the phases that report outputs.
+func runJob(
+	logger *zap.SugaredLogger,
+	clientset kubernetes.Interface,
+	observed *v1alpha1.Terraform,
+	scriptContent string,
+	envVars map[string]string,
+	taggedImageName, secretName, app string,
+	volumeClaims []containers.ClaimMount,
+	recorder *runRecorder,
+) (string, []byte, error) {
+	settings := jobSettings(observed)
+	settings.CollectOutputs = collectsOutputs(observed, app)
+	// Only the latest saved plan is kept, a new plan supersedes the others
+	if app == "plan" {
+		settings.InitScript = prunePlansScript
+	}
+	started := metav1.Now()
+
+	secretValues, err := validateVariableSources(clientset, observed)
+	if err != nil {
+		return "", nil, err
+	}
+	envSources := variableSources(observed)
+
+	serviceAccountName, err := containers.CreateOrUpdateServiceAccountAndRoles(logger, clientset, observed.ObjectMeta.Name, observed.ObjectMeta.Namespace, runnerRBAC(observed))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to prepare runner service account: %v", err)
+	}
+	settings.ServiceAccountName = serviceAccountName
+	if IsModule(observed) {
+		settings.Command = []string{"/bin/sh", "-c"}
+	}
+
+	cacheMounts, cacheEnv, err := ensureCache(logger, clientset, observed)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(cacheEnv) > 0 {
+		runEnv := make(map[string]string, len(envVars)+len(cacheEnv))
+		for key, value := range envVars {
+			runEnv[key] = value
+		}
+		for key, value := range cacheEnv {
+			runEnv[key] = value
+		}
+		envVars = runEnv
+		volumeClaims = append(append([]containers.ClaimMount(nil), volumeClaims...), cacheMounts...)
+	}
+
+	var jobName string
+	var createErr error
+	err = retry.OnError(retry.DefaultRetry, func(err error) bool {
+		logger.Infof("Error occurred: %v", err)
+		return strings.Contains(err.Error(), "timeout")
+	}, func() error {
+		jobName, createErr = containers.CreateRunJob(logger, clientset, observed.ObjectMeta.Name, observed.ObjectMeta.Namespace, scriptContent, envVars, envSources, taggedImageName, secretName, app, volumeClaims, settings)
+		return createErr
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create %s job: %v", app, err)
+	}
+
+	recorder.start(jobName, app, taggedImageName)
+
+	// Follow the runner log while the Job runs instead of reading it once it is over
+	tail := containers.NewLogTail(logTailLines)
+	tail.Mask(secretValues...)
+	tail.Mask(sensitiveValues(envVars)...)
+	tail.Mask(outputsSecretValues(clientset, observed)...)
+	streamCtx, stopStream := context.WithCancel(context.Background())
+	streamDone := make(chan struct{})
+	go func() {
+		defer close(streamDone)
+		containers.StreamJobLogs(streamCtx, logger, clientset, observed.ObjectMeta.Namespace, jobName, tail)
+	}()
+
+	// The outputs are read from the pod while the Job waits for them, they never go through its status or log
+	var document []byte
+	var collectErr error
+	collectCtx, stopCollect := context.WithCancel(context.Background())
+	collectDone := make(chan struct{})
+	go func() {
+		defer close(collectDone)
+		if settings.CollectOutputs {
+			document, collectErr = containers.CollectJobOutputs(collectCtx, logger, clientset, observed.ObjectMeta.Namespace, jobName)
+		}
+	}()
+
+	timeout := time.Duration(settings.ActiveDeadlineSeconds)*time.Second + waitGracePeriod
+	waitErr := containers.WaitForJobCompletion(logger, clientset, observed.ObjectMeta.Namespace, jobName, timeout)
+	stopCollect()
+	<-collectDone
+
+	// Let the stream read the last lines of the finished container
+	select {
+	case <-streamDone:
+	case <-time.After(logDrainTimeout):
+	}
+	stopStream()
+	<-streamDone
+	if tail.Empty() {
+		if logs, err := containers.GetJobLogs(logger, clientset, observed.ObjectMeta.Namespace, jobName); err == nil {
+			tail.AddText(logs)
+		}
+	}
+
+	recorder.record(jobName, app, taggedImageName, started, tail.String(), waitErr)
+	if waitErr != nil {
+		return jobName, nil, waitErr
+	}
+	if collectErr != nil {
+		return jobName, nil, collectErr
+	}
+
+	return jobName, document, nil
+}
+
+// sensitiveValues returns the values of the variables whose name marks them as secrets
+func sensitiveValues(envVars map[string]string) []string {
+	values := make([]string, 0, len(envVars))
+	for key, value := range envVars {
+		if util.IsSensitiveVariable(key) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// outputsSecretValues returns the sensitive outputs stored by earlier runs, a runner may print them again
+func outputsSecretValues(clientset kubernetes.Interface, observed *v1alpha1.Terraform) []string {
+	secret, err := clientset.CoreV1().Secrets(observed.ObjectMeta.Namespace).Get(context.Background(), OutputsSecretName(observed), metav1.GetOptions{})
+	if err != nil {
+		return nil
+	}
+	values := make([]string, 0, len(secret.Data))
+	for _, value := range secret.Data {
+		values = append(values, string(value))
+	}
+	return values
+}
@@ -0,0 +1,59 @@
+package terraform
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+	"github.com/alustan/alustan/pkg/infrastructure/engine"
+)
+
+// IsModule reports whether the resource runs a module with an engine instead of scripts in a custom image
+func IsModule(observed *v1alpha1.Terraform) bool {
+	return observed.Spec.Module != nil
+}
+
+// ModuleImage returns the stock image the selected engine runs the module in
+func ModuleImage(observed *v1alpha1.Terraform) (string, error) {
+	moduleEngine, err := engine.Get(observed.Spec.Engine)
+	if err != nil {
+		return "", err
+	}
+	return moduleEngine.Image(observed.Spec.Module), nil
+}
+
+// moduleScript returns the script running a phase of the module, empty for an unknown engine
+func moduleScript(observed *v1alpha1.Terraform, phase string) string {
+	moduleEngine, err := engine.Get(observed.Spec.Engine)
+	if err != nil {
+		return ""
+	}
+	return moduleEngine.Script(observed.Spec.Module, phase)
+}
+
+// planScript returns the script producing a saved plan, empty when the plan stage is disabled
+func planScript(observed *v1alpha1.Terraform) string {
+	if IsModule(observed) {
+		return moduleScript(observed, engine.PhasePlan)
+	}
+	return observed.Spec.Scripts.Plan
+}
+
+// parsePlan reads the plan summary in the format of the engine; plan scripts are expected to run terraform
+func parsePlan(observed *v1alpha1.Terraform, logs string) *v1alpha1.PlanStatus {
+	if IsModule(observed) {
+		if moduleEngine, err := engine.Get(observed.Spec.Engine); err == nil {
+			return moduleEngine.ParsePlan(logs)
+		}
+	}
+	return engine.ParseTerraformPlan(logs)
+}
+
+// parseModuleOutputs reads the typed module outputs from the outputs document of the apply run,
+// along with the outputs the engine marks sensitive
+func parseModuleOutputs(observed *v1alpha1.Terraform, document []byte) (map[string]runtime.RawExtension, []string, error) {
+	moduleEngine, err := engine.Get(observed.Spec.Engine)
+	if err != nil {
+		return nil, nil, err
+	}
+	return moduleEngine.ParseOutputs(document)
+}
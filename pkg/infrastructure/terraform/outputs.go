@@ -0,0 +1,163 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+	kubernetesPkg "github.com/alustan/alustan/pkg/infrastructure/kubernetes"
+)
+
+// clusterSecretOwner identifies the resource among those publishing into the same cluster secret
+func clusterSecretOwner(observed *v1alpha1.Terraform) string {
+	return fmt.Sprintf("%s/%s", observed.ObjectMeta.Namespace, observed.ObjectMeta.Name)
+}
+
+// OutputsSecretName returns the name of the Secret holding the sensitive outputs of a Terraform resource
+func OutputsSecretName(observed *v1alpha1.Terraform) string {
+	if observed.Spec.OutputsSecretName != "" {
+		return observed.Spec.OutputsSecretName
+	}
+	return fmt.Sprintf("%s-outputs", observed.ObjectMeta.Name)
+}
+
+// storeSensitiveOutputs moves the outputs flagged by the engine or listed in sensitiveOutputs into the outputs Secret.
+// It returns the remaining outputs for the status and a reference to the Secret, nil when nothing is sensitive.
+func storeSensitiveOutputs(logger *zap.SugaredLogger, clientset kubernetes.Interface, observed *v1alpha1.Terraform, outputs map[string]runtime.RawExtension, flagged []string) (map[string]runtime.RawExtension, *v1alpha1.OutputsSecretRef, error) {
+	namespace := observed.ObjectMeta.Namespace
+	secretName := OutputsSecretName(observed)
+
+	sensitive := make(map[string]bool, len(flagged)+len(observed.Spec.SensitiveOutputs))
+	for _, key := range flagged {
+		sensitive[key] = true
+	}
+	for _, key := range observed.Spec.SensitiveOutputs {
+		// A misspelled entry would leave the intended output in the status
+		if _, ok := outputs[key]; !ok {
+			return nil, nil, fmt.Errorf("sensitive output %s was not produced", key)
+		}
+		sensitive[key] = true
+	}
+
+	if len(sensitive) == 0 {
+		if err := kubernetesPkg.DeleteOutputsSecret(logger, clientset, namespace, secretName); err != nil {
+			return nil, nil, err
+		}
+		return outputs, nil, nil
+	}
+
+	public := make(map[string]runtime.RawExtension, len(outputs))
+	data := make(map[string][]byte, len(sensitive))
+	keys := make([]string, 0, len(sensitive))
+	for key, output := range outputs {
+		if !sensitive[key] {
+			public[key] = output
+			continue
+		}
+		if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+			return nil, nil, fmt.Errorf("output %s can not be stored in a secret: %s", key, strings.Join(errs, ", "))
+		}
+		value, err := outputString(output)
+		if err != nil {
+			return nil, nil, fmt.Errorf("output %s: %v", key, err)
+		}
+		data[key] = []byte(value)
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	owner := metav1.NewControllerRef(observed, v1alpha1.SchemaGroupVersion.WithKind("Terraform"))
+	if err := kubernetesPkg.ApplyOutputsSecret(logger, clientset, namespace, secretName, observed.Spec.Environment, *owner, data); err != nil {
+		return nil, nil, err
+	}
+
+	return public, &v1alpha1.OutputsSecretRef{Name: secretName, Keys: keys}, nil
+}
+
+// publishOutputs writes the outputs into the cluster secret of the environment for App placeholders
+func publishOutputs(logger *zap.SugaredLogger, clientset kubernetes.Interface, observed *v1alpha1.Terraform, outputs map[string]runtime.RawExtension, secretRef *v1alpha1.OutputsSecretRef) error {
+	if observed.Spec.ClusterSecret.Disabled {
+		return nil
+	}
+
+	values, err := publishedOutputs(observed, outputs, secretRef)
+	if err != nil {
+		return err
+	}
+
+	return kubernetesPkg.PublishClusterSecret(logger, clientset, observed.Spec.Environment, clusterSecretOwner(observed), values)
+}
+
+// unpublishOutputs removes the outputs of a destroyed resource from the cluster secret
+func unpublishOutputs(logger *zap.SugaredLogger, clientset kubernetes.Interface, observed *v1alpha1.Terraform) error {
+	return kubernetesPkg.UnpublishClusterSecret(logger, clientset, observed.Spec.Environment, clusterSecretOwner(observed))
+}
+
+// publishedOutputs selects and renames the outputs according to the key mapping, all outputs when there is none.
+// Sensitive outputs are never published, Apps read them from the outputs Secret under their own names.
+func publishedOutputs(observed *v1alpha1.Terraform, outputs map[string]runtime.RawExtension, secretRef *v1alpha1.OutputsSecretRef) (map[string]string, error) {
+	keyMapping := observed.Spec.ClusterSecret.KeyMapping
+	if len(keyMapping) == 0 {
+		keyMapping = make(map[string]string, len(outputs))
+		for key := range outputs {
+			keyMapping[key] = key
+		}
+	}
+
+	values := make(map[string]string, len(keyMapping))
+	for outputKey, annotationKey := range keyMapping {
+		output, ok := outputs[outputKey]
+		if !ok && secretRef != nil && containsString(secretRef.Keys, outputKey) {
+			return nil, fmt.Errorf("output %s is sensitive and can not be published, Apps read it from Secret %s as is", outputKey, secretRef.Name)
+		}
+		if !ok {
+			return nil, fmt.Errorf("output %s in the cluster secret key mapping was not produced", outputKey)
+		}
+		if errs := validation.IsQualifiedName(annotationKey); len(errs) > 0 {
+			return nil, fmt.Errorf("output %s can not be published as %s: %s", outputKey, annotationKey, strings.Join(errs, ", "))
+		}
+
+		value, err := outputString(output)
+		if err != nil {
+			return nil, fmt.Errorf("output %s: %v", outputKey, err)
+		}
+		values[annotationKey] = value
+	}
+
+	return values, nil
+}
+
+// outputString renders an output as an annotation value: strings as is, anything else as JSON
+func outputString(output runtime.RawExtension) (string, error) {
+	var decoded interface{}
+	if err := json.Unmarshal(output.Raw, &decoded); err != nil {
+		return "", err
+	}
+
+	if text, ok := decoded.(string); ok {
+		return text, nil
+	}
+	raw, err := json.Marshal(decoded)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+// containsString reports whether value is among values
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package terraform
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+	"github.com/alustan/alustan/pkg/containers"
+)
+
+const (
+	// ApprovePlanAnnotation approves the saved plan whose ID matches the annotation value
+	ApprovePlanAnnotation = "alustan.io/approve-plan"
+	// CancelRunAnnotation cancels the in-flight run whenever it is set or its value changes
+	CancelRunAnnotation = "alustan.io/cancel-run"
+
+	planMountPath = "/plan"
+)
+
+// prunePlansScript removes the saved plans a new plan supersedes, plan files hold variables and outputs in clear text
+var prunePlansScript = fmt.Sprintf("rm -f %s/*.tfplan", planMountPath)
+
+// PlanClaimName returns the name of the PVC holding the saved plans of a Terraform resource
+func PlanClaimName(name string) string {
+	return fmt.Sprintf("%s-terraform-plan", name)
+}
+
+// SpecHash returns a stable hash of the spec, ignoring fields that do not affect the plan
+func SpecHash(spec v1alpha1.TerraformSpec) string {
+	spec.Approval.ApprovedPlan = ""
+	raw, _ := json.Marshal(spec)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// planFile returns the path of the saved plan inside the runner
+func planFile(planID string) string {
+	return fmt.Sprintf("%s/%s.tfplan", planMountPath, planID)
+}
+
+// runPlan runs the plan script and records a readable summary of the changes it found
+func runPlan(
+	logger *zap.SugaredLogger,
+	clientset kubernetes.Interface,
+	observed *v1alpha1.Terraform,
+	taggedImageName, secretName string,
+	envVars map[string]string,
+	recorder *runRecorder,
+) (*v1alpha1.PlanStatus, error) {
+	name := observed.ObjectMeta.Name
+	namespace := observed.ObjectMeta.Namespace
+	specHash := SpecHash(observed.Spec)
+
+	idSum := sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%d", specHash, taggedImageName, time.Now().UnixNano())))
+	planID := hex.EncodeToString(idSum[:])[:10]
+
+	claimName := PlanClaimName(name)
+	if err := containers.EnsurePVC(logger, clientset, namespace, claimName, containers.PVCSettings{}); err != nil {
+		return nil, fmt.Errorf("failed to ensure plan volume: %v", err)
+	}
+
+	plan, err := executePlan(logger, clientset, observed, taggedImageName, secretName, envVars, "plan", planFile(planID), []containers.ClaimMount{{ClaimName: claimName, MountPath: planMountPath}}, recorder)
+	if err != nil {
+		return nil, err
+	}
+	plan.ID = planID
+	plan.SpecHash = specHash
+	plan.Image = taggedImageName
+	plan.PlannedAt = metav1.Now()
+
+	logger.Infof("Plan %s for %s/%s: %s", plan.ID, namespace, name, plan.Summary)
+	recorder.event(corev1.EventTypeNormal, "PlanReady", fmt.Sprintf("Plan %s: %s", plan.ID, plan.Summary))
+	return plan, nil
+}
+
+// executePlan runs the plan script in a runner Job and parses its output
+func executePlan(
+	logger *zap.SugaredLogger,
+	clientset kubernetes.Interface,
+	observed *v1alpha1.Terraform,
+	taggedImageName, secretName string,
+	envVars map[string]string,
+	app, planPath string,
+	volumeClaims []containers.ClaimMount,
+	recorder *runRecorder,
+) (*v1alpha1.PlanStatus, error) {
+	planEnv := make(map[string]string, len(envVars)+1)
+	for key, value := range envVars {
+		planEnv[key] = value
+	}
+	planEnv["PLAN_FILE"] = planPath
+
+	jobName, _, err := runJob(logger, clientset, observed, planScript(observed), planEnv, taggedImageName, secretName, app, volumeClaims, recorder)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %v", app, err)
+	}
+
+	logs, err := containers.GetJobLogs(logger, clientset, observed.ObjectMeta.Namespace, jobName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s output: %v", app, err)
+	}
+
+	return parsePlan(observed, logs), nil
+}
+
+// PlanApproved reports whether the saved plan of the status was approved through the annotation or the spec
+func PlanApproved(observed *v1alpha1.Terraform) bool {
+	return isPlanApproved(observed, observed.Status.Plan)
+}
+
+// isPlanApproved reports whether the saved plan was approved through the annotation or the spec
+func isPlanApproved(observed *v1alpha1.Terraform, plan *v1alpha1.PlanStatus) bool {
+	if plan == nil || plan.ID == "" {
+		return false
+	}
+	if observed.ObjectMeta.Annotations[ApprovePlanAnnotation] == plan.ID {
+		return true
+	}
+	return observed.Spec.Approval.ApprovedPlan == plan.ID
+}
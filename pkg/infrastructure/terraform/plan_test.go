@@ -0,0 +1,37 @@
+package terraform
+
+import (
+	"testing"
+
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+)
+
+func TestIsPlanApproved(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotation  string
+		approved    string
+		plan        *v1alpha1.PlanStatus
+		wantApprove bool
+	}{
+		{name: "annotation", annotation: "abc123", plan: &v1alpha1.PlanStatus{ID: "abc123"}, wantApprove: true},
+		{name: "spec", approved: "abc123", plan: &v1alpha1.PlanStatus{ID: "abc123"}, wantApprove: true},
+		{name: "not approved", plan: &v1alpha1.PlanStatus{ID: "abc123"}},
+		{name: "stale approval", annotation: "def456", approved: "def456", plan: &v1alpha1.PlanStatus{ID: "abc123"}},
+		{name: "plan without id", annotation: "", approved: "", plan: &v1alpha1.PlanStatus{}},
+		{name: "no plan", annotation: "abc123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			observed := &v1alpha1.Terraform{}
+			if tt.annotation != "" {
+				observed.Annotations = map[string]string{ApprovePlanAnnotation: tt.annotation}
+			}
+			observed.Spec.Approval.ApprovedPlan = tt.approved
+			if got := isPlanApproved(observed, tt.plan); got != tt.wantApprove {
+				t.Fatalf("isPlanApproved() = %v, want %v", got, tt.wantApprove)
+			}
+		})
+	}
+}
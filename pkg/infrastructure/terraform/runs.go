@@ -0,0 +1,120 @@
+package terraform
+
+import (
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+	"github.com/alustan/alustan/pkg/containers"
+	kubernetesPkg "github.com/alustan/alustan/pkg/infrastructure/kubernetes"
+)
+
+const (
+	defaultRunHistoryLimit = 5
+
+	// logTailLines is the number of runner log lines kept in the status
+	logTailLines = 20
+)
+
+// runRecorder collects the runner executions of a sync into the bounded run history
+type runRecorder struct {
+	logger    *zap.SugaredLogger
+	clientset kubernetes.Interface
+	observed  *v1alpha1.Terraform
+	runs      []v1alpha1.TerraformRun
+	// logTail is the end of the log of the latest run
+	logTail string
+	// cancelled is set when a run was cancelled through the cancel annotation
+	cancelled bool
+}
+
+func newRunRecorder(logger *zap.SugaredLogger, clientset kubernetes.Interface, observed *v1alpha1.Terraform) *runRecorder {
+	return &runRecorder{
+		logger:    logger,
+		clientset: clientset,
+		observed:  observed,
+		runs:      append([]v1alpha1.TerraformRun(nil), observed.Status.Runs...),
+	}
+}
+
+// event emits a Kubernetes Event on the resource
+func (r *runRecorder) event(eventType, reason, message string) {
+	kubernetesPkg.RecordEvent(r.logger, r.clientset, r.observed, eventType, reason, message)
+}
+
+// start announces a runner Job that was just created
+func (r *runRecorder) start(jobName, phase, image string) {
+	r.event(corev1.EventTypeNormal, "RunStarted", fmt.Sprintf("Started %s run in Job %s with image %s", phase, jobName, image))
+}
+
+// record appends a finished run, reading its exit code from the runner Job, and reports a failure.
+// The log tail is only kept for the status, Events are readable more widely than the resource.
+func (r *runRecorder) record(jobName, phase, image string, started metav1.Time, logTail string, runErr error) {
+	if jobName == "" {
+		return
+	}
+
+	r.logTail = logTail
+	cancelled := errors.Is(runErr, containers.ErrRunCancelled)
+	if cancelled {
+		r.cancelled = true
+		r.event(corev1.EventTypeWarning, "RunCancelled", fmt.Sprintf("%s run in Job %s was cancelled", phase, jobName))
+	} else if runErr != nil {
+		r.event(corev1.EventTypeWarning, "RunFailed", fmt.Sprintf("%s run in Job %s failed: %v, see status.logTail", phase, jobName, runErr))
+	}
+
+	ended := metav1.Now()
+	exitCode, err := containers.GetJobExitCode(r.clientset, r.observed.ObjectMeta.Namespace, jobName)
+	if err != nil {
+		r.logger.Infof("Failed to read exit code of Job %s: %v", jobName, err)
+	}
+
+	r.runs = append(r.runs, v1alpha1.TerraformRun{
+		Phase:      phase,
+		Image:      image,
+		Generation: r.observed.GetGeneration(),
+		StartTime:  started,
+		EndTime:    &ended,
+		ExitCode:   exitCode,
+		LogsRef:    jobName,
+		Cancelled:  cancelled,
+	})
+}
+
+// maskOutputs replaces the values of the sensitive outputs in the log tail, a runner may have printed them
+func (r *runRecorder) maskOutputs(outputs map[string]runtime.RawExtension, keys []string) {
+	values := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if value, err := outputString(outputs[key]); err == nil {
+			values = append(values, value)
+		}
+	}
+	r.logTail = containers.MaskValues(r.logTail, values)
+}
+
+// history trims the runs to the configured limit, oldest first, and deletes the Jobs of dropped runs
+func (r *runRecorder) history() []v1alpha1.TerraformRun {
+	limit := r.observed.Spec.RunHistoryLimit
+	if limit <= 0 {
+		limit = defaultRunHistoryLimit
+	}
+	if len(r.runs) > limit {
+		r.runs = r.runs[len(r.runs)-limit:]
+	}
+
+	keep := make(map[string]bool, len(r.runs))
+	for _, run := range r.runs {
+		keep[run.LogsRef] = true
+	}
+	if err := containers.PruneRunJobs(r.logger, r.clientset, r.observed.ObjectMeta.Namespace, r.observed.ObjectMeta.Name, keep); err != nil {
+		r.logger.Infof("Failed to prune runner jobs of %s: %v", r.observed.ObjectMeta.Name, err)
+	}
+
+	return r.runs
+}
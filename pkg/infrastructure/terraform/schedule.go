@@ -0,0 +1,141 @@
+package terraform
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+)
+
+// maxWindowSteps bounds the search for the next eligible time through overlapping windows
+const maxWindowSteps = 100
+
+// window is a parsed TimeWindow
+type window struct {
+	schedule cron.Schedule
+	duration time.Duration
+}
+
+// NextScheduledRun returns the time of the first scheduled apply after from, nil without a schedule
+func NextScheduledRun(observed *v1alpha1.Terraform, from time.Time) (*metav1.Time, error) {
+	if observed.Spec.Schedule == "" {
+		return nil, nil
+	}
+	schedule, err := parseSchedule(observed.Spec.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %v", observed.Spec.Schedule, err)
+	}
+	next := schedule.Next(from)
+	if next.IsZero() {
+		return nil, fmt.Errorf("schedule %q never runs", observed.Spec.Schedule)
+	}
+	return &metav1.Time{Time: next}, nil
+}
+
+// NextEligibleTime returns the first time from now applies are allowed, outside the freeze windows
+// and within a maintenance window when there are any. The reason tells why now is not eligible.
+func NextEligibleTime(observed *v1alpha1.Terraform, now time.Time) (time.Time, string, error) {
+	freeze, err := parseWindows("freezeWindows", observed.Spec.FreezeWindows)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	maintenance, err := parseWindows("maintenanceWindows", observed.Spec.MaintenanceWindows)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	reason := ""
+	at := now
+	for step := 0; step < maxWindowSteps; step++ {
+		if end, open := windowEnd(freeze, at); open {
+			if reason == "" {
+				reason = "within a freeze window"
+			}
+			at = end
+			continue
+		}
+		if len(maintenance) == 0 {
+			return at, reason, nil
+		}
+		if _, open := windowEnd(maintenance, at); open {
+			return at, reason, nil
+		}
+		if reason == "" {
+			reason = "outside the maintenance windows"
+		}
+		next, ok := nextWindowStart(maintenance, at)
+		if !ok {
+			return time.Time{}, "", fmt.Errorf("maintenanceWindows never open")
+		}
+		at = next
+	}
+	return time.Time{}, "", fmt.Errorf("no time found outside the freezeWindows and within the maintenanceWindows")
+}
+
+// parseSchedule parses a standard cron expression, in UTC unless it selects a time zone
+func parseSchedule(spec string) (cron.Schedule, error) {
+	if !strings.HasPrefix(spec, "CRON_TZ=") && !strings.HasPrefix(spec, "TZ=") {
+		spec = "CRON_TZ=UTC " + spec
+	}
+	return cron.ParseStandard(spec)
+}
+
+// parseWindows parses the cron schedules of the windows of a spec field
+func parseWindows(field string, windows []v1alpha1.TimeWindow) ([]window, error) {
+	parsed := make([]window, 0, len(windows))
+	for i, w := range windows {
+		schedule, err := parseSchedule(w.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("%s[%d]: invalid schedule %q: %v", field, i, w.Schedule, err)
+		}
+		if w.Duration.Duration <= 0 {
+			return nil, fmt.Errorf("%s[%d]: duration must be positive", field, i)
+		}
+		parsed = append(parsed, window{schedule: schedule, duration: w.Duration.Duration})
+	}
+	return parsed, nil
+}
+
+// windowEnd reports whether one of the windows is open at t and when the last open one closes
+func windowEnd(windows []window, t time.Time) (time.Time, bool) {
+	var end time.Time
+	open := false
+	for _, w := range windows {
+		// The window is open when it started within its duration before t
+		start := w.schedule.Next(t.Add(-w.duration))
+		if start.IsZero() || start.After(t) {
+			continue
+		}
+		for {
+			next := w.schedule.Next(start)
+			if next.IsZero() || next.After(t) {
+				break
+			}
+			start = next
+		}
+		if closes := start.Add(w.duration); closes.After(end) {
+			end = closes
+		}
+		open = true
+	}
+	return end, open
+}
+
+// nextWindowStart returns when the first of the windows opens after t
+func nextWindowStart(windows []window, t time.Time) (time.Time, bool) {
+	var first time.Time
+	for _, w := range windows {
+		next := w.schedule.Next(t)
+		if next.IsZero() {
+			continue
+		}
+		if first.IsZero() || next.Before(first) {
+			first = next
+		}
+	}
+	return first, !first.IsZero()
+}
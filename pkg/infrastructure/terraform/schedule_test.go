@@ -0,0 +1,155 @@
+package terraform
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+)
+
+// windows returns TimeWindows of the schedule and duration pairs
+func windows(pairs ...interface{}) []v1alpha1.TimeWindow {
+	var parsed []v1alpha1.TimeWindow
+	for i := 0; i < len(pairs); i += 2 {
+		parsed = append(parsed, v1alpha1.TimeWindow{
+			Schedule: pairs[i].(string),
+			Duration: metav1.Duration{Duration: pairs[i+1].(time.Duration)},
+		})
+	}
+	return parsed
+}
+
+func TestNextEligibleTime(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	at := func(day, hour int) time.Time {
+		return time.Date(2026, 10, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name        string
+		freeze      []v1alpha1.TimeWindow
+		maintenance []v1alpha1.TimeWindow
+		want        time.Time
+		wantReason  string
+		wantErr     bool
+	}{
+		{
+			name: "no windows",
+			want: now,
+		},
+		{
+			name:       "within a freeze window",
+			freeze:     windows("0 10 * * *", 4*time.Hour),
+			want:       at(17, 14),
+			wantReason: "within a freeze window",
+		},
+		{
+			name:   "freeze window closed",
+			freeze: windows("0 20 * * *", 2*time.Hour),
+			want:   now,
+		},
+		{
+			name:       "overlapping freeze windows",
+			freeze:     windows("0 11 * * *", 2*time.Hour, "0 12 * * *", 3*time.Hour),
+			want:       at(17, 15),
+			wantReason: "within a freeze window",
+		},
+		{
+			name:        "within a maintenance window",
+			maintenance: windows("0 11 * * *", 2*time.Hour),
+			want:        now,
+		},
+		{
+			name:        "before the maintenance window",
+			maintenance: windows("0 22 * * *", 4*time.Hour),
+			want:        at(17, 22),
+			wantReason:  "outside the maintenance windows",
+		},
+		{
+			name:        "maintenance window closing now",
+			maintenance: windows("0 10 * * *", 2*time.Hour),
+			want:        at(18, 10),
+			wantReason:  "outside the maintenance windows",
+		},
+		{
+			name:        "freeze window over the start of the maintenance window",
+			freeze:      windows("0 12 * * *", 2*time.Hour),
+			maintenance: windows("0 13 * * *", 3*time.Hour),
+			want:        at(17, 14),
+			wantReason:  "within a freeze window",
+		},
+		{
+			name:        "maintenance window in a time zone",
+			maintenance: windows("CRON_TZ=Europe/Berlin 0 15 * * *", time.Hour),
+			want:        at(17, 13),
+			wantReason:  "outside the maintenance windows",
+		},
+		{
+			name:    "invalid schedule",
+			freeze:  windows("every day", time.Hour),
+			wantErr: true,
+		},
+		{
+			name:        "zero duration",
+			maintenance: windows("0 10 * * *", time.Duration(0)),
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			observed := &v1alpha1.Terraform{}
+			observed.Spec.FreezeWindows = tt.freeze
+			observed.Spec.MaintenanceWindows = tt.maintenance
+
+			got, reason, err := NextEligibleTime(observed, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NextEligibleTime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) || reason != tt.wantReason {
+				t.Fatalf("NextEligibleTime() = %v, %q, want %v, %q", got, reason, tt.want, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestNextScheduledRun(t *testing.T) {
+	from := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		schedule string
+		want     *time.Time
+		wantErr  bool
+	}{
+		{name: "no schedule"},
+		{name: "daily in UTC", schedule: "0 2 * * *", want: ptr(time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC))},
+		{name: "time zone", schedule: "CRON_TZ=America/New_York 0 9 * * 1", want: ptr(time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC))},
+		{name: "invalid", schedule: "0 25 * * *", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			observed := &v1alpha1.Terraform{}
+			observed.Spec.Schedule = tt.schedule
+
+			got, err := NextScheduledRun(observed, from)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NextScheduledRun() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			switch {
+			case tt.want == nil && got != nil:
+				t.Fatalf("NextScheduledRun() = %v, want none", got.Time)
+			case tt.want != nil && (got == nil || !got.Time.Equal(*tt.want)):
+				t.Fatalf("NextScheduledRun() = %v, want %v", got, *tt.want)
+			}
+		})
+	}
+}
+
+func ptr(t time.Time) *time.Time {
+	return &t
+}
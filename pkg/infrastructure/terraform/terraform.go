@@ -1,302 +1,361 @@
-package terraform
-
-import (
-	"fmt"
-	"encoding/json"
-	"strings"
-	"context"
-	"time"
-	
-     
-	"go.uber.org/zap"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/util/retry"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/dynamic"
-	v1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	clusterpkg "github.com/argoproj/argo-cd/v2/pkg/apiclient/cluster"
-
-	kubernetesPkg "github.com/alustan/alustan/pkg/infrastructure/kubernetes"
-	
-	"github.com/alustan/alustan/pkg/containers"
-	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
-	"github.com/alustan/alustan/pkg/infrastructure/errorstatus"
-
-)
-
-func GetScriptContent(logger *zap.SugaredLogger, observed *v1alpha1.Terraform, finalizing bool) (string, v1alpha1.TerraformStatus) {
-	var scriptContent string
-	var status v1alpha1.TerraformStatus
-
-	if finalizing {
-		if observed.Spec.Scripts.Destroy != "" {
-			scriptContent = observed.Spec.Scripts.Destroy
-		} else {
-			scriptContent = ""
-		}
-	} else {
-		scriptContent = observed.Spec.Scripts.Deploy
-		if scriptContent == "" {
-			status = errorstatus.ErrorResponse(logger,"executing script", fmt.Errorf("deploy script is missing"))
-			return "", status
-		}
-	}
-
-	return scriptContent, status
-}
-
-func ExecuteTerraform(
-	logger *zap.SugaredLogger,
-	clientset kubernetes.Interface,
-	dynamicClient dynamic.Interface,
-	clusterClient  clusterpkg.ClusterServiceClient,
-	observed *v1alpha1.Terraform,
-	scriptContent, taggedImageName, secretName string,
-	envVars map[string]string,
-	finalizing bool,
-) v1alpha1.TerraformStatus {
-
-	var status v1alpha1.TerraformStatus
-
-	if finalizing {
-
-		logger.Info("Attempting to destroy provisioned resources")
-		
-        status = runDestroy(logger, clientset, dynamicClient, observed, scriptContent, taggedImageName, secretName, envVars)
-
-		return status
-	}
-
-	status = v1alpha1.TerraformStatus{
-		State:   "Progressing",
-		Message: "Running Terraform Apply",
-	}
-
-	status = runApply(logger, clientset, observed, scriptContent, taggedImageName, secretName, envVars)
-
-	// Preserve any existing status fields in the TerraformStatus struct
-	finalStatus := v1alpha1.TerraformStatus{
-		State:       status.State,
-		Message:     status.Message,
-	}
-
-	if status.State == "Failed" {
-		return finalStatus
-	}
-
-	cluster := observed.Spec.Environment
-
-	argoerr := kubernetesPkg.CreateOrUpdateArgoCluster(logger, clusterClient, "in-cluster", cluster)
-	if argoerr != nil {
-		logger.Errorf("Failed to create or update ArgoCD secret: %v", argoerr)
-	    return errorstatus.ErrorResponse(logger, "Failed to create or update ArgoCD secret", argoerr)
-	}
-
-
-	
-   if observed.Spec.PostDeploy.Script != "" {
-		finalStatus.State = "Progressing"
-		finalStatus.Message = "Running postDeploy script"
-
-		postDeployOutput, err := runPostDeploy(logger, clientset, observed.ObjectMeta.Name, observed.ObjectMeta.Namespace, observed.Spec.PostDeploy, envVars, taggedImageName, secretName)
-		if err != nil {
-			return errorstatus.ErrorResponse(logger, "executing postDeploy script", err)
-		}
-
-		finalStatus.State = "Completed"
-		finalStatus.Message = "Infrastructure successfuly provisioned"
-		finalStatus.PostDeployOutput = postDeployOutput
-	} else {
-		finalStatus.State = "Completed"
-		finalStatus.Message = "Infrastructure successfuly provisioned"
-	}
-
-	return finalStatus
-}
-
-func runApply(
-	logger *zap.SugaredLogger,
-	clientset kubernetes.Interface,
-	observed *v1alpha1.Terraform,
-	scriptContent, taggedImageName, secretName string,
-	envVars map[string]string,
-) v1alpha1.TerraformStatus {
-	var status v1alpha1.TerraformStatus
-	var terraformErr error
-	var podName string
-	
-
-	err := retry.OnError(retry.DefaultRetry, func(err error) bool {
-		logger.Infof("Error occurred: %v", err)
-		return strings.Contains(err.Error(), "timeout")
-	}, func() error {
-		podName, terraformErr = containers.CreateOrUpdateRunPod(logger, clientset, observed.ObjectMeta.Name, observed.ObjectMeta.Namespace, scriptContent, envVars, taggedImageName, secretName, "deploy")
-		return terraformErr
-	})
-
-	status.State = "Success"
-	status.Message = "Terraform applied successfully"
-
-	if err != nil {
-		status.State = "Failed"
-		status.Message = terraformErr.Error()
-		return status
-	}
-
-	 containerErr := containers.WaitForPodCompletion(logger, clientset, observed.ObjectMeta.Namespace, podName)
-	if containerErr != nil {
-		status.State = "Failed"
-		status.Message = fmt.Sprintf("Error retrieving Terraform output: %v", containerErr)
-		return status
-	}
-
-  return status
-}
-
-func runDestroy(
-	logger *zap.SugaredLogger,
-	clientset kubernetes.Interface,
-	dynamicClient dynamic.Interface,
-	observed *v1alpha1.Terraform,
-	scriptContent, taggedImageName, secretName string,
-	envVars map[string]string,
-) v1alpha1.TerraformStatus {
-	var status v1alpha1.TerraformStatus
-	var podName string
-
-	if scriptContent == "" {
-		status.State = "Success"
-		status.Message = "No destroy script specified"
-		return status
-	}
-
-	var terraformErr error
-	retryErr := retry.OnError(retry.DefaultRetry, func(err error) bool {
-		logger.Infof("Error occurred: %v", err)
-		return strings.Contains(err.Error(), "timeout")
-	}, func() error {
-		podName, terraformErr = containers.CreateOrUpdateRunPod(
-			logger, clientset, observed.ObjectMeta.Name, observed.ObjectMeta.Namespace, scriptContent, envVars, taggedImageName, secretName, "destroy",
-		)
-		return terraformErr
-	})
-
-	if retryErr != nil {
-		status.State = "Failed"
-		status.Message = terraformErr.Error()
-		return status
-	}
-
-	// Wait for the destroy pod to complete and check its status
-	for {
-		// Retrieve the current state of the pod
-		pod, err := clientset.CoreV1().Pods(observed.ObjectMeta.Namespace).Get(context.Background(), podName, metav1.GetOptions{})
-		if err != nil {
-			logger.Errorf("Failed to get pod %s/%s: %v", observed.ObjectMeta.Namespace, podName, err)
-			status.State = "Failed"
-			status.Message = fmt.Sprintf("Failed to get pod: %v", err)
-			return status
-		}
-
-		// Log the current pod phase
-		logger.Infof("Pod %s is in phase %s", podName, pod.Status.Phase)
-
-		// Check if the pod has succeeded
-		if pod.Status.Phase == v1.PodSucceeded {
-			logger.Infof("Pod %s has succeeded", podName)
-			break
-		}
-
-		// Check if the pod has failed
-		if pod.Status.Phase == v1.PodFailed {
-			logger.Infof("Pod %s has failed", podName)
-			status.State = "Failed"
-			status.Message = fmt.Sprintf("pod %s failed", podName)
-			return status
-		}
-
-		// Sleep for 1 minute before checking again
-		time.Sleep(1 * time.Minute)
-	}
-
-	logger.Info("Terraform Destroy successful")
-	logger.Info("Removing finalizers")
-
-	// If successful, remove finalizer
-	err := kubernetesPkg.RemoveFinalizer(logger, dynamicClient, observed.ObjectMeta.Name, observed.ObjectMeta.Namespace)
-	if err != nil {
-		logger.Errorf("Failed to remove finalizer for %s/%s: %v", observed.ObjectMeta.Namespace, observed.ObjectMeta.Name, err)
-		status.State = "Error"
-		status.Message = fmt.Sprintf("Failed to remove finalizer: %v", err)
-		return status
-	}
-
-	status.State = "Success"
-	status.Message = "Destroy completed successfully"
-	return status
-}
-
-
-
-func runPostDeploy(
-	logger *zap.SugaredLogger,
-	clientset kubernetes.Interface,
-	name, namespace string,
-	postDeploy v1alpha1.PostDeploy,
-	envVars map[string]string,
-	image, secretName string,
-) (map[string]runtime.RawExtension, error) {
-	scriptPath := postDeploy.Script
-	if !strings.HasPrefix(scriptPath, "./") {
-		scriptPath = "./" + scriptPath
-	}
-
-	args := make([]string, 0, len(postDeploy.Args))
-	for flag, envVarKey := range postDeploy.Args {
-		value, ok := envVars[envVarKey]
-		if !ok {
-			return nil, fmt.Errorf("environment variable %s not found", envVarKey)
-		}
-		args = append(args, fmt.Sprintf("-%s=%s", flag, value))
-	}
-
-	command := fmt.Sprintf("%s %s", scriptPath, strings.Join(args, " "))
-
-	fmt.Println("Command:", command)
-
-	podName, err := containers.CreateOrUpdateRunPod(logger,clientset, name, namespace, command, envVars, image, secretName, "postdeploy")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create post-deploy pod: %v", err)
-	}
-
-	output, err := containers.ExtractPostDeployOutput(logger,clientset, namespace, podName)
-	if err != nil {
-		return nil, fmt.Errorf("error executing postDeploy script: %v", err)
-	}
-
-	convertedOutput, err := convertToRawExtensionMap(output)
-	if err != nil {
-		return nil, fmt.Errorf("error converting postDeploy output: %v", err)
-	}
-
-	return convertedOutput, nil
-}
-
-// convertToRawExtensionMap converts a map[string]interface{} to map[string]runtime.RawExtension
-func convertToRawExtensionMap(input map[string]interface{}) (map[string]runtime.RawExtension, error) {
-    result := make(map[string]runtime.RawExtension)
-
-	for key, value := range input {
-        // Marshal each value to JSON
-        raw, err := json.Marshal(value)
-        if err != nil {
-            return nil, fmt.Errorf("error marshaling value for key %s to JSON: %v", key, err)
-        }
-        
-		// Encode to runtime.RawExtension
-        result[key] = runtime.RawExtension{Raw: raw}
-    }
-
-    return result, nil
-}
+package terraform
+
+import (
+	"fmt"
+	"strings"
+	
+     
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	clusterpkg "github.com/argoproj/argo-cd/v2/pkg/apiclient/cluster"
+
+	kubernetesPkg "github.com/alustan/alustan/pkg/infrastructure/kubernetes"
+	
+	"github.com/alustan/alustan/pkg/containers"
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+	"github.com/alustan/alustan/pkg/infrastructure/engine"
+	"github.com/alustan/alustan/pkg/infrastructure/errorstatus"
+	"github.com/alustan/alustan/pkg/util"
+
+)
+
+func GetScriptContent(logger *zap.SugaredLogger, observed *v1alpha1.Terraform, finalizing bool) (string, v1alpha1.TerraformStatus) {
+	var scriptContent string
+	var status v1alpha1.TerraformStatus
+
+	if IsModule(observed) {
+		if observed.Spec.PostDeploy.Script != "" {
+			status = errorstatus.ErrorResponse(logger, "executing script", fmt.Errorf("postDeploy is not supported with module, outputs are read from the module"))
+			return "", status
+		}
+		if observed.Spec.Module.Source == "" {
+			status = errorstatus.ErrorResponse(logger, "executing script", fmt.Errorf("module source is missing"))
+			return "", status
+		}
+		if _, err := engine.Get(observed.Spec.Engine); err != nil {
+			status = errorstatus.ErrorResponse(logger, "executing script", err)
+			return "", status
+		}
+		if finalizing {
+			return moduleScript(observed, engine.PhaseDestroy), status
+		}
+		return moduleScript(observed, engine.PhaseApply), status
+	}
+
+	if observed.Spec.Engine != "" {
+		status = errorstatus.ErrorResponse(logger, "executing script", fmt.Errorf("engine %s requires a module", observed.Spec.Engine))
+		return "", status
+	}
+
+	if finalizing {
+		scriptContent = observed.Spec.Scripts.Destroy
+		if scriptContent == "" {
+			status = errorstatus.ErrorResponse(logger, "executing script", fmt.Errorf("deletionPolicy %s requires a destroy script", DeletionPolicyDestroy))
+			return "", status
+		}
+	} else {
+		scriptContent = observed.Spec.Scripts.Deploy
+		if scriptContent == "" {
+			status = errorstatus.ErrorResponse(logger,"executing script", fmt.Errorf("deploy script is missing"))
+			return "", status
+		}
+	}
+
+	return scriptContent, status
+}
+
+func ExecuteTerraform(
+	logger *zap.SugaredLogger,
+	clientset kubernetes.Interface,
+	dynamicClient dynamic.Interface,
+	clusterClient  clusterpkg.ClusterServiceClient,
+	observed *v1alpha1.Terraform,
+	scriptContent, taggedImageName, secretName string,
+	envVars map[string]string,
+	finalizing bool,
+) v1alpha1.TerraformStatus {
+	recorder := newRunRecorder(logger, clientset, observed)
+
+	status := executeTerraform(logger, clientset, dynamicClient, clusterClient, observed, scriptContent, taggedImageName, secretName, envVars, finalizing, recorder)
+	// A cancelled run fails the step it belongs to; report the cancellation rather than the failure
+	if recorder.cancelled {
+		status.State = "Cancelled"
+		status.Message = fmt.Sprintf("Run cancelled through the %s annotation", CancelRunAnnotation)
+	}
+	if !DeletionCompleted(status) {
+		status.Runs = recorder.history()
+		status.LogTail = recorder.logTail
+	}
+
+	return status
+}
+
+func executeTerraform(
+	logger *zap.SugaredLogger,
+	clientset kubernetes.Interface,
+	dynamicClient dynamic.Interface,
+	clusterClient  clusterpkg.ClusterServiceClient,
+	observed *v1alpha1.Terraform,
+	scriptContent, taggedImageName, secretName string,
+	envVars map[string]string,
+	finalizing bool,
+	recorder *runRecorder,
+) v1alpha1.TerraformStatus {
+
+	var status v1alpha1.TerraformStatus
+
+	if finalizing {
+
+		logger.Info("Attempting to destroy provisioned resources")
+		
+        status = runDestroy(logger, clientset, dynamicClient, clusterClient, observed, scriptContent, taggedImageName, secretName, envVars, recorder)
+
+		return status
+	}
+
+	var plan *v1alpha1.PlanStatus
+	var volumeClaims []containers.ClaimMount
+
+	if planScript(observed) != "" {
+		// The plan is a copy, so approving it leaves the observed status as it was read
+		plan = observed.Status.Plan.DeepCopy()
+		specHash := SpecHash(observed.Spec)
+
+		// Reuse the saved plan while it awaits approval, otherwise plan again
+		if plan == nil || plan.SpecHash != specHash || plan.Approved || !observed.Spec.Approval.Required {
+			var err error
+			plan, err = runPlan(logger, clientset, observed, taggedImageName, secretName, envVars, recorder)
+			if err != nil {
+				return errorstatus.ErrorResponse(logger, "running Terraform plan", err)
+			}
+		}
+
+		if observed.Spec.Approval.Required && !isPlanApproved(observed, plan) {
+			return v1alpha1.TerraformStatus{
+				State:   "AwaitingApproval",
+				Message: fmt.Sprintf("Plan %s (%s) is awaiting approval", plan.ID, plan.Summary),
+				Plan:    plan,
+			}
+		}
+		// Only an explicit approval of this plan marks it approved
+		plan.Approved = isPlanApproved(observed, plan)
+
+		// Apply the exact saved plan with the image that produced it
+		applyEnv := make(map[string]string, len(envVars)+1)
+		for key, value := range envVars {
+			applyEnv[key] = value
+		}
+		applyEnv["PLAN_FILE"] = planFile(plan.ID)
+		envVars = applyEnv
+		taggedImageName = plan.Image
+		volumeClaims = []containers.ClaimMount{{ClaimName: PlanClaimName(observed.ObjectMeta.Name), MountPath: planMountPath}}
+	} else if observed.Spec.Approval.Required {
+		return errorstatus.ErrorResponse(logger, "executing script", fmt.Errorf("approval is required but no plan script is specified"))
+	}
+
+	status = v1alpha1.TerraformStatus{
+		State:   "Progressing",
+		Message: "Running Terraform Apply",
+	}
+
+	status, applyJob, applyOutputs := runApply(logger, clientset, observed, scriptContent, taggedImageName, secretName, envVars, volumeClaims, recorder)
+
+	// Preserve any existing status fields in the TerraformStatus struct
+	finalStatus := v1alpha1.TerraformStatus{
+		State:       status.State,
+		Message:     status.Message,
+		Plan:        plan,
+	}
+
+	if status.State == "Failed" {
+		return finalStatus
+	}
+
+	// Outputs the engine marks sensitive
+	var flaggedOutputs []string
+
+	// Modules report their outputs directly, there is no postDeploy script to run
+	if IsModule(observed) {
+		document, err := containers.GetJobOutputs(logger, clientset, observed.ObjectMeta.Namespace, applyJob, applyOutputs)
+		if err != nil {
+			return errorstatus.ErrorResponse(logger, "reading module outputs", err)
+		}
+		finalStatus.PostDeployOutput, flaggedOutputs, err = parseModuleOutputs(observed, document)
+		if err != nil {
+			return errorstatus.ErrorResponse(logger, "reading module outputs", err)
+		}
+	}
+
+	// A remote cluster is registered from the outputs once they are all known
+	if observed.Spec.ArgoCluster == nil {
+		cluster := observed.Spec.Environment
+
+		argoerr := kubernetesPkg.CreateOrUpdateArgoCluster(logger, clusterClient, "in-cluster", cluster)
+		if argoerr != nil {
+			logger.Errorf("Failed to create or update ArgoCD secret: %v", argoerr)
+		    return errorstatus.ErrorResponse(logger, "Failed to create or update ArgoCD secret", argoerr)
+		}
+	}
+
+
+	
+   if observed.Spec.PostDeploy.Script != "" {
+		finalStatus.State = "Progressing"
+		finalStatus.Message = "Running postDeploy script"
+
+		postDeployOutput, err := runPostDeploy(logger, clientset, observed, observed.Spec.PostDeploy, envVars, taggedImageName, secretName, recorder)
+		if err != nil {
+			return errorstatus.ErrorResponse(logger, "executing postDeploy script", err)
+		}
+
+		finalStatus.State = "Completed"
+		finalStatus.Message = "Infrastructure successfuly provisioned"
+		finalStatus.PostDeployOutput = postDeployOutput
+	} else {
+		finalStatus.State = "Completed"
+		finalStatus.Message = "Infrastructure successfuly provisioned"
+	}
+
+	// Apps of the environment deploy to the cluster the outputs describe
+	if observed.Spec.ArgoCluster != nil {
+		argoCluster, err := registerArgoCluster(logger, clusterClient, observed, finalStatus.PostDeployOutput)
+		if err != nil {
+			return errorstatus.ErrorResponse(logger, "registering the Argo CD cluster", err)
+		}
+		finalStatus.ArgoCluster = argoCluster
+	} else if err := removeArgoCluster(logger, clusterClient, observed); err != nil {
+		return errorstatus.ErrorResponse(logger, "removing the Argo CD cluster", err)
+	}
+
+	// Sensitive outputs never reach the status, which anyone able to read the resource can see
+	publicOutputs, secretRef, err := storeSensitiveOutputs(logger, clientset, observed, finalStatus.PostDeployOutput, flaggedOutputs)
+	if err != nil {
+		return errorstatus.ErrorResponse(logger, "storing sensitive outputs", err)
+	}
+	if secretRef != nil {
+		recorder.maskOutputs(finalStatus.PostDeployOutput, secretRef.Keys)
+	}
+	finalStatus.PostDeployOutput = publicOutputs
+	finalStatus.OutputsSecretRef = secretRef
+
+	if err := publishOutputs(logger, clientset, observed, finalStatus.PostDeployOutput, secretRef); err != nil {
+		return errorstatus.ErrorResponse(logger, "publishing outputs to the cluster secret", err)
+	}
+
+	return finalStatus
+}
+
+func runApply(
+	logger *zap.SugaredLogger,
+	clientset kubernetes.Interface,
+	observed *v1alpha1.Terraform,
+	scriptContent, taggedImageName, secretName string,
+	envVars map[string]string,
+	volumeClaims []containers.ClaimMount,
+	recorder *runRecorder,
+) (v1alpha1.TerraformStatus, string, []byte) {
+	var status v1alpha1.TerraformStatus
+
+	status.State = "Success"
+	status.Message = "Terraform applied successfully"
+
+	jobName, outputs, err := runJob(logger, clientset, observed, scriptContent, envVars, taggedImageName, secretName, "deploy", volumeClaims, recorder)
+	if err != nil {
+		status.State = "Failed"
+		status.Message = fmt.Sprintf("Terraform apply failed: %v", err)
+		return status, jobName, nil
+	}
+	recorder.event(corev1.EventTypeNormal, "ApplySucceeded", fmt.Sprintf("Apply run in Job %s finished", jobName))
+
+  return status, jobName, outputs
+}
+
+func runDestroy(
+	logger *zap.SugaredLogger,
+	clientset kubernetes.Interface,
+	dynamicClient dynamic.Interface,
+	clusterClient clusterpkg.ClusterServiceClient,
+	observed *v1alpha1.Terraform,
+	scriptContent, taggedImageName, secretName string,
+	envVars map[string]string,
+	recorder *runRecorder,
+) v1alpha1.TerraformStatus {
+	var status v1alpha1.TerraformStatus
+
+	_, _, err := runJob(logger, clientset, observed, scriptContent, envVars, taggedImageName, secretName, "destroy", nil, recorder)
+	if err != nil {
+		status.State = "Failed"
+		status.Message = fmt.Sprintf("Terraform destroy failed: %v", err)
+		return status
+	}
+
+	logger.Info("Terraform Destroy successful")
+
+	status = releaseResource(logger, clientset, dynamicClient, clusterClient, observed)
+	if status.State == "Error" {
+		return status
+	}
+
+	status.State = "Success"
+	status.Message = destroyedMessage
+	return status
+}
+
+
+
+func runPostDeploy(
+	logger *zap.SugaredLogger,
+	clientset kubernetes.Interface,
+	observed *v1alpha1.Terraform,
+	postDeploy v1alpha1.PostDeploy,
+	envVars map[string]string,
+	image, secretName string,
+	recorder *runRecorder,
+) (map[string]runtime.RawExtension, error) {
+	scriptPath := postDeploy.Script
+	if !strings.HasPrefix(scriptPath, "./") {
+		scriptPath = "./" + scriptPath
+	}
+
+	args := make([]string, 0, len(postDeploy.Args))
+	loggedArgs := make([]string, 0, len(postDeploy.Args))
+	for flag, envVarKey := range postDeploy.Args {
+		value, ok := envVars[envVarKey]
+		if !ok {
+			if !isSourcedVariable(observed, envVarKey) {
+				return nil, fmt.Errorf("environment variable %s not found", envVarKey)
+			}
+			// Let Kubernetes expand sourced values so they never pass through the controller
+			value = fmt.Sprintf("$(%s)", envVarKey)
+		}
+		args = append(args, fmt.Sprintf("-%s=%s", flag, value))
+		if util.IsSensitiveVariable(envVarKey) {
+			value = "<redacted>"
+		}
+		loggedArgs = append(loggedArgs, fmt.Sprintf("-%s=%s", flag, value))
+	}
+
+	command := fmt.Sprintf("%s %s", scriptPath, strings.Join(args, " "))
+
+	logger.Infof("Command: %s %s", scriptPath, strings.Join(loggedArgs, " "))
+
+	jobName, outputs, err := runJob(logger, clientset, observed, command, envVars, image, secretName, "postdeploy", nil, recorder)
+	if err != nil {
+		return nil, fmt.Errorf("post-deploy job failed: %v", err)
+	}
+
+	document, err := containers.GetJobOutputs(logger, clientset, observed.ObjectMeta.Namespace, jobName, outputs)
+	if err != nil {
+		return nil, fmt.Errorf("error executing postDeploy script: %v", err)
+	}
+
+	output, err := containers.ParseOutputs(document)
+	if err != nil {
+		return nil, fmt.Errorf("error reading postDeploy outputs: %v", err)
+	}
+
+	return output, nil
+}
@@ -0,0 +1,87 @@
+package terraform
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/alustan/alustan/api/infrastructure/v1alpha1"
+)
+
+// variableSources renders spec.variablesFrom as runner env vars resolved by the kubelet
+func variableSources(observed *v1alpha1.Terraform) []v1.EnvVar {
+	sources := make([]v1.EnvVar, 0, len(observed.Spec.VariablesFrom))
+	for _, variable := range observed.Spec.VariablesFrom {
+		sources = append(sources, v1.EnvVar{
+			Name: variable.Name,
+			ValueFrom: &v1.EnvVarSource{
+				SecretKeyRef:    variable.ValueFrom.SecretKeyRef,
+				ConfigMapKeyRef: variable.ValueFrom.ConfigMapKeyRef,
+			},
+		})
+	}
+	return sources
+}
+
+// isSourcedVariable reports whether the variable is read from a Secret or ConfigMap
+func isSourcedVariable(observed *v1alpha1.Terraform, name string) bool {
+	for _, variable := range observed.Spec.VariablesFrom {
+		if variable.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validateVariableSources checks that every required Secret and ConfigMap key exists,
+// since a missing one would otherwise leave the runner pod stuck until the Job deadline.
+// It returns the values of the Secret keys, which are masked in the runner log.
+func validateVariableSources(clientset kubernetes.Interface, observed *v1alpha1.Terraform) ([]string, error) {
+	namespace := observed.ObjectMeta.Namespace
+	var secretValues []string
+
+	for _, variable := range observed.Spec.VariablesFrom {
+		secretRef := variable.ValueFrom.SecretKeyRef
+		configMapRef := variable.ValueFrom.ConfigMapKeyRef
+
+		switch {
+		case secretRef != nil && configMapRef != nil:
+			return nil, fmt.Errorf("variable %s must set only one of secretKeyRef and configMapKeyRef", variable.Name)
+
+		case secretRef != nil:
+			secret, err := clientset.CoreV1().Secrets(namespace).Get(context.Background(), secretRef.Name, metav1.GetOptions{})
+			if err != nil {
+				if apierrors.IsNotFound(err) && secretRef.Optional != nil && *secretRef.Optional {
+					continue
+				}
+				return nil, fmt.Errorf("variable %s: failed to get Secret %s: %v", variable.Name, secretRef.Name, err)
+			}
+			value, ok := secret.Data[secretRef.Key]
+			if !ok && (secretRef.Optional == nil || !*secretRef.Optional) {
+				return nil, fmt.Errorf("variable %s: key %s not found in Secret %s", variable.Name, secretRef.Key, secretRef.Name)
+			}
+			secretValues = append(secretValues, string(value))
+
+		case configMapRef != nil:
+			configMap, err := clientset.CoreV1().ConfigMaps(namespace).Get(context.Background(), configMapRef.Name, metav1.GetOptions{})
+			if err != nil {
+				if apierrors.IsNotFound(err) && configMapRef.Optional != nil && *configMapRef.Optional {
+					continue
+				}
+				return nil, fmt.Errorf("variable %s: failed to get ConfigMap %s: %v", variable.Name, configMapRef.Name, err)
+			}
+			if _, ok := configMap.Data[configMapRef.Key]; !ok && (configMapRef.Optional == nil || !*configMapRef.Optional) {
+				return nil, fmt.Errorf("variable %s: key %s not found in ConfigMap %s", variable.Name, configMapRef.Key, configMapRef.Name)
+			}
+
+		default:
+			return nil, fmt.Errorf("variable %s must set secretKeyRef or configMapKeyRef", variable.Name)
+		}
+	}
+
+	return secretValues, nil
+}
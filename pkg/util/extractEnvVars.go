@@ -1,30 +1,60 @@
-package util
-
-import (
-	"fmt"
-)
-
-
-
-
-func FormatEnvVars(envVars map[string]string) []string {
-	formattedVars := make([]string, 0, len(envVars))
-	for key, value := range envVars {
-		formattedVars = append(formattedVars, fmt.Sprintf("%s=%s", key, value))
-	}
-	return formattedVars
-}
-
-
-func ExtractEnvVars(variables map[string]string) map[string]string {
-	if variables == nil {
-		return nil
-	}
-	envVars := make(map[string]string)
-	for key, value := range variables {
-		envVars[key] = value
-	}
-	
-	return envVars
-}
-
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+
+
+
+func FormatEnvVars(envVars map[string]string) []string {
+	formattedVars := make([]string, 0, len(envVars))
+	for key, value := range envVars {
+		formattedVars = append(formattedVars, fmt.Sprintf("%s=%s", key, value))
+	}
+	return formattedVars
+}
+
+
+func ExtractEnvVars(variables map[string]string) map[string]string {
+	if variables == nil {
+		return nil
+	}
+	envVars := make(map[string]string)
+	for key, value := range variables {
+		envVars[key] = value
+	}
+	
+	return envVars
+}
+
+
+// sensitiveVariableHints are name fragments marking a variable whose value must not be logged
+var sensitiveVariableHints = []string{"PASSWORD", "PASSWD", "SECRET", "TOKEN", "KEY", "CREDENTIAL", "PRIVATE", "AUTH"}
+
+// IsSensitiveVariable reports whether the variable name suggests it holds a secret
+func IsSensitiveVariable(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, hint := range sensitiveVariableHints {
+		if strings.Contains(upper, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactEnvVars returns a copy of the variables safe for logging, masking sensitive values
+func RedactEnvVars(variables map[string]string) map[string]string {
+	if variables == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(variables))
+	for key, value := range variables {
+		if IsSensitiveVariable(key) {
+			value = "<redacted>"
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
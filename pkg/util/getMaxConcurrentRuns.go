@@ -0,0 +1,25 @@
+package util
+
+import (
+	"log"
+	"os"
+	"strconv"
+)
+
+// GetMaxConcurrentRuns retrieves the cluster-wide limit of Terraform resources running at once from the
+// environment variable, 0 meaning no limit.
+func GetMaxConcurrentRuns() int {
+	value := os.Getenv("MAX_CONCURRENT_RUNS")
+	if value == "" {
+		return 0
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		log.Printf("Invalid MAX_CONCURRENT_RUNS %q, running without a limit", value)
+		return 0
+	}
+
+	log.Printf("Using MAX_CONCURRENT_RUNS from environment: %d", limit)
+	return limit
+}
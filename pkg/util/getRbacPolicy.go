@@ -0,0 +1,23 @@
+package util
+
+import (
+	"log"
+	"os"
+)
+
+const defaultRunnerRBACPolicy = "restricted"
+
+// GetRunnerRBACPolicy retrieves the RBAC policy applied to Terraform runners from the environment variable
+// or returns the default restricted policy.
+func GetRunnerRBACPolicy() string {
+	policy := os.Getenv("RUNNER_RBAC_POLICY")
+	switch policy {
+	case "restricted", "permissive":
+		return policy
+	case "":
+		return defaultRunnerRBACPolicy
+	default:
+		log.Printf("Invalid RUNNER_RBAC_POLICY %q, using default value: %s", policy, defaultRunnerRBACPolicy)
+		return defaultRunnerRBACPolicy
+	}
+}